@@ -2,6 +2,7 @@ package main
 
 import (
 	"bytes"
+	stdJSON "encoding/json"
 	"fmt"
 	"io"
 	"io/fs"
@@ -13,6 +14,7 @@ import (
 	"path/filepath"
 	"regexp"
 	"runtime"
+	"slices"
 	"sort"
 	"strings"
 	"time"
@@ -42,7 +44,7 @@ var extMap = map[string]string{
 	"html":        "text/html",
 	"js":          "application/javascript",
 	"json":        "application/json",
-	"mjs":         "application/javascript",
+	"mjs":         "module",
 	"mustache":    "text/x-mustache-template",
 	"php":         "application/x-httpd-php",
 	"rss":         "application/rss+xml",
@@ -71,6 +73,11 @@ var (
 	watch              bool
 	sync               bool
 	bundle             bool
+	jsBundle           bool
+	jsSplit            bool
+	jsBundler          *js.Minifier
+	cssBundler         *css.Minifier
+	legalComments      min.LegalComments
 	preserve           []string
 	preserveMode       bool
 	preserveOwnership  bool
@@ -104,6 +111,38 @@ func (m Matches) Scan(name string, s []string) (int, error) {
 	return n, nil
 }
 
+// KeepNames is either a bool to keep all names, or a regular expression prefixed by a tilde to keep the names that match.
+type KeepNames struct {
+	re **regexp.Regexp
+}
+
+func (m KeepNames) Help() (string, string) {
+	val := ""
+	if *m.re != nil {
+		val = "~" + (*m.re).String()
+	}
+	return val, "bool|~regexp"
+}
+
+func (m KeepNames) Scan(name string, s []string) (int, error) {
+	if 0 < len(s) && strings.HasPrefix(s[0], "~") {
+		re, err := regexp.Compile(s[0][1:])
+		if err != nil {
+			return 0, err
+		}
+		*m.re = re
+		return 1, nil
+	} else if 0 < len(s) && (s[0] == "true" || s[0] == "false") {
+		*m.re = nil
+		if s[0] == "true" {
+			*m.re = regexp.MustCompile("")
+		}
+		return 1, nil
+	}
+	*m.re = regexp.MustCompile("")
+	return 0, nil
+}
+
 type Includes struct {
 	filters *[]string
 }
@@ -116,6 +155,72 @@ func (m Includes) Help() (string, string) {
 	return val, "[]string"
 }
 
+type TemplateTags struct {
+	tags *map[string]string
+}
+
+func (m TemplateTags) Help() (string, string) {
+	val := ""
+	if 0 < len(*m.tags) {
+		val = fmt.Sprint(*m.tags)
+	}
+	return val, "[]string"
+}
+
+func (m TemplateTags) Scan(name string, s []string) (int, error) {
+	n := 0
+	for _, item := range s {
+		if strings.HasPrefix(item, "-") {
+			break
+		}
+		tag, mimetype, ok := strings.Cut(item, "=")
+		if !ok {
+			if mimetype, ok = js.DefaultTemplateTags[tag]; !ok {
+				return n, fmt.Errorf("invalid template tag %q, expected TAG=MIMETYPE", item)
+			}
+		} else if tag == "" || mimetype == "" {
+			return n, fmt.Errorf("invalid template tag %q, expected TAG=MIMETYPE", item)
+		}
+		if *m.tags == nil {
+			*m.tags = map[string]string{}
+		}
+		(*m.tags)[tag] = mimetype
+		n++
+	}
+	return n, nil
+}
+
+type Defines struct {
+	defines *map[string]string
+}
+
+func (m Defines) Help() (string, string) {
+	val := ""
+	if 0 < len(*m.defines) {
+		val = fmt.Sprint(*m.defines)
+	}
+	return val, "[]string"
+}
+
+func (m Defines) Scan(name string, s []string) (int, error) {
+	n := 0
+	for _, item := range s {
+		if strings.HasPrefix(item, "-") {
+			break
+		}
+		key, val, ok := strings.Cut(item, "=")
+		if !ok || key == "" {
+			return n, fmt.Errorf("invalid define %q, expected KEY=VALUE", item)
+		}
+		if *m.defines == nil {
+			*m.defines = map[string]string{}
+		}
+		(*m.defines)[key] = val
+		n++
+	}
+	return n, nil
+}
+
 func (m Includes) Scan(name string, s []string) (int, error) {
 	n := 0
 	for _, item := range s {
@@ -191,6 +296,13 @@ func run() int {
 	var inputs []string
 	var output string
 	var siteurl string
+	var jsMangleProps string
+	var jsNameCache string
+	var legalCommentsMode string
+	var cssTargets string
+	var cssPurge []string
+	var cssPurgeSafelist []string
+	var cssRenameVars string
 
 	cssMinifier := css.Minifier{}
 	htmlMinifier := html.Minifier{}
@@ -222,11 +334,20 @@ func run() int {
 	f.AddOpt(&watch, "w", "watch", "Watch files and minify upon changes")
 	f.AddOpt(&sync, "s", "sync", "Copy all files to destination directory and minify when filetype matches")
 	f.AddOpt(&preserve, "p", "preserve", "Preserve options (mode, ownership, timestamps, links, all)")
-	f.AddOpt(&bundle, "b", "bundle", "Bundle files by concatenation into a single file")
+	f.AddOpt(&bundle, "b", "bundle", "Bundle files by concatenation into a single file, and inline stylesheets imported by CSS files")
 	f.AddOpt(&version, "", "version", "Version")
 
 	f.AddOpt(&siteurl, "", "url", "URL of file to enable URL minification")
+	f.AddOpt(&legalCommentsMode, "", "legal-comments", "Legal comments in CSS and JS: none, inline (default), eof to move them to the end, or external to extract them to the output file with .LICENSE.txt appended")
+	f.AddOpt(&cssMinifier.FlattenNesting, "", "css-flatten-nesting", "Flatten nested style rules into plain rulesets for browsers without CSS nesting")
+	f.AddOpt(&cssMinifier.MergeDeclarations, "", "css-merge-declarations", "Remove overridden declarations and merge longhands into shorthands")
+	f.AddOpt(&cssMinifier.MergeRules, "", "css-merge-rules", "Merge rulesets with the same selectors or declarations where the cascade order is preserved")
 	f.AddOpt(&cssMinifier.Precision, "", "css-precision", "Number of significant digits to preserve in numbers, 0 is all")
+	f.AddOpt(&cssPurge, "", "css-purge", "Remove rules whose selectors cannot match the class names, IDs, tags, and attributes used in these HTML, JS, or other content files (glob patterns)")
+	f.AddOpt(&cssPurgeSafelist, "", "css-purge-safelist", "Class names, IDs, tags, keyframes, font families, and custom properties to keep when purging, or regular expressions prefixed by a tilde (eg. ~^js-)")
+	f.AddOpt(&cssMinifier.RemoveUnusedVars, "", "css-remove-unused-vars", "Remove custom properties that are not referenced in the stylesheet")
+	f.AddOpt(&cssRenameVars, "", "css-rename-vars", "Rename custom properties to short names, and load and save the names from this JSON file for scripts that use them")
+	f.AddOpt(&cssTargets, "", "css-targets", "Minimum browser versions to support, enables optimizations that introduce newer syntax (e.g. chrome>=90,safari>=14)")
 	f.AddOpt(&cssMinifier.Version, "", "css-version", "CSS version to toggle supported optimizations (e.g. 2), by default 0 is the latest version")
 	f.AddOpt(&htmlMinifier.KeepComments, "", "html-keep-comments", "Preserve all comments")
 	f.AddOpt(&htmlMinifier.KeepConditionalComments, "", "html-keep-conditional-comments", "Preserve all IE conditional comments (DEPRECATED)")
@@ -237,11 +358,31 @@ func run() int {
 	f.AddOpt(&htmlMinifier.KeepWhitespace, "", "html-keep-whitespace", "Preserve whitespace characters but still collapse multiple into one")
 	f.AddOpt(&htmlMinifier.KeepQuotes, "", "html-keep-quotes", "Preserve quotes around attribute values")
 	//f.AddOpt(&htmlMinifier.TemplateDelims, "", "html-template-delims", "Set template delimiters explicitly, for example <?,?> for PHP or {{,}} for Go templates") // TODO: fix parsing {{ }} in tdewolff/argp
+	f.AddOpt(Defines{&jsMinifier.Defines}, "", "js-define", "Replace global identifiers or member expressions by literal values (eg. __DEV__=false)")
+	f.AddOpt(&jsBundle, "", "js-bundle", "Bundle ES modules starting from each input file by resolving relative imports, removing unused exports")
+	f.AddOpt(&jsSplit, "", "js-split", "Write dynamically imported modules of --js-bundle to separate files next to the output file")
+	f.AddOpt(&jsMinifier.DropConsole, "", "js-drop-console", "Remove calls to console methods whose results are unused")
+	f.AddOpt(&jsMinifier.DropDebugger, "", "js-drop-debugger", "Remove debugger statements")
+	f.AddOpt(&jsMinifier.PureFuncs, "", "js-pure-funcs", "Functions without side effects whose calls are removed when their results are unused (eg. Math.floor)")
+	f.AddOpt(&jsMinifier.PureModules, "", "js-pure-modules", "Modules without side effects whose unused imports are removed")
+	f.AddOpt(&jsMangleProps, "", "js-mangle-props", "Mangle property names that match the regular expression (eg. ^_)")
+	f.AddOpt(&jsMinifier.Reserved, "", "js-reserved", "Variable names that are not renamed and are not used as new names")
+	f.AddOpt(&jsMinifier.ReservedProps, "", "js-reserved-props", "Property names that are not mangled")
+	f.AddOpt(&jsNameCache, "", "js-name-cache", "JSON file to load mangled property names from and save them to, keeping them stable across builds")
 	f.AddOpt(&jsMinifier.Precision, "", "js-precision", "Number of significant digits to preserve in numbers, 0 is all")
+	f.AddOpt(&jsMinifier.KeepConstants, "", "js-keep-constants", "Preserve constant expressions instead of evaluating them")
+	f.AddOpt(&jsMinifier.KeepDeadCode, "", "js-keep-dead-code", "Preserve unreachable code and unused declarations")
+	f.AddOpt(KeepNames{&jsMinifier.KeepClassNames}, "", "js-keep-class-names", "Preserve original class names, or those matching a regular expression prefixed by a tilde (eg. ~^[A-Z])")
+	f.AddOpt(KeepNames{&jsMinifier.KeepFnNames}, "", "js-keep-fn-names", "Preserve original function names, or those matching a regular expression prefixed by a tilde (eg. ~^[A-Z])")
 	f.AddOpt(&jsMinifier.KeepVarNames, "", "js-keep-var-names", "Preserve original variable names")
+	f.AddOpt(TemplateTags{&jsMinifier.TemplateTags}, "", "js-template-tags", "Minify the contents of template literals with these tags, as TAG=MIMETYPE or html, svg, and css for their default mimetypes (eg. styled.div=text/css;inline=1)")
+	f.AddOpt(&jsMinifier.Lower, "", "js-lower", "Transform syntax newer than --js-version to older syntax, fails for syntax that cannot be transformed")
 	f.AddOpt(&jsMinifier.Version, "", "js-version", "ECMAScript version to toggle supported optimizations (e.g. 2019, 2020), by default 0 is the latest version")
 	f.AddOpt(&jsonMinifier.Precision, "", "json-precision", "Number of significant digits to preserve in numbers, 0 is all")
 	f.AddOpt(&jsonMinifier.KeepNumbers, "", "json-keep-numbers", "Preserve original numbers instead of minifying them")
+	f.AddOpt(&jsonMinifier.KeepStrings, "", "json-keep-strings", "Preserve original string escapes instead of minifying them")
+	f.AddOpt(&jsonMinifier.ASCIIOnly, "", "json-ascii-only", "Escape all non-ASCII characters in strings")
+	f.AddOpt(&jsonMinifier.Strict, "", "json-strict", "Validate input strictly and fail on invalid JSON")
 	f.AddOpt(&svgMinifier.KeepComments, "", "svg-keep-comments", "Preserve all comments")
 	f.AddOpt(&svgMinifier.Precision, "", "svg-precision", "Number of significant digits to preserve in numbers, 0 is all")
 	f.AddOpt(&svgMinifier.KeepNamespaces, "", "svg-keep-namespaces", "Namespaces to keep, besides xlink")
@@ -323,6 +464,54 @@ func run() int {
 		}
 	}
 
+	switch legalCommentsMode {
+	case "", "inline":
+		legalComments = min.LegalCommentsInline
+	case "none":
+		legalComments = min.LegalCommentsNone
+	case "eof":
+		legalComments = min.LegalCommentsEOF
+	case "external":
+		legalComments = min.LegalCommentsExternal
+	default:
+		Error.Printf("invalid --legal-comments %q, expected none, inline, eof, or external", legalCommentsMode)
+		return 1
+	}
+	cssMinifier.LegalComments = legalComments
+
+	if cssMinifier.Targets, err = css.ParseTargets(cssTargets); err != nil {
+		Error.Println(err)
+		return 1
+	}
+	if cssRenameVars != "" {
+		cssMinifier.RenameVars = css.NewVarNames()
+		if err = loadNames(cssRenameVars, cssMinifier.RenameVars); err != nil {
+			Error.Println(err)
+			return 1
+		}
+	}
+	if 0 < len(cssPurge) {
+		if cssMinifier.Purge, err = loadUsage(cssPurge, cssPurgeSafelist); err != nil {
+			Error.Println(err)
+			return 1
+		}
+	}
+	jsMinifier.LegalComments = legalComments
+
+	if jsMangleProps != "" {
+		if jsMinifier.MangleProps, err = regexp.Compile(jsMangleProps); err != nil {
+			Error.Println(err)
+			return 1
+		}
+	}
+	if jsNameCache != "" {
+		jsMinifier.NameCache = js.NewNameCache()
+		if err = loadNames(jsNameCache, jsMinifier.NameCache); err != nil {
+			Error.Println(err)
+			return 1
+		}
+	}
+
 	// detect mimetype, mimetype=="" means we'll infer mimetype from file extensions
 	if oldmimetype != "" {
 		Error.Printf("deprecated use of '--mime %v', please use '--type %v' instead", oldmimetype, oldmimetype)
@@ -352,10 +541,13 @@ func run() int {
 			Error.Println("--sync doesn't work with stdin and stdout, specify input and output")
 		}
 		return 1
-	} else if useStdin && (bundle || recursive) {
+	} else if useStdin && (bundle || jsBundle || recursive) {
 		if bundle {
 			Error.Println("--bundle doesn't work with stdin, specify input")
 		}
+		if jsBundle {
+			Error.Println("--js-bundle doesn't work with stdin, specify input")
+		}
 		if recursive {
 			Error.Println("--recursive doesn't work with stdin, specify input")
 		}
@@ -443,6 +635,9 @@ func run() int {
 	} else if inplace && bundle {
 		Error.Println("--bundle cannot be used together with --inplace")
 		return 1
+	} else if inplace && jsBundle {
+		Error.Println("--js-bundle cannot be used together with --inplace")
+		return 1
 	}
 	if useStdin {
 		Debug.Println("minify from stdin")
@@ -501,10 +696,19 @@ func run() int {
 	m.Add("text/css", &cssMinifier)
 	m.Add("text/html", &htmlMinifier)
 	m.Add("image/svg+xml", &svgMinifier)
-	m.AddRegexp(regexp.MustCompile("^(application|text)/(x-)?(java|ecma|j|live)script(1\\.[0-5])?$|^module$"), &jsMinifier)
+	m.AddRegexp(regexp.MustCompile("^(application|text)/(x-)?(java|ecma|j|live)script(1\\.[0-5])?$"), &jsMinifier)
 	m.AddRegexp(regexp.MustCompile("[/+]json$"), &jsonMinifier)
 	m.AddRegexp(regexp.MustCompile("[/+]xml$"), &xmlMinifier)
 
+	jsModuleMinifier := jsMinifier
+	jsModuleMinifier.Module = true
+	m.Add("module", &jsModuleMinifier)
+	if jsBundle {
+		jsBundler = &jsModuleMinifier
+	}
+	if bundle {
+		cssBundler = &cssMinifier
+	}
 	m.Add("importmap", &jsonMinifier)
 	m.Add("speculationrules", &jsonMinifier)
 
@@ -604,12 +808,120 @@ func run() int {
 	if !watch {
 		Info.Printf("finished in %v", time.Since(start))
 	}
+	if jsNameCache != "" {
+		if err := saveNames(jsNameCache, jsMinifier.NameCache); err != nil {
+			Error.Println(err)
+			return 1
+		}
+	}
+	if cssRenameVars != "" {
+		if err := saveNames(cssRenameVars, cssMinifier.RenameVars); err != nil {
+			Error.Println(err)
+			return 1
+		}
+	}
 	if 0 < fails {
 		return 1
 	}
 	return 0
 }
 
+// bundleRoot returns the directory from which imports of src are resolved and the path of src relative to it. This is the working directory, or the directory of src if it is outside the working directory.
+func bundleRoot(src string) (string, string, error) {
+	abs, err := filepath.Abs(src)
+	if err != nil {
+		return "", "", err
+	}
+	root := filepath.Dir(abs)
+	if wd, err := os.Getwd(); err == nil {
+		if rel, err := filepath.Rel(wd, abs); err == nil && filepath.IsLocal(rel) {
+			root = wd
+		}
+	}
+	entry, err := filepath.Rel(root, abs)
+	if err != nil {
+		return "", "", err
+	}
+	return root, filepath.ToSlash(entry), nil
+}
+
+// bundleJS bundles the ES module at src and writes the entry point to w. Other chunks are written next to dst.
+func bundleJS(w io.Writer, src, dst string) error {
+	root, entry, err := bundleRoot(src)
+	if err != nil {
+		return err
+	}
+
+	chunks, err := jsBundler.Bundle(os.DirFS(root), entry, jsSplit)
+	if err != nil {
+		return err
+	} else if 1 < len(chunks) && dst == "-" {
+		return fmt.Errorf("--js-split doesn't work with stdout, specify output")
+	}
+	for _, chunk := range chunks[1:] {
+		chunkDst := filepath.Join(filepath.Dir(dst), filepath.FromSlash(chunk.Name))
+		fw, err := openOutputFile(chunkDst)
+		if err != nil {
+			return err
+		}
+		_, err = fw.Write(chunk.Data)
+		if err2 := fw.Close(); err == nil {
+			err = err2
+		}
+		if err != nil {
+			return err
+		}
+		Info.Printf("bundle chunk %v", chunkDst)
+	}
+	_, err = w.Write(chunks[0].Data)
+	return err
+}
+
+// bundleCSS bundles the stylesheets at srcs together with the stylesheets they import and writes them to w. Relative URLs are rewritten for the output file at dst.
+func bundleCSS(w io.Writer, srcs []string, dst string) error {
+	paths := slices.Clone(srcs)
+	if dst != "-" {
+		paths = append(paths, dst)
+	}
+	root, _, err := bundleRoot(srcs[0])
+	if err != nil {
+		return err
+	}
+	for i, filename := range paths {
+		abs, err := filepath.Abs(filename)
+		if err != nil {
+			return err
+		}
+		for {
+			if rel, err := filepath.Rel(root, abs); err == nil && filepath.IsLocal(rel) {
+				break
+			} else if root == filepath.Dir(root) {
+				return fmt.Errorf("%v: not on the same volume as %v", filename, srcs[0])
+			}
+			root = filepath.Dir(root)
+		}
+		paths[i] = abs
+	}
+
+	entries := make([]string, len(srcs))
+	for i := range srcs {
+		entry, err := filepath.Rel(root, paths[i])
+		if err != nil {
+			return err
+		}
+		entries[i] = filepath.ToSlash(entry)
+	}
+	output := ""
+	if dst != "-" {
+		rel, err := filepath.Rel(root, paths[len(paths)-1])
+		if err != nil {
+			return err
+		}
+		output = filepath.ToSlash(rel)
+	}
+	return cssBundler.Bundle(m, w, os.DirFS(root), output, entries...)
+}
+
 func minifyWorker(chanTasks <-chan Task, chanFails chan<- int) {
 	fails := 0
 	for task := range chanTasks {
@@ -620,6 +932,69 @@ func minifyWorker(chanTasks <-chan Task, chanFails chan<- int) {
 	chanFails <- fails
 }
 
+// loadNames loads mangled or renamed names from a JSON file into v, the file doesn't need to exist.
+func loadNames(filename string, v any) error {
+	b, err := os.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	} else if err := stdJSON.Unmarshal(b, v); err != nil {
+		return fmt.Errorf("name cache %v: %w", filename, err)
+	}
+	return nil
+}
+
+// loadUsage collects the names used by the content files matching the patterns for --css-purge. HTML and SVG files are parsed, and other files are scanned for words.
+func loadUsage(patterns, safelist []string) (*css.Usage, error) {
+	usage := css.NewUsage()
+	for _, name := range safelist {
+		if strings.HasPrefix(name, "~") {
+			re, err := regexp.Compile(name[1:])
+			if err != nil {
+				return nil, err
+			}
+			usage.SafelistRegexps = append(usage.SafelistRegexps, re)
+		} else {
+			usage.Safelist = append(usage.Safelist, name)
+		}
+	}
+	for _, pattern := range patterns {
+		filenames, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, err
+		} else if len(filenames) == 0 {
+			return nil, fmt.Errorf("css purge %v: no such file", pattern)
+		}
+		for _, filename := range filenames {
+			f, err := os.Open(filename)
+			if err != nil {
+				return nil, err
+			}
+			switch strings.ToLower(filepath.Ext(filename)) {
+			case ".html", ".htm", ".xhtml", ".svg":
+				err = usage.AddHTML(f)
+			default:
+				err = usage.AddText(f)
+			}
+			f.Close()
+			if err != nil {
+				return nil, fmt.Errorf("css purge %v: %w", filename, err)
+			}
+		}
+	}
+	return usage, nil
+}
+
+// saveNames saves mangled or renamed names to a JSON file.
+func saveNames(filename string, v any) error {
+	b, err := stdJSON.MarshalIndent(v, "", "\t")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filename, append(b, '\n'), 0644)
+}
+
 // compilePattern returns *regexp.Regexp or glob.Glob
 func compilePattern(pattern string) (*regexp.Regexp, error) {
 	if len(pattern) == 0 || pattern[0] != '~' {
@@ -794,6 +1169,31 @@ func createTasks(fsys fs.FS, inputs []string, output string) ([]Task, []string,
 	return tasks, roots, nil
 }
 
+// legalCommentsBuffer is the output buffer that receives the legal comments which are extracted by the CSS and JS minifiers.
+type legalCommentsBuffer struct {
+	*bytes.Buffer
+	name     string
+	comments []byte
+}
+
+func (w *legalCommentsBuffer) WriteLegalComments(b []byte) (string, error) {
+	w.comments = append(w.comments, b...)
+	return w.name, nil
+}
+
+// writeLegalComments writes the extracted legal comments to the file next to the output file.
+func writeLegalComments(filename string, comments []byte) error {
+	fw, err := openOutputFile(filename)
+	if err != nil {
+		return err
+	}
+	if _, err := fw.Write(comments); err != nil {
+		fw.Close()
+		return err
+	}
+	return fw.Close()
+}
+
 func minify(t Task) bool {
 	// synchronizing files that are not minified but just copied to the same directory, no action needed
 	if t.sync {
@@ -865,7 +1265,7 @@ func minify(t Task) bool {
 		fr, err = openInputFile(srcs[0])
 	} else {
 		var sep []byte
-		if err == nil && fileMimetype == extMap["js"] {
+		if err == nil && (fileMimetype == extMap["js"] || fileMimetype == extMap["mjs"]) {
 			sep = []byte(";\n")
 		}
 		fr, err = openInputFiles(srcs, sep)
@@ -907,7 +1307,42 @@ func minify(t Task) bool {
 
 	success := true
 	startTime := time.Now()
-	if err = m.Minify(fileMimetype, w, bytes.NewReader(b)); err != nil {
+	if jsBundler != nil && (fileMimetype == extMap["js"] || fileMimetype == extMap["mjs"]) {
+		if len(srcs) != 1 {
+			err = fmt.Errorf("--js-bundle requires a single entry point")
+		} else if err = bundleJS(w, srcs[0], t.dst); err != nil {
+			err = fmt.Errorf("bundle: %w", err)
+		}
+		if err != nil {
+			w = bytes.NewBuffer(b) // copy original
+			Error.Printf("cannot minify %v: %v", srcName, err)
+			success = false
+		}
+	} else if cssBundler != nil && fileMimetype == extMap["css"] {
+		if legalComments == min.LegalCommentsExternal && t.dst != "-" {
+			lw := &legalCommentsBuffer{Buffer: w, name: filepath.Base(t.dst) + ".LICENSE.txt"}
+			if err = bundleCSS(lw, srcs, t.dst); err == nil && 0 < len(lw.comments) {
+				err = writeLegalComments(t.dst+".LICENSE.txt", lw.comments)
+			}
+		} else {
+			err = bundleCSS(w, srcs, t.dst)
+		}
+		if err != nil {
+			w = bytes.NewBuffer(b) // copy original
+			Error.Printf("cannot minify %v: bundle: %v", srcName, err)
+			success = false
+		}
+	} else if legalComments == min.LegalCommentsExternal && t.dst != "-" {
+		lw := &legalCommentsBuffer{Buffer: w, name: filepath.Base(t.dst) + ".LICENSE.txt"}
+		if err = m.Minify(fileMimetype, lw, bytes.NewReader(b)); err == nil && 0 < len(lw.comments) {
+			err = writeLegalComments(t.dst+".LICENSE.txt", lw.comments)
+		}
+		if err != nil {
+			w = bytes.NewBuffer(b) // copy original
+			Error.Printf("cannot minify %v: %v", srcName, err)
+			success = false
+		}
+	} else if err = m.Minify(fileMimetype, w, bytes.NewReader(b)); err != nil {
 		w = bytes.NewBuffer(b) // copy original
 		Error.Printf("cannot minify %v: %v", srcName, err)
 		success = false
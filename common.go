@@ -3,6 +3,7 @@ package minify
 import (
 	"bytes"
 	"encoding/base64"
+	"io"
 
 	"github.com/tdewolff/parse/v2"
 	"github.com/tdewolff/parse/v2/strconv"
@@ -13,6 +14,8 @@ var (
 	charsetASCIIBytes = []byte("charset=us-ascii")
 	dataBytes         = []byte("data:")
 	base64Bytes       = []byte(";base64")
+	licenseBytes      = []byte("@license")
+	preserveBytes     = []byte("@preserve")
 )
 
 // Epsilon is the closest number to zero that is not considered to be zero.
@@ -94,6 +97,18 @@ func DataURI(m *M, dataURI []byte) []byte {
 	return append(append(append(dataBytes, mediatype...), ','), data...)
 }
 
+// RewriteURL returns the URL as rewritten by m.RewriteURL for a document of the given mediatype. URLs are returned unchanged when m.RewriteURL is nil, and for data URIs and fragment-only URLs.
+func RewriteURL(m *M, mediatype string, url []byte) ([]byte, error) {
+	if m == nil || m.RewriteURL == nil || len(url) == 0 || url[0] == '#' || 5 <= len(url) && parse.EqualFold(url[:5], dataBytes) {
+		return url, nil
+	}
+	rewritten, err := m.RewriteURL(mediatype, string(url))
+	if err != nil {
+		return url, err
+	}
+	return []byte(rewritten), nil
+}
+
 // MaxInt is the maximum value of int.
 const MaxInt = int(^uint(0) >> 1)
 
@@ -521,3 +536,60 @@ func UpdateErrorPosition(err error, input *parse.Input, offset int) error {
 	}
 	return err
 }
+
+// LegalComments specifies what minifiers do with legal comments, which are comments that start with /*! or //!, or that contain @license or @preserve.
+type LegalComments int
+
+// LegalComments modes.
+const (
+	LegalCommentsInline   LegalComments = iota // keep legal comments where they are
+	LegalCommentsNone                          // remove legal comments
+	LegalCommentsEOF                           // move legal comments to the end of the output
+	LegalCommentsExternal                      // extract legal comments to a LegalCommentsWriter, and write a comment that points to them
+)
+
+// LegalCommentsWriter is implemented by writers that accept legal comments which are extracted with LegalCommentsExternal. It returns the name of the file the comments are written to, which is used for the pointer comment.
+type LegalCommentsWriter interface {
+	io.Writer
+	WriteLegalComments([]byte) (string, error)
+}
+
+// IsLegalComment returns true if the comment (including its delimiters) starts with /*! or //!, or contains @license or @preserve.
+func IsLegalComment(comment []byte) bool {
+	return 2 < len(comment) && comment[2] == '!' || bytes.Contains(comment, licenseBytes) || bytes.Contains(comment, preserveBytes)
+}
+
+// WriteLegalComments writes the legal comments that were collected for LegalCommentsEOF or LegalCommentsExternal, without duplicates. For the latter, the comments are written to w if it implements LegalCommentsWriter, together with a comment that points to them, and otherwise they are written at the end of the output as for LegalCommentsEOF.
+func WriteLegalComments(w io.Writer, mode LegalComments, comments [][]byte) error {
+	if len(comments) == 0 {
+		return nil
+	}
+
+	// remove duplicates, such as the same license in bundled files
+	unique := comments[:0:0]
+	seen := map[string]bool{}
+	for _, comment := range comments {
+		if !seen[string(comment)] {
+			unique = append(unique, comment)
+			seen[string(comment)] = true
+		}
+	}
+	comments = unique
+
+	if lw, ok := w.(LegalCommentsWriter); ok && mode == LegalCommentsExternal {
+		name, err := lw.WriteLegalComments(append(bytes.Join(comments, []byte("\n")), '\n'))
+		if err != nil {
+			return err
+		}
+		_, err = io.WriteString(w, "\n/*! For license information please see "+name+" */")
+		return err
+	}
+	for _, comment := range comments {
+		if _, err := w.Write([]byte("\n")); err != nil {
+			return err
+		} else if _, err := w.Write(comment); err != nil {
+			return err
+		}
+	}
+	return nil
+}
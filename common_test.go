@@ -67,6 +67,34 @@ func TestDataURI(t *testing.T) {
 	}
 }
 
+func TestRewriteURL(t *testing.T) {
+	urlTests := []struct {
+		url      string
+		expected string
+	}{
+		{"a.png", "/static/a.png"},
+		{"", ""},
+		{"#id", "#id"},
+		{"data:,text", "data:,text"},
+		{"DATA:,text", "DATA:,text"},
+	}
+	m := New()
+	url, err := RewriteURL(m, "text/css", []byte("a.png"))
+	test.Error(t, err)
+	test.String(t, string(url), "a.png")
+
+	m.RewriteURL = func(mediatype, url string) (string, error) {
+		test.String(t, mediatype, "text/css")
+		return "/static/" + url, nil
+	}
+	for _, tt := range urlTests {
+		t.Run(tt.url, func(t *testing.T) {
+			url, err := RewriteURL(m, "text/css", []byte(tt.url))
+			test.Minify(t, tt.url, err, string(url), tt.expected)
+		})
+	}
+}
+
 func TestDecimal(t *testing.T) {
 	numberTests := []struct {
 		number   string
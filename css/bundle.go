@@ -0,0 +1,331 @@
+package css
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+
+	"github.com/tdewolff/minify/v2"
+	"github.com/tdewolff/parse/v2"
+	"github.com/tdewolff/parse/v2/css"
+)
+
+type cssBundler struct {
+	fsys    fs.FS
+	root    string          // directory of the output file, to which relative URLs are rewritten
+	charset []byte          // @charset rule of the first entry point
+	imports [][]byte        // imports of external stylesheets, hoisted to the top
+	inlined bool            // whether rules have been written, before which external imports cannot be hoisted
+	loading map[string]bool // stylesheets that are being inlined, to detect cycles
+}
+
+// Bundle minifies the stylesheets at the entry paths of fsys together with all stylesheets they import using relative URLs, and writes the result to w. Imported stylesheets are inlined recursively and wrapped in @media, @supports, and @layer rules according to the conditions of their import, and relative URLs are rewritten to be relative to the output path, or to the first entry point if output is empty. Imports of other stylesheets, such as absolute URLs, are moved to the top, which returns an error if they would move before inlined rules. Imports that form a cycle are removed, as browsers ignore them.
+func (o *Minifier) Bundle(m *minify.M, w io.Writer, fsys fs.FS, output string, entries ...string) error {
+	if len(entries) == 0 {
+		return fmt.Errorf("no entry point")
+	} else if output == "" {
+		output = entries[0]
+	}
+	b := &cssBundler{
+		fsys:    fsys,
+		root:    path.Dir(path.Clean(output)),
+		loading: map[string]bool{},
+	}
+	body := &bytes.Buffer{}
+	for i, entry := range entries {
+		if err := b.inline(body, path.Clean(entry), i == 0, false); err != nil {
+			return err
+		}
+	}
+
+	buf := &bytes.Buffer{}
+	buf.Write(b.charset)
+	for _, imp := range b.imports {
+		buf.Write(imp)
+	}
+	buf.Write(body.Bytes())
+	return o.Minify(m, w, buf, nil)
+}
+
+// bundleImport is an @import rule with its URL and conditions.
+type bundleImport struct {
+	url      string
+	layer    []byte // nil without layer, empty for an anonymous layer
+	supports []byte
+	media    []byte
+}
+
+// inline writes the stylesheet at filename to w, where its imports of relative URLs are replaced by the imported stylesheets. Conditional is set if the stylesheet is imported with conditions.
+func (b *cssBundler) inline(w *bytes.Buffer, filename string, entry, conditional bool) error {
+	src, err := fs.ReadFile(b.fsys, filename)
+	if err != nil {
+		return err
+	}
+	b.loading[filename] = true
+	defer delete(b.loading, filename)
+
+	z := parse.NewInputBytes(src)
+	defer z.Restore()
+	l := css.NewLexer(z)
+
+	dir := path.Dir(filename)
+	header := true          // @charset, @layer statements, and @import rules are only allowed before other rules
+	level, imageSet := 0, 0 // level of parentheses, and the level of the image-set() function
+	defer func() {
+		b.inlined = b.inlined || !header
+	}()
+	for {
+		tt, data := l.Next()
+		switch tt {
+		case css.ErrorToken:
+			if l.Err() != io.EOF {
+				return fmt.Errorf("%s: %w", filename, l.Err())
+			}
+			return nil
+		case css.WhitespaceToken, css.CommentToken:
+			w.Write(data)
+			continue
+		case css.AtKeywordToken:
+			if !header {
+				break
+			}
+			name := parse.ToLower(parse.Copy(data[1:]))
+			if ToHash(name) != Import && ToHash(name) != Charset && !bytes.Equal(name, []byte("layer")) {
+				break
+			}
+
+			tokens := []css.Token{}
+			for tt, data = l.Next(); tt != css.ErrorToken && tt != css.SemicolonToken && tt != css.LeftBraceToken; tt, data = l.Next() {
+				tokens = append(tokens, css.Token{TokenType: tt, Data: data})
+			}
+			if tt == css.LeftBraceToken {
+				// @layer block
+				header = false
+				w.WriteString("@layer")
+				w.Write(tokensBytes(tokens))
+				w.WriteByte('{')
+				continue
+			} else if ToHash(name) == Charset {
+				if entry {
+					b.charset = append(append([]byte("@charset"), tokensBytes(tokens)...), ';')
+				}
+				continue
+			} else if ToHash(name) != Import {
+				b.inlined = true
+				w.WriteString("@layer")
+				w.Write(tokensBytes(tokens))
+				w.WriteByte(';')
+				continue
+			}
+
+			imp, ok := parseImport(tokens)
+			if !ok {
+				return fmt.Errorf("%s: invalid @import", filename)
+			} else if !isRelativeURL(imp.url) {
+				if conditional {
+					return fmt.Errorf("%s: cannot move import of %s out of the conditions of its stylesheet", filename, imp.url)
+				} else if b.inlined {
+					return fmt.Errorf("%s: cannot move import of %s before the rules of preceding stylesheets", filename, imp.url)
+				}
+				b.imports = append(b.imports, append(append([]byte("@import"), tokensBytes(tokens)...), ';'))
+				continue
+			}
+
+			imported := path.Join(dir, imp.url)
+			if b.loading[imported] {
+				continue // cycle
+			} else if _, err := fs.Stat(b.fsys, imported); err != nil {
+				return fmt.Errorf("%s: cannot resolve %s", filename, imp.url)
+			}
+			open := 0
+			if imp.media != nil {
+				w.WriteString("@media ")
+				w.Write(imp.media)
+				w.WriteByte('{')
+				open++
+			}
+			if imp.supports != nil {
+				w.WriteString("@supports ")
+				w.Write(imp.supports)
+				w.WriteByte('{')
+				open++
+			}
+			if imp.layer != nil {
+				w.WriteString("@layer")
+				if 0 < len(imp.layer) {
+					w.WriteByte(' ')
+					w.Write(imp.layer)
+				}
+				w.WriteByte('{')
+				open++
+			}
+			if err := b.inline(w, imported, false, conditional || 0 < open); err != nil {
+				return err
+			}
+			w.WriteString(strings.Repeat("}", open))
+			continue
+		case css.URLToken:
+			w.Write(b.rewriteURL(data, dir))
+			continue
+		case css.FunctionToken:
+			level++
+			if name := parse.ToLower(parse.Copy(data)); imageSet == 0 && (bytes.Equal(name, []byte("image-set(")) || bytes.Equal(name, []byte("-webkit-image-set("))) {
+				imageSet = level
+			}
+		case css.LeftParenthesisToken:
+			level++
+		case css.RightParenthesisToken:
+			if level == imageSet {
+				imageSet = 0
+			}
+			level--
+		case css.StringToken:
+			if imageSet != 0 && level == imageSet {
+				// image-set("a.png" 1x)
+				header = false
+				w.Write(b.rewriteString(data, dir))
+				continue
+			}
+		}
+		header = false
+		w.Write(data)
+	}
+}
+
+// parseImport parses the URL and conditions of an @import rule.
+func parseImport(tokens []css.Token) (bundleImport, bool) {
+	imp := bundleImport{}
+	i := 0
+	for i < len(tokens) && (tokens[i].TokenType == css.WhitespaceToken || tokens[i].TokenType == css.CommentToken) {
+		i++
+	}
+	if len(tokens) <= i {
+		return imp, false
+	} else if tokens[i].TokenType == css.StringToken {
+		imp.url = string(tokens[i].Data[1 : len(tokens[i].Data)-1])
+	} else if tokens[i].TokenType == css.URLToken {
+		imp.url = string(urlValue(tokens[i].Data))
+	} else {
+		return imp, false
+	}
+	i++
+
+	for i < len(tokens) && tokens[i].TokenType == css.WhitespaceToken {
+		i++
+	}
+	if i < len(tokens) && tokens[i].TokenType == css.IdentToken && parse.EqualFold(tokens[i].Data, []byte("layer")) {
+		imp.layer = []byte{}
+		i++
+	} else if i < len(tokens) && tokens[i].TokenType == css.FunctionToken && parse.EqualFold(tokens[i].Data, []byte("layer(")) {
+		j := matchingParenthesis(tokens, i)
+		imp.layer = parse.TrimWhitespace(tokensBytes(tokens[i+1 : j]))
+		i = j + 1
+	}
+
+	for i < len(tokens) && tokens[i].TokenType == css.WhitespaceToken {
+		i++
+	}
+	if i < len(tokens) && tokens[i].TokenType == css.FunctionToken && parse.EqualFold(tokens[i].Data, []byte("supports(")) {
+		j := matchingParenthesis(tokens, i)
+		cond := parse.TrimWhitespace(tokensBytes(tokens[i+1 : j]))
+		if k := i + 1; k < j && tokens[k].TokenType == css.IdentToken && k+1 < j && tokens[k+1].TokenType == css.ColonToken || k+2 < j && tokens[k].TokenType == css.IdentToken && tokens[k+1].TokenType == css.WhitespaceToken && tokens[k+2].TokenType == css.ColonToken {
+			cond = append(append([]byte{'('}, cond...), ')') // supports(display:grid)  =>  @supports (display:grid)
+		}
+		imp.supports = cond
+		i = j + 1
+	}
+
+	if media := parse.TrimWhitespace(tokensBytes(tokens[min(i, len(tokens)):])); 0 < len(media) {
+		imp.media = media
+	}
+	return imp, true
+}
+
+// matchingParenthesis returns the index of the parenthesis that closes the function at i.
+func matchingParenthesis(tokens []css.Token, i int) int {
+	level := 0
+	for ; i < len(tokens); i++ {
+		switch tokens[i].TokenType {
+		case css.FunctionToken, css.LeftParenthesisToken:
+			level++
+		case css.RightParenthesisToken:
+			level--
+			if level == 0 {
+				return i
+			}
+		}
+	}
+	return len(tokens)
+}
+
+// urlValue returns the URL of a url() token without quotes.
+func urlValue(data []byte) []byte {
+	uri := parse.TrimWhitespace(data[4 : len(data)-1])
+	if 1 < len(uri) && (uri[0] == '"' || uri[0] == '\'') {
+		uri = uri[1 : len(uri)-1]
+	}
+	return uri
+}
+
+// isRelativeURL returns true for URLs that are relative paths.
+func isRelativeURL(uri string) bool {
+	if uri == "" || uri[0] == '/' || uri[0] == '#' || uri[0] == '?' {
+		return false
+	}
+	for i := 0; i < len(uri); i++ {
+		if c := uri[i]; c == ':' {
+			return false // scheme, such as https: or data:
+		} else if c == '/' || c == '?' || c == '#' {
+			break
+		}
+	}
+	return true
+}
+
+// rewriteURL rewrites a relative url() reference in a stylesheet in dir to be relative to the output file.
+func (b *cssBundler) rewriteURL(data []byte, dir string) []byte {
+	uri := string(urlValue(data))
+	if dir == b.root || !isRelativeURL(uri) {
+		return data
+	}
+	rel := b.relativeURL(uri, dir)
+	return []byte("url(\"" + strings.ReplaceAll(rel, "\"", "\\\"") + "\")")
+}
+
+// rewriteString rewrites a relative URL in a string, such as in image-set(), in a stylesheet in dir to be relative to the output file.
+func (b *cssBundler) rewriteString(data []byte, dir string) []byte {
+	uri := string(data[1 : len(data)-1])
+	if dir == b.root || !isRelativeURL(uri) || strings.IndexByte(uri, '\\') != -1 {
+		return data
+	}
+	rel := b.relativeURL(uri, dir)
+	return []byte(string(data[0]) + strings.ReplaceAll(rel, string(data[0]), "\\"+string(data[0])) + string(data[0]))
+}
+
+// relativeURL returns the relative URL in a stylesheet in dir relative to the output file, keeping its query and fragment.
+func (b *cssBundler) relativeURL(uri, dir string) string {
+	suffix := ""
+	if i := strings.IndexAny(uri, "?#"); i != -1 {
+		uri, suffix = uri[:i], uri[i:]
+	}
+	return relativePath(b.root, path.Join(dir, uri)) + suffix
+}
+
+// relativePath returns the path of target relative to the directory dir, where both are relative to the same root.
+func relativePath(dir, target string) string {
+	var dirs, targets []string
+	if dir != "." {
+		dirs = strings.Split(dir, "/")
+	}
+	if target != "." {
+		targets = strings.Split(target, "/")
+	}
+	i := 0
+	for i < len(dirs) && i < len(targets)-1 && dirs[i] == targets[i] {
+		i++
+	}
+	return strings.Repeat("../", len(dirs)-i) + strings.Join(targets[i:], "/")
+}
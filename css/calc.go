@@ -0,0 +1,360 @@
+package css
+
+import (
+	"math"
+	"strconv"
+
+	"github.com/tdewolff/minify/v2"
+	"github.com/tdewolff/parse/v2"
+	"github.com/tdewolff/parse/v2/css"
+)
+
+// calcTerm is a term of a sum in a math function. It is either numeric, with its value and lowercase unit ("" for numbers and "%" for percentages), or an expression that cannot be evaluated.
+type calcTerm struct {
+	neg     bool
+	numeric bool
+	value   float64
+	unit    string
+	data    []byte  // original data of a numeric term that was not changed
+	tokens  []Token // tokens of a term that is not numeric
+}
+
+// unitClass returns the class of units that may be replaced by each other when the term is zero.
+func (t calcTerm) unitClass() string {
+	if t.unit == "" || t.unit == "%" {
+		return t.unit
+	}
+	return "length"
+}
+
+// isMathFunction returns true for functions whose arguments are calculations.
+func isMathFunction(fun Hash) bool {
+	return fun == Calc || fun == Min || fun == Max || fun == Clamp
+}
+
+// minifyCalc simplifies calc(), min(), max(), and clamp() by folding arithmetic with the same units, removing redundant parentheses and zero terms, and choosing between comparable constants. The result is unwrapped if it is a single value and the parent function is a math function, or if unwrapping does not change the value, which is clamped to the allowed range of the property for math functions but is invalid otherwise.
+func (c *cssMinifier) minifyCalc(t Token, parent Hash) Token {
+	if t.Fun == Calc {
+		terms, ok := c.parseCalcSum(t.Args)
+		if !ok {
+			return t
+		}
+		if 1 < len(terms) && terms[0].neg && !terms[0].numeric {
+			// calc(0px - var(--x))  =>  calc(-1*var(--x)) is longer, so keep the zero term
+			return t
+		}
+		if len(terms) == 1 && terms[0].numeric && canUnwrapCalc(terms[0], parent) {
+			return c.calcTermToken(terms[0])
+		}
+		t.Args = c.calcSumTokens(terms)
+		return t
+	}
+
+	// min(), max(), and clamp()
+	args := [][]calcTerm{}
+	start := 0
+	for i := 0; i <= len(t.Args); i++ {
+		if i == len(t.Args) || t.Args[i].TokenType == css.CommaToken {
+			terms, ok := c.parseCalcSum(t.Args[start:i])
+			if !ok || 1 < len(terms) && terms[0].neg && !terms[0].numeric {
+				return t
+			}
+			args = append(args, terms)
+			start = i + 1
+		}
+	}
+
+	if t.Fun == Clamp {
+		if len(args) != 3 {
+			return t
+		} else if comparableCalcTerms(args) {
+			// clamp(a,b,c) = max(a,min(b,c))
+			v := math.Max(calcValue(args[0][0]), math.Min(calcValue(args[1][0]), calcValue(args[2][0])))
+			args = [][]calcTerm{{{numeric: true, value: v, unit: args[0][0].unit}}}
+		}
+	} else {
+		// remove constants that are larger (for min) or smaller (for max) than another constant with the same unit
+		for i := 0; i < len(args); i++ {
+			if len(args[i]) != 1 || !args[i][0].numeric {
+				continue
+			}
+			for j := i + 1; j < len(args); j++ {
+				if len(args[j]) != 1 || !args[j][0].numeric || args[j][0].unit != args[i][0].unit {
+					continue
+				}
+				vi, vj := calcValue(args[i][0]), calcValue(args[j][0])
+				if t.Fun == Min && vj < vi || t.Fun == Max && vi < vj {
+					args[i] = args[j]
+				}
+				args = append(args[:j], args[j+1:]...)
+				j--
+			}
+		}
+	}
+
+	if len(args) == 1 && len(args[0]) == 1 && args[0][0].numeric && canUnwrapCalc(args[0][0], parent) {
+		return c.calcTermToken(args[0][0])
+	}
+	argTokens := []Token{}
+	for i, terms := range args {
+		if i != 0 {
+			argTokens = append(argTokens, Token{css.CommaToken, commaBytes, nil, 0, 0})
+		}
+		argTokens = append(argTokens, c.calcSumTokens(terms)...)
+	}
+	t.Args = argTokens
+	return t
+}
+
+// canUnwrapCalc returns true if the result of a math function can be written as a single value. Negative values and non-integer numbers are clamped and rounded for math functions, but not for values.
+func canUnwrapCalc(term calcTerm, parent Hash) bool {
+	if isMathFunction(parent) {
+		return true
+	}
+	v := calcValue(term)
+	return 0.0 <= v && (term.unit != "" || v == math.Trunc(v))
+}
+
+// comparableCalcTerms returns true if all arguments are single numeric terms with the same unit.
+func comparableCalcTerms(args [][]calcTerm) bool {
+	for _, terms := range args {
+		if len(terms) != 1 || !terms[0].numeric || terms[0].unit != args[0][0].unit {
+			return false
+		}
+	}
+	return true
+}
+
+func calcValue(term calcTerm) float64 {
+	if term.neg {
+		return -term.value
+	}
+	return term.value
+}
+
+// parseCalcSum parses and simplifies a sum of products, where nested sums in parentheses or calc() are flattened.
+func (c *cssMinifier) parseCalcSum(tokens []Token) ([]calcTerm, bool) {
+	terms := []calcTerm{}
+	neg := false
+	start, level := 0, 0
+	for i := 0; i <= len(tokens); i++ {
+		if i < len(tokens) {
+			if tt := tokens[i].TokenType; tt == css.LeftParenthesisToken {
+				level++
+				continue
+			} else if tt == css.RightParenthesisToken {
+				level--
+				continue
+			} else if level != 0 || tt != css.DelimToken || tokens[i].Data[0] != '+' && tokens[i].Data[0] != '-' {
+				continue
+			} else if i == 0 || tokens[i-1].TokenType != css.WhitespaceToken || i+1 == len(tokens) || tokens[i+1].TokenType != css.WhitespaceToken {
+				return nil, false // + and - must be surrounded by whitespace
+			}
+		}
+
+		product, ok := c.parseCalcProduct(trimWhitespaceTokens(tokens[start:i]))
+		if !ok {
+			return nil, false
+		}
+		for _, term := range product {
+			term.neg = term.neg != neg
+			terms = append(terms, term)
+		}
+		if i < len(tokens) {
+			neg = tokens[i].Data[0] == '-'
+			start = i + 1
+		}
+	}
+
+	// add numeric terms with the same unit
+	for i := 0; i < len(terms); i++ {
+		if !terms[i].numeric {
+			continue
+		}
+		for j := i + 1; j < len(terms); j++ {
+			if terms[j].numeric && terms[j].unit == terms[i].unit {
+				v := calcValue(terms[i]) + calcValue(terms[j])
+				terms[i] = calcTerm{neg: v < 0.0, numeric: true, value: math.Abs(v), unit: terms[i].unit}
+				terms = append(terms[:j], terms[j+1:]...)
+				j--
+			}
+		}
+	}
+
+	// remove zero terms if a term with the same kind of unit remains
+	for i := 0; i < len(terms) && 1 < len(terms); i++ {
+		if !terms[i].numeric || terms[i].value != 0.0 {
+			continue
+		}
+		for j := range terms {
+			if j != i && terms[j].numeric && terms[j].value != 0.0 && terms[j].unitClass() == terms[i].unitClass() {
+				terms = append(terms[:i], terms[i+1:]...)
+				i--
+				break
+			}
+		}
+	}
+	return terms, 0 < len(terms)
+}
+
+// parseCalcProduct parses and simplifies a product. It returns multiple terms when the product is a single sum in parentheses.
+func (c *cssMinifier) parseCalcProduct(tokens []Token) ([]calcTerm, bool) {
+	if len(tokens) == 0 {
+		return nil, false
+	}
+
+	factors := [][]calcTerm{}
+	ops := []byte{}
+	start, level := 0, 0
+	for i := 0; i <= len(tokens); i++ {
+		if i < len(tokens) {
+			if tt := tokens[i].TokenType; tt == css.LeftParenthesisToken {
+				level++
+				continue
+			} else if tt == css.RightParenthesisToken {
+				level--
+				continue
+			} else if level != 0 || tt != css.DelimToken || tokens[i].Data[0] != '*' && tokens[i].Data[0] != '/' {
+				continue
+			}
+			ops = append(ops, tokens[i].Data[0])
+		}
+
+		factor := trimWhitespaceTokens(tokens[start:i])
+		if len(factor) == 0 {
+			return nil, false
+		}
+		var terms []calcTerm
+		if 2 < len(factor) && factor[0].TokenType == css.LeftParenthesisToken && factor[len(factor)-1].TokenType == css.RightParenthesisToken {
+			var ok bool
+			if terms, ok = c.parseCalcSum(factor[1 : len(factor)-1]); !ok {
+				return nil, false
+			}
+		} else if len(factor) == 1 && factor[0].TokenType == css.FunctionToken && factor[0].Fun == Calc {
+			var ok bool
+			if terms, ok = c.parseCalcSum(factor[0].Args); !ok {
+				return nil, false
+			}
+		} else if len(factor) == 1 && (factor[0].TokenType == css.NumberToken || factor[0].TokenType == css.PercentageToken || factor[0].TokenType == css.DimensionToken) {
+			n := parse.Number(factor[0].Data)
+			if n == 0 {
+				return nil, false
+			}
+			v, ok := parseFloat(factor[0].Data[:n])
+			if !ok || !isCalcUnit(factor[0].Data[n:]) {
+				return nil, false
+			}
+			terms = []calcTerm{{neg: v < 0.0, numeric: true, value: math.Abs(v), unit: string(parse.ToLower(parse.Copy(factor[0].Data[n:]))), data: factor[0].Data}}
+		} else {
+			terms = []calcTerm{{tokens: factor}}
+		}
+		factors = append(factors, terms)
+		start = i + 1
+	}
+	if len(factors) == 1 {
+		return factors[0], true
+	}
+
+	// fold numeric factors, where only numbers can multiply or divide other values
+	numeric := true
+	for _, factor := range factors {
+		if len(factor) != 1 || !factor[0].numeric {
+			numeric = false
+			break
+		}
+	}
+	if numeric {
+		term := factors[0][0]
+		v := calcValue(term)
+		for i, op := range ops {
+			factor := factors[i+1][0]
+			if op == '*' && term.unit != "" && factor.unit != "" || op == '/' && (factor.unit != "" || factor.value == 0.0) {
+				return nil, false // invalid or unsupported
+			} else if op == '*' {
+				v *= calcValue(factor)
+				if term.unit == "" {
+					term.unit = factor.unit
+				}
+			} else {
+				v /= calcValue(factor)
+			}
+		}
+		return []calcTerm{{neg: v < 0.0, numeric: true, value: math.Abs(v), unit: term.unit}}, true
+	}
+
+	// keep the product but write its factors simplified
+	product := []Token{}
+	for i, factor := range factors {
+		if i != 0 {
+			product = append(product, Token{css.DelimToken, []byte{ops[i-1]}, nil, 0, 0})
+		}
+		if len(factor) == 1 {
+			product = append(product, c.calcTermTokens(factor[0])...)
+		} else {
+			product = append(product, Token{css.LeftParenthesisToken, []byte("("), nil, 0, 0})
+			product = append(product, c.calcSumTokens(factor)...)
+			product = append(product, Token{css.RightParenthesisToken, []byte(")"), nil, 0, 0})
+		}
+	}
+	return []calcTerm{{tokens: product}}, true
+}
+
+// calcSumTokens returns the tokens of a sum, where + and - are surrounded by whitespace.
+func (c *cssMinifier) calcSumTokens(terms []calcTerm) []Token {
+	tokens := []Token{}
+	for i, term := range terms {
+		if i != 0 {
+			op := []byte("+")
+			if term.neg {
+				op = []byte("-")
+			}
+			tokens = append(tokens, Token{css.WhitespaceToken, spaceBytes, nil, 0, 0}, Token{css.DelimToken, op, nil, 0, 0}, Token{css.WhitespaceToken, spaceBytes, nil, 0, 0})
+			term.neg = false
+		}
+		tokens = append(tokens, c.calcTermTokens(term)...)
+	}
+	return tokens
+}
+
+func (c *cssMinifier) calcTermTokens(term calcTerm) []Token {
+	if !term.numeric {
+		return term.tokens
+	}
+	return []Token{c.calcTermToken(term)}
+}
+
+// calcTermToken returns the number, percentage, or dimension token of a numeric term.
+func (c *cssMinifier) calcTermToken(term calcTerm) Token {
+	tt := css.DimensionToken
+	if term.unit == "" {
+		tt = css.NumberToken
+	} else if term.unit == "%" {
+		tt = css.PercentageToken
+	}
+	if term.data != nil && (term.data[0] == '-') == term.neg {
+		return Token{tt, term.data, nil, 0, 0}
+	}
+
+	v := calcValue(term)
+	v = math.Round(v*1e10) / 1e10 // remove floating-point errors
+	num := []byte(strconv.FormatFloat(v, 'f', -1, 64))
+	if c.o.Version <= 2 {
+		num = minify.Decimal(num, c.o.Precision)
+	} else {
+		num = minify.Number(num, c.o.Precision)
+	}
+	return Token{tt, append(num, term.unit...), nil, 0, 0}
+}
+
+// isCalcUnit returns true for units that consist of letters only, or a percentage sign.
+func isCalcUnit(unit []byte) bool {
+	if len(unit) == 1 && unit[0] == '%' {
+		return true
+	}
+	for _, c := range unit {
+		if (c < 'a' || 'z' < c) && (c < 'A' || 'Z' < c) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,608 @@
+package css
+
+import (
+	"bytes"
+	"encoding/hex"
+	"math"
+	"strconv"
+
+	"github.com/tdewolff/minify/v2"
+	"github.com/tdewolff/parse/v2"
+	"github.com/tdewolff/parse/v2/css"
+)
+
+// gamutEpsilon is the tolerance for sRGB channels just outside [0,1] due to rounding of the input.
+const gamutEpsilon = 0.001
+
+// namedColors are the hex values of named colors that have no shorter or longer hex representation in ShortenColorName and ShortenColorHex.
+var namedColors = map[string]string{
+	"aqua":           "#00ffff",
+	"blue":           "#0000ff",
+	"crimson":        "#dc143c",
+	"cyan":           "#00ffff",
+	"darkgrey":       "#a9a9a9",
+	"darkred":        "#8b0000",
+	"darkslategrey":  "#2f4f4f",
+	"dimgray":        "#696969",
+	"dimgrey":        "#696969",
+	"grey":           "#808080",
+	"hotpink":        "#ff69b4",
+	"lightgrey":      "#d3d3d3",
+	"lightslategray": "#778899",
+	"lightslategrey": "#778899",
+	"lime":           "#00ff00",
+	"oldlace":        "#fdf5e6",
+	"rebeccapurple":  "#663399",
+	"skyblue":        "#87ceeb",
+	"slategrey":      "#708090",
+	"thistle":        "#d8bfd8",
+}
+
+func init() {
+	for name, hex := range ShortenColorName {
+		namedColors[name.String()] = string(hex)
+	}
+	for hex, name := range ShortenColorHex {
+		namedColors[string(name)] = hex
+	}
+}
+
+// color is a color in the CIE XYZ color space with a D65 white point.
+type color struct {
+	xyz   [3]float64
+	alpha float64
+}
+
+type matrix [3][3]float64
+
+func (m matrix) mul(v [3]float64) [3]float64 {
+	return [3]float64{
+		m[0][0]*v[0] + m[0][1]*v[1] + m[0][2]*v[2],
+		m[1][0]*v[0] + m[1][1]*v[1] + m[1][2]*v[2],
+		m[2][0]*v[0] + m[2][1]*v[1] + m[2][2]*v[2],
+	}
+}
+
+// conversion matrices from CSS Color Module Level 4
+var (
+	linearSRGBToXYZ = matrix{
+		{0.41239079926595934, 0.357584339383878, 0.1804807884018343},
+		{0.21263900587151027, 0.715168678767756, 0.07219231536073371},
+		{0.01933081871559182, 0.11919477979462598, 0.9505321522496607},
+	}
+	xyzToLinearSRGB = matrix{
+		{3.2409699419045226, -1.537383177570094, -0.4986107602930034},
+		{-0.9692436362808796, 1.8759675015077202, 0.04155505740717559},
+		{0.05563007969699366, -0.20397695888897652, 1.0569715142428786},
+	}
+	linearP3ToXYZ = matrix{
+		{0.4865709486482162, 0.26566769316909306, 0.1982172852343625},
+		{0.2289745640697488, 0.6917385218365064, 0.079286914093745},
+		{0.0, 0.04511338185890264, 1.043944368900976},
+	}
+	d65ToD50 = matrix{
+		{1.0479298208405488, 0.022946793341019088, -0.05019222954313557},
+		{0.029627815688159344, 0.990434484573249, -0.01707382502938514},
+		{-0.009243058152591178, 0.015055144896577895, 0.7521316354461029},
+	}
+	d50ToD65 = matrix{
+		{0.9554734527042182, -0.023098536874261423, 0.0632593086610217},
+		{-0.028369706963208136, 1.0099954580058226, 0.021041398966943008},
+		{0.012314001688319899, -0.020507696433477912, 1.3303659366080753},
+	}
+	xyzToLMS = matrix{
+		{0.8190224379967030, 0.3619062600528904, -0.1288737815209879},
+		{0.0329836539323885, 0.9292868615863434, 0.0361446663506424},
+		{0.0481771893596242, 0.2642395317527308, 0.6335478284694309},
+	}
+	lmsToXYZ = matrix{
+		{1.2268798758459243, -0.5578149944602171, 0.2813910456659647},
+		{-0.0405757452148008, 1.1122868032803170, -0.0717110580655164},
+		{-0.0763729366746601, -0.4214933324022432, 1.5869240198367816},
+	}
+	lmsToOKLab = matrix{
+		{0.2104542683093140, 0.7936177747023054, -0.0040720430116193},
+		{1.9779985324311684, -2.4285922420485799, 0.4505937096174110},
+		{0.0259040424655478, 0.7827717124575296, -0.8086757548750670},
+	}
+	oklabToLMS = matrix{
+		{1.0, 0.3963377773761749, 0.2158037573099136},
+		{1.0, -0.1055613458156586, -0.0638541728258133},
+		{1.0, -0.0894841775298119, -1.2914855480194092},
+	}
+	whiteD50 = [3]float64{0.3457 / 0.3585, 1.0, (1.0 - 0.3457 - 0.3585) / 0.3585}
+)
+
+func srgbToLinear(c float64) float64 {
+	if math.Abs(c) <= 0.04045 {
+		return c / 12.92
+	}
+	return math.Copysign(math.Pow((math.Abs(c)+0.055)/1.055, 2.4), c)
+}
+
+func linearToSRGB(c float64) float64 {
+	if math.Abs(c) <= 0.0031308 {
+		return c * 12.92
+	}
+	return math.Copysign(1.055*math.Pow(math.Abs(c), 1.0/2.4)-0.055, c)
+}
+
+// toXYZ converts coordinates in a color space to XYZ. Polar color spaces have their hue in degrees.
+func toXYZ(space string, v [3]float64) ([3]float64, bool) {
+	switch space {
+	case "srgb":
+		return linearSRGBToXYZ.mul([3]float64{srgbToLinear(v[0]), srgbToLinear(v[1]), srgbToLinear(v[2])}), true
+	case "srgb-linear":
+		return linearSRGBToXYZ.mul(v), true
+	case "display-p3":
+		return linearP3ToXYZ.mul([3]float64{srgbToLinear(v[0]), srgbToLinear(v[1]), srgbToLinear(v[2])}), true
+	case "xyz", "xyz-d65":
+		return v, true
+	case "xyz-d50":
+		return d50ToD65.mul(v), true
+	case "lab":
+		const kappa, epsilon = 24389.0 / 27.0, 216.0 / 24389.0
+		f1 := (v[0] + 16.0) / 116.0
+		f0 := v[1]/500.0 + f1
+		f2 := f1 - v[2]/200.0
+		xyz := [3]float64{(116.0*f0 - 16.0) / kappa, v[0] / kappa, (116.0*f2 - 16.0) / kappa}
+		if epsilon < f0*f0*f0 {
+			xyz[0] = f0 * f0 * f0
+		}
+		if kappa*epsilon < v[0] {
+			xyz[1] = f1 * f1 * f1
+		}
+		if epsilon < f2*f2*f2 {
+			xyz[2] = f2 * f2 * f2
+		}
+		return d50ToD65.mul([3]float64{xyz[0] * whiteD50[0], xyz[1] * whiteD50[1], xyz[2] * whiteD50[2]}), true
+	case "oklab":
+		lms := oklabToLMS.mul(v)
+		return lmsToXYZ.mul([3]float64{lms[0] * lms[0] * lms[0], lms[1] * lms[1] * lms[1], lms[2] * lms[2] * lms[2]}), true
+	case "lch", "oklch":
+		h := v[2] * math.Pi / 180.0
+		return toXYZ(space[:len(space)-2]+"ab", [3]float64{v[0], v[1] * math.Cos(h), v[1] * math.Sin(h)})
+	}
+	return [3]float64{}, false
+}
+
+// fromXYZ converts XYZ to coordinates in a color space. Polar color spaces have their hue in degrees.
+func fromXYZ(space string, xyz [3]float64) ([3]float64, bool) {
+	switch space {
+	case "srgb":
+		v := xyzToLinearSRGB.mul(xyz)
+		return [3]float64{linearToSRGB(v[0]), linearToSRGB(v[1]), linearToSRGB(v[2])}, true
+	case "srgb-linear":
+		return xyzToLinearSRGB.mul(xyz), true
+	case "xyz", "xyz-d65":
+		return xyz, true
+	case "xyz-d50":
+		return d65ToD50.mul(xyz), true
+	case "lab":
+		const kappa, epsilon = 24389.0 / 27.0, 216.0 / 24389.0
+		v := d65ToD50.mul(xyz)
+		f := [3]float64{}
+		for i := range 3 {
+			if c := v[i] / whiteD50[i]; epsilon < c {
+				f[i] = math.Cbrt(c)
+			} else {
+				f[i] = (kappa*c + 16.0) / 116.0
+			}
+		}
+		return [3]float64{116.0*f[1] - 16.0, 500.0 * (f[0] - f[1]), 200.0 * (f[1] - f[2])}, true
+	case "oklab":
+		lms := xyzToLMS.mul(xyz)
+		return lmsToOKLab.mul([3]float64{math.Cbrt(lms[0]), math.Cbrt(lms[1]), math.Cbrt(lms[2])}), true
+	case "lch", "oklch":
+		v, _ := fromXYZ(space[:len(space)-2]+"ab", xyz)
+		h := math.Atan2(v[2], v[1]) * 180.0 / math.Pi
+		if h < 0.0 {
+			h += 360.0
+		}
+		return [3]float64{v[0], math.Hypot(v[1], v[2]), h}, true
+	}
+	return [3]float64{}, false
+}
+
+// toRGB returns the sRGB channels of the color clamped to [0,1], and false if the color is outside of the sRGB gamut.
+func (c color) toRGB() ([3]float64, bool) {
+	rgb, _ := fromXYZ("srgb", c.xyz)
+	for i := range 3 {
+		if rgb[i] < -gamutEpsilon || 1.0+gamutEpsilon < rgb[i] {
+			return rgb, false
+		}
+		rgb[i] = math.Max(0.0, math.Min(1.0, rgb[i]))
+	}
+	return rgb, true
+}
+
+// colorFunctionName returns the lowercase name of a color function that is not handled by the rgb() and hsl() minification.
+func colorFunctionName(t Token) string {
+	if t.TokenType != css.FunctionToken {
+		return ""
+	}
+	switch name := string(parse.ToLower(parse.Copy(t.Data[:len(t.Data)-1]))); name {
+	case "hwb", "lab", "lch", "oklab", "oklch", "color", "color-mix":
+		return name
+	}
+	return ""
+}
+
+// minifyColorFunction converts a hwb(), lab(), lch(), oklab(), oklch(), color(), or color-mix() color to hex or a color name if it is within the sRGB gamut. Otherwise, it removes default alpha values and units.
+func (c *cssMinifier) minifyColorFunction(t Token) Token {
+	if col, ok := parseColor(t); ok {
+		if rgb, ok := col.toRGB(); ok {
+			if col.alpha < minify.Epsilon && rgb[0] < minify.Epsilon && rgb[1] < minify.Epsilon && rgb[2] < minify.Epsilon {
+				return Token{css.IdentToken, transparentBytes, nil, 0, Transparent}
+			} else if 1.0-minify.Epsilon < col.alpha {
+				return rgbaToToken(rgb[0], rgb[1], rgb[2], 1.0)
+			} else if c.o.Targets.supports(hexAlphaColors) {
+				return rgbaToToken(rgb[0], rgb[1], rgb[2], col.alpha)
+			}
+		}
+	}
+
+	name := colorFunctionName(t)
+	if name == "color-mix" {
+		return t
+	}
+	for i, arg := range t.Args {
+		if arg.TokenType == css.DelimToken && arg.Data[0] == '/' && i+1 < len(t.Args) {
+			alpha := t.Args[len(t.Args)-1]
+			if a, ok := alphaValue(alpha); ok && 1.0-minify.Epsilon < a {
+				// lab(50% 20 30/1)  =>  lab(50% 20 30)
+				j := i
+				for 0 < j && t.Args[j-1].TokenType == css.WhitespaceToken {
+					j--
+				}
+				t.Args = t.Args[:j]
+			} else {
+				t.Args[len(t.Args)-1] = minifyNumberPercentage(alpha)
+			}
+			break
+		} else if arg.TokenType == css.DimensionToken && (name == "hwb" && i == 0 || (name == "lch" || name == "oklch") && i == 4) {
+			// lch(50% 20 30deg)  =>  lch(50% 20 30)
+			if n := len(arg.Data) - 3; 0 < n && parse.EqualFold(arg.Data[n:], []byte("deg")) {
+				t.Args[i] = Token{css.NumberToken, arg.Data[:n], nil, 0, 0}
+			}
+		}
+	}
+	return t
+}
+
+// parseColor parses a constant color value.
+func parseColor(t Token) (color, bool) {
+	switch t.TokenType {
+	case css.HashToken:
+		return parseHexColor(t.Data)
+	case css.IdentToken:
+		name := string(parse.ToLower(parse.Copy(t.Data)))
+		if name == "transparent" {
+			return color{alpha: 0.0}, true
+		} else if hex, ok := namedColors[name]; ok {
+			return parseHexColor([]byte(hex))
+		}
+		return color{}, false
+	case css.FunctionToken:
+	default:
+		return color{}, false
+	}
+
+	name := string(parse.ToLower(parse.Copy(t.Data[:len(t.Data)-1])))
+	if name == "color-mix" {
+		return parseColorMix(t.Args)
+	}
+
+	components, alpha, ok := splitColorArgs(t.Args)
+	if !ok {
+		return color{}, false
+	}
+	col := color{alpha: 1.0}
+	if alpha != nil {
+		if col.alpha, ok = alphaValue(*alpha); !ok {
+			return color{}, false
+		}
+	}
+
+	space := name
+	var refs [3]float64 // the values of 100% for each component, or -1 for hues
+	switch name {
+	case "rgb", "rgba":
+		space, refs = "srgb", [3]float64{255.0, 255.0, 255.0}
+	case "hsl", "hsla":
+		refs = [3]float64{-1.0, 1.0, 1.0}
+	case "hwb":
+		refs = [3]float64{-1.0, 1.0, 1.0}
+	case "lab":
+		refs = [3]float64{100.0, 125.0, 125.0}
+	case "lch":
+		refs = [3]float64{100.0, 150.0, -1.0}
+	case "oklab":
+		refs = [3]float64{1.0, 0.4, 0.4}
+	case "oklch":
+		refs = [3]float64{1.0, 0.4, -1.0}
+	case "color":
+		if len(components) != 4 || components[0].TokenType != css.IdentToken {
+			return color{}, false
+		}
+		space = string(parse.ToLower(parse.Copy(components[0].Data)))
+		components = components[1:]
+		refs = [3]float64{1.0, 1.0, 1.0}
+	default:
+		return color{}, false
+	}
+	if len(components) == 4 && alpha == nil && (name == "rgba" || name == "hsla") {
+		a, ok := alphaValue(components[3])
+		if !ok {
+			return color{}, false
+		}
+		col.alpha = a
+		components = components[:3]
+	} else if len(components) != 3 {
+		return color{}, false
+	}
+
+	var v [3]float64
+	for i, component := range components {
+		if v[i], ok = componentValue(component, refs[i]); !ok {
+			return color{}, false
+		}
+	}
+	if name == "rgb" || name == "rgba" {
+		for i := range v {
+			v[i] /= refs[i]
+		}
+	} else if name == "hsl" || name == "hsla" || name == "hwb" {
+		h := math.Mod(v[0], 360.0)
+		if h < 0.0 {
+			h += 360.0
+		}
+		if name == "hwb" {
+			w, b := v[1], v[2]
+			if 1.0 <= w+b {
+				w, b = w/(w+b), b/(w+b)
+			}
+			r, g, bl := css.HSL2RGB(h/360.0, 1.0, 0.5)
+			v = [3]float64{r*(1.0-w-b) + w, g*(1.0-w-b) + w, bl*(1.0-w-b) + w}
+		} else {
+			r, g, b := css.HSL2RGB(h/360.0, v[1], v[2])
+			v = [3]float64{r, g, b}
+		}
+		space = "srgb"
+	} else if name == "lab" || name == "lch" {
+		v[0] = math.Max(0.0, math.Min(100.0, v[0]))
+	} else if name == "oklab" || name == "oklch" {
+		v[0] = math.Max(0.0, math.Min(1.0, v[0]))
+	}
+	if name == "lch" || name == "oklch" {
+		v[1] = math.Max(0.0, v[1])
+	}
+
+	if col.xyz, ok = toXYZ(space, v); !ok {
+		return color{}, false
+	}
+	return col, true
+}
+
+func parseHexColor(b []byte) (color, bool) {
+	b = b[1:]
+	if len(b) == 3 || len(b) == 4 {
+		b = []byte{b[0], b[0], b[1], b[1], b[2], b[2], b[len(b)-1], b[len(b)-1]}[:len(b)*2]
+	}
+	if len(b) != 6 && len(b) != 8 {
+		return color{}, false
+	}
+	rgba := make([]byte, len(b)/2)
+	if _, err := hex.Decode(rgba, b); err != nil {
+		return color{}, false
+	}
+	col := color{alpha: 1.0}
+	if len(rgba) == 4 {
+		col.alpha = float64(rgba[3]) / 255.0
+	}
+	col.xyz, _ = toXYZ("srgb", [3]float64{float64(rgba[0]) / 255.0, float64(rgba[1]) / 255.0, float64(rgba[2]) / 255.0})
+	return col, true
+}
+
+// splitColorArgs returns the components and the alpha value of a color function. Components are separated by whitespace or commas, and the alpha value follows a slash.
+func splitColorArgs(args []Token) ([]Token, *Token, bool) {
+	var components []Token
+	var alpha *Token
+	for i := 0; i < len(args); i++ {
+		switch arg := args[i]; arg.TokenType {
+		case css.WhitespaceToken, css.CommaToken:
+		case css.DelimToken:
+			if arg.Data[0] != '/' || alpha != nil {
+				return nil, nil, false
+			}
+			for i++; i < len(args) && args[i].TokenType == css.WhitespaceToken; i++ {
+			}
+			if i != len(args)-1 {
+				return nil, nil, false
+			}
+			alpha = &args[i]
+		case css.NumberToken, css.PercentageToken, css.DimensionToken, css.IdentToken:
+			if alpha != nil {
+				return nil, nil, false
+			}
+			components = append(components, arg)
+		default:
+			return nil, nil, false
+		}
+	}
+	return components, alpha, true
+}
+
+// componentValue returns the value of a color component, where percentages are relative to ref. Hues have a negative ref and are returned in degrees.
+func componentValue(t Token, ref float64) (float64, bool) {
+	switch t.TokenType {
+	case css.IdentToken:
+		if parse.EqualFold(t.Data, noneBytes) {
+			return 0.0, true
+		}
+	case css.NumberToken:
+		return parseFloat(t.Data)
+	case css.PercentageToken:
+		if 0.0 < ref {
+			f, ok := parseFloat(t.Data[:len(t.Data)-1])
+			return f / 100.0 * ref, ok
+		}
+	case css.DimensionToken:
+		if ref < 0.0 {
+			n := parse.Number(t.Data)
+			f, ok := parseFloat(t.Data[:n])
+			switch string(parse.ToLower(parse.Copy(t.Data[n:]))) {
+			case "deg":
+				return f, ok
+			case "rad":
+				return f * 180.0 / math.Pi, ok
+			case "grad":
+				return f * 0.9, ok
+			case "turn":
+				return f * 360.0, ok
+			}
+		}
+	}
+	return 0.0, false
+}
+
+// alphaValue returns the alpha value clamped to [0,1].
+func alphaValue(t Token) (float64, bool) {
+	a, ok := componentValue(t, 1.0)
+	if !ok || t.TokenType == css.DimensionToken {
+		return 0.0, false
+	}
+	return math.Max(0.0, math.Min(1.0, a)), true
+}
+
+func parseFloat(b []byte) (float64, bool) {
+	f, err := strconv.ParseFloat(string(b), 64)
+	return f, err == nil && !math.IsInf(f, 0) && !math.IsNaN(f)
+}
+
+// parseColorMix evaluates color-mix() with constant colors in a rectangular or polar color space with the shorter hue interpolation.
+func parseColorMix(args []Token) (color, bool) {
+	var parts [][]Token
+	start := 0
+	for i, arg := range args {
+		if arg.TokenType == css.CommaToken {
+			parts = append(parts, trimWhitespaceTokens(args[start:i]))
+			start = i + 1
+		}
+	}
+	parts = append(parts, trimWhitespaceTokens(args[start:]))
+	if len(parts) != 3 {
+		return color{}, false
+	}
+
+	// interpolation method
+	method := []string{}
+	for _, arg := range parts[0] {
+		if arg.TokenType == css.IdentToken {
+			method = append(method, string(parse.ToLower(parse.Copy(arg.Data))))
+		} else if arg.TokenType != css.WhitespaceToken {
+			return color{}, false
+		}
+	}
+	if len(method) < 2 || method[0] != "in" || len(method) != 2 && (len(method) != 4 || method[2] != "shorter" || method[3] != "hue") {
+		return color{}, false
+	}
+	space := method[1]
+	if _, ok := fromXYZ(space, [3]float64{}); !ok {
+		return color{}, false
+	}
+	polar := space == "lch" || space == "oklch"
+
+	// colors and percentages
+	var cols [2]color
+	var ps [2]float64
+	var hasP [2]bool
+	for i, part := range parts[1:] {
+		var colorToken *Token
+		for j := range part {
+			switch part[j].TokenType {
+			case css.WhitespaceToken:
+			case css.PercentageToken:
+				if hasP[i] {
+					return color{}, false
+				}
+				p, ok := parseFloat(part[j].Data[:len(part[j].Data)-1])
+				if !ok || p < 0.0 || 100.0 < p {
+					return color{}, false
+				}
+				ps[i], hasP[i] = p/100.0, true
+			default:
+				if colorToken != nil {
+					return color{}, false
+				}
+				colorToken = &part[j]
+			}
+		}
+		if colorToken == nil || colorToken.TokenType == css.IdentToken && bytes.Equal(parse.ToLower(parse.Copy(colorToken.Data)), noneBytes) {
+			return color{}, false
+		}
+		var ok bool
+		if cols[i], ok = parseColor(*colorToken); !ok {
+			return color{}, false
+		}
+	}
+	if !hasP[0] && !hasP[1] {
+		ps = [2]float64{0.5, 0.5}
+	} else if !hasP[0] {
+		ps[0] = 1.0 - ps[1]
+	} else if !hasP[1] {
+		ps[1] = 1.0 - ps[0]
+	}
+	sum := ps[0] + ps[1]
+	if sum < minify.Epsilon {
+		return color{}, false
+	}
+	ps[0], ps[1] = ps[0]/sum, ps[1]/sum
+
+	// interpolate with premultiplied alpha
+	var vs [2][3]float64
+	for i := range cols {
+		vs[i], _ = fromXYZ(space, cols[i].xyz)
+		if polar && vs[i][1] < minify.Epsilon {
+			vs[i][2] = math.NaN() // powerless hue
+		}
+	}
+	if polar {
+		if math.IsNaN(vs[0][2]) && math.IsNaN(vs[1][2]) {
+			vs[0][2], vs[1][2] = 0.0, 0.0
+		} else if math.IsNaN(vs[0][2]) {
+			vs[0][2] = vs[1][2]
+		} else if math.IsNaN(vs[1][2]) {
+			vs[1][2] = vs[0][2]
+		} else if d := vs[1][2] - vs[0][2]; 180.0 < d {
+			vs[0][2] += 360.0
+		} else if d < -180.0 {
+			vs[1][2] += 360.0
+		}
+	}
+	mix := color{alpha: cols[0].alpha*ps[0] + cols[1].alpha*ps[1]}
+	var v [3]float64
+	for j := range 3 {
+		if polar && j == 2 {
+			v[j] = vs[0][j]*ps[0] + vs[1][j]*ps[1]
+		} else {
+			v[j] = vs[0][j]*cols[0].alpha*ps[0] + vs[1][j]*cols[1].alpha*ps[1]
+			if minify.Epsilon < mix.alpha {
+				v[j] /= mix.alpha
+			}
+		}
+	}
+	mix.alpha *= math.Min(1.0, sum)
+	mix.xyz, _ = toXYZ(space, v)
+	return mix, true
+}
+
+func trimWhitespaceTokens(tokens []Token) []Token {
+	for 0 < len(tokens) && tokens[0].TokenType == css.WhitespaceToken {
+		tokens = tokens[1:]
+	}
+	for 0 < len(tokens) && tokens[len(tokens)-1].TokenType == css.WhitespaceToken {
+		tokens = tokens[:len(tokens)-1]
+	}
+	return tokens
+}
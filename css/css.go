@@ -52,18 +52,28 @@ type cssMinifier struct {
 	p *css.Parser
 	o *Minifier
 
-	tokenBuffer []Token
-	tokensLevel int
+	tokenBuffer   []Token
+	tokensLevel   int
+	legalComments [][]byte // legal comments that are written at the end
+	err           error    // first error returned by the URL rewriting callback
 }
 
 ////////////////////////////////////////////////////////////////
 
 // Minifier is a CSS minifier.
 type Minifier struct {
-	Precision    int // number of significant digits
-	newPrecision int // precision for new numbers
-	Inline       bool
-	Version      int
+	Precision         int // number of significant digits
+	newPrecision      int // precision for new numbers
+	Inline            bool
+	Version           int
+	LegalComments     minify.LegalComments
+	MergeRules        bool
+	MergeDeclarations bool // remove overridden declarations and merge longhands into shorthands, except into font since it resets properties that it cannot set
+	FlattenNesting    bool
+	Targets           Targets
+	Purge             *Usage    // remove rules that cannot match the content in Usage
+	RemoveUnusedVars  bool      // remove custom properties that are not referenced in the stylesheet
+	RenameVars        *VarNames // rename custom properties to short names, which are stored in VarNames
 }
 
 // Minify minifies CSS data, it reads from r and writes to w.
@@ -153,6 +163,30 @@ func (o *Minifier) Minify(m *minify.M, w io.Writer, r io.Reader, params map[stri
 
 	z := parse.NewInput(r)
 	defer z.Restore()
+	if !o.Inline && (o.FlattenNesting || o.Targets != (Targets{}) && !o.Targets.supports(nesting)) {
+		useIs := o.Targets == (Targets{}) || o.Targets.supports(isSelector)
+		if b, ok := flattenNesting(z.Bytes(), useIs); ok {
+			z = parse.NewInputBytes(b)
+			defer z.Restore()
+		}
+	}
+	if !o.Inline && o.Purge != nil {
+		if b, ok := o.Purge.purge(z.Bytes()); ok {
+			z = parse.NewInputBytes(b)
+			defer z.Restore()
+		}
+	} else if !o.Inline && o.RemoveUnusedVars {
+		if b, ok := removeUnusedCustomProperties(z.Bytes()); ok {
+			z = parse.NewInputBytes(b)
+			defer z.Restore()
+		}
+	}
+	if o.RenameVars != nil {
+		if b, ok := o.RenameVars.rename(z.Bytes()); ok {
+			z = parse.NewInputBytes(b)
+			defer z.Restore()
+		}
+	}
 
 	c := &cssMinifier{
 		m: m,
@@ -160,7 +194,45 @@ func (o *Minifier) Minify(m *minify.M, w io.Writer, r io.Reader, params map[stri
 		p: css.NewParser(z, o.Inline),
 		o: o,
 	}
-	c.minifyGrammar()
+	if o.MergeRules && !o.Inline || o.MergeDeclarations {
+		buf := &bytes.Buffer{}
+		c.w = buf
+		c.minifyGrammar()
+
+		// only restructure when the stylesheet can be reconstructed from its tree
+		rules := parseRules(buf.Bytes())
+		tree := &bytes.Buffer{}
+		writeRules(tree, rules)
+		if bytes.Equal(tree.Bytes(), buf.Bytes()) {
+			d := declMerger{m, &Minifier{Precision: o.Precision, Version: o.Version, Targets: o.Targets, Inline: true}}
+			if o.MergeDeclarations && o.Inline {
+				if (&rule{children: rules}).hasOnlyDecls() {
+					rules = d.mergeBlock(rules)
+				}
+			} else if o.MergeDeclarations {
+				d.mergeDecls(rules)
+			}
+			if o.MergeRules && !o.Inline {
+				rules = mergeRules(rules)
+				if o.MergeDeclarations {
+					// merging rulesets may create overridden declarations, and removing them may create identical rulesets
+					d.mergeDecls(rules)
+					rules = mergeRules(rules)
+				}
+			}
+			writeRules(w, rules)
+		} else {
+			w.Write(buf.Bytes())
+		}
+	} else {
+		c.minifyGrammar()
+	}
+	if c.err != nil {
+		return c.err
+	}
+	if err := minify.WriteLegalComments(w, o.LegalComments, c.legalComments); err != nil {
+		return err
+	}
 
 	if _, err := w.Write(nil); err != nil {
 		return err
@@ -171,6 +243,20 @@ func (o *Minifier) Minify(m *minify.M, w io.Writer, r io.Reader, params map[stri
 	return c.p.Err()
 }
 
+// rewriteURL returns the URL as rewritten by the URL rewriting callback, where the quote delimiter is escaped.
+func (c *cssMinifier) rewriteURL(uri []byte, delim byte) []byte {
+	rewritten, err := minify.RewriteURL(c.m, "text/css", uri)
+	if err != nil {
+		if c.err == nil {
+			c.err = err
+		}
+		return uri
+	} else if bytes.Equal(rewritten, uri) {
+		return uri
+	}
+	return bytes.ReplaceAll(rewritten, []byte{delim}, []byte{'\\', delim})
+}
+
 func (c *cssMinifier) minifyGrammar() {
 	semicolonQueued := false
 	for {
@@ -233,6 +319,17 @@ func (c *cssMinifier) minifyGrammar() {
 				}
 				values[1].Data = url
 			}
+			if ToHash(data[1:]) == Import && 1 < len(values) && c.m != nil && c.m.RewriteURL != nil {
+				url := values[1].Data
+				if values[1].TokenType == css.URLToken && 4 < len(url) && url[len(url)-1] == ')' {
+					url = append(append([]byte{'"'}, urlValue(url)...), '"')
+				}
+				if 1 < len(url) && (url[0] == '"' || url[0] == '\'') && url[len(url)-1] == url[0] {
+					if uri := c.rewriteURL(url[1:len(url)-1], url[0]); !bytes.Equal(uri, url[1:len(url)-1]) {
+						values[1].Data = append(append([]byte{url[0]}, uri...), url[0])
+					}
+				}
+			}
 			for _, val := range values {
 				c.w.Write(val.Data)
 			}
@@ -271,15 +368,21 @@ func (c *cssMinifier) minifyGrammar() {
 			value := parse.TrimWhitespace(c.p.Values()[0].Data)
 			if len(c.p.Values()[0].Data) != 0 && len(value) == 0 {
 				value = spaceBytes
+			} else {
+				value = c.minifyCustomPropertyValue(value)
 			}
 			c.w.Write(value)
 			semicolonQueued = true
 		case css.CommentGrammar:
-			if 5 < len(data) && data[1] == '*' && data[2] == '!' {
-				c.w.Write(data[:3])
-				comment := parse.TrimWhitespace(parse.ReplaceMultipleWhitespace(data[3 : len(data)-2]))
-				c.w.Write(comment)
-				c.w.Write(data[len(data)-2:])
+			if 5 < len(data) && data[1] == '*' && minify.IsLegalComment(data) {
+				if c.o.LegalComments == minify.LegalCommentsEOF || c.o.LegalComments == minify.LegalCommentsExternal {
+					c.legalComments = append(c.legalComments, data)
+				} else if c.o.LegalComments == minify.LegalCommentsInline {
+					c.w.Write(data[:3])
+					comment := parse.TrimWhitespace(parse.ReplaceMultipleWhitespace(data[3 : len(data)-2]))
+					c.w.Write(comment)
+					c.w.Write(data[len(data)-2:])
+				}
 			}
 		default:
 			c.w.Write(data)
@@ -520,7 +623,7 @@ func (c *cssMinifier) minifyTokens(prop Hash, fun Hash, values []Token) []Token
 		case css.StringToken:
 			values[i].Data = removeMarkupNewlines(values[i].Data)
 		case css.URLToken:
-			if 10 < len(values[i].Data) {
+			if 10 < len(values[i].Data) || c.m != nil && c.m.RewriteURL != nil && 4 < len(values[i].Data) {
 				uri := parse.TrimWhitespace(values[i].Data[4 : len(values[i].Data)-1])
 				delim := byte('"')
 				if 1 < len(uri) && (uri[0] == '\'' || uri[0] == '"') {
@@ -530,6 +633,8 @@ func (c *cssMinifier) minifyTokens(prop Hash, fun Hash, values []Token) []Token
 				}
 				if 4 < len(uri) && parse.EqualFold(uri[:5], dataSchemeBytes) {
 					uri = minify.DataURI(c.m, uri)
+				} else {
+					uri = c.rewriteURL(uri, delim)
 				}
 				if css.IsURLUnquoted(uri) {
 					values[i].Data = append(append(urlBytes, uri...), ')')
@@ -539,10 +644,16 @@ func (c *cssMinifier) minifyTokens(prop Hash, fun Hash, values []Token) []Token
 			}
 		case css.FunctionToken:
 			values[i].Args = c.minifyTokens(prop, values[i].Fun, values[i].Args)
+			if isMathFunction(values[i].Fun) {
+				values[i] = c.minifyCalc(values[i], fun)
+				break
+			}
 
 			fun := values[i].Fun
 			args := values[i].Args
-			if fun == Rgb || fun == Rgba || fun == Hsl || fun == Hsla {
+			if colorFunctionName(values[i]) != "" {
+				values[i] = c.minifyColorFunction(values[i])
+			} else if fun == Rgb || fun == Rgba || fun == Hsl || fun == Hsla {
 				valid := true
 				vals := []float64{}
 				for i, arg := range args {
@@ -598,7 +709,7 @@ func (c *cssMinifier) minifyTokens(prop Hash, fun Hash, values []Token) []Token
 					}
 				}
 
-				if a == 1.0 && (len(vals) == 3 || len(vals) == 4) { // only minify color if fully opaque
+				if (a == 1.0 || c.o.Targets.supports(hexAlphaColors)) && (len(vals) == 3 || len(vals) == 4) { // only minify color if fully opaque or if hex colors with alpha are supported
 					if fun == Rgb || fun == Rgba {
 						for j := range 3 {
 							if args[j*2].TokenType == css.NumberToken {
@@ -610,7 +721,7 @@ func (c *cssMinifier) minifyTokens(prop Hash, fun Hash, values []Token) []Token
 								}
 							}
 						}
-						values[i] = rgbToToken(vals[0], vals[1], vals[2])
+						values[i] = rgbaToToken(vals[0], vals[1], vals[2], a)
 						break
 					} else if fun == Hsl || fun == Hsla && args[0].TokenType == css.NumberToken && args[2].TokenType == css.PercentageToken && args[4].TokenType == css.PercentageToken {
 						vals[0] /= 360.0
@@ -619,7 +730,7 @@ func (c *cssMinifier) minifyTokens(prop Hash, fun Hash, values []Token) []Token
 							vals[0] = 1.0 + vals[0]
 						}
 						r, g, b := css.HSL2RGB(vals[0], vals[1], vals[2])
-						values[i] = rgbToToken(r, g, b)
+						values[i] = rgbaToToken(r, g, b, a)
 						break
 					}
 				} else if len(vals) == 4 {
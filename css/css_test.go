@@ -4,7 +4,10 @@ import (
 	"bytes"
 	"fmt"
 	"os"
+	"regexp"
+	"strings"
 	"testing"
+	"testing/fstest"
 
 	"github.com/tdewolff/minify/v2"
 	"github.com/tdewolff/parse/v2/css"
@@ -147,6 +150,27 @@ func TestCSSInline(t *testing.T) {
 		{"color: hsla(0 100% 50% / 1);", "color:red"},
 		{"color: hsla(0 100% 50% / 60%);", "color:hsla(0 100% 50%/.6)"},
 		{"color: hsla(400, 150%, 150%, 2);", "color:#fff"},
+		{"color: hwb(0 0% 0%);", "color:red"},
+		{"color: hwb(120deg 20% 30%);", "color:#33b333"},
+		{"color: hwb(0 60% 60%);", "color:gray"},
+		{"color: lab(100% 0 0);", "color:#fff"},
+		{"color: lab(50% none 0);", "color:#777"},
+		{"color: LAB(50% 0 0 / 1);", "color:#777"},
+		{"color: lab(50% 20 30 / 0.500);", "color:lab(50% 20 30/.5)"},
+		{"color: lch(50% 200 30deg / 100%);", "color:lch(50% 200 30)"},
+		{"color: oklab(62.8% 0.2249 0.1258);", "color:red"},
+		{"color: oklch(0.628 0.2577 29.23deg);", "color:red"},
+		{"color: oklch(0.7 0.4 150deg / 50%);", "color:oklch(.7 .4 150/.5)"},
+		{"color: color(srgb 1 0 0);", "color:red"},
+		{"color: color(srgb-linear 0.21586 0.21586 0.21586);", "color:gray"},
+		{"color: color(display-p3 1 0 0);", "color:color(display-p3 1 0 0)"},
+		{"color: color(srgb 0 0 0 / 0);", "color:transparent"},
+		{"color: color-mix(in srgb, red, blue);", "color:purple"},
+		{"color: color-mix(in srgb, red 25%, blue);", "color:#4000bf"},
+		{"color: color-mix(in lab, white, black);", "color:#777"},
+		{"color: color-mix(in oklab, #fff 40%, #000 40%);", "color:color-mix(in oklab,#fff 40%,#000 40%)"},
+		{"color: color-mix(in srgb, currentColor, blue);", "color:color-mix(in srgb,currentColor,blue)"},
+		{"color: color-mix(in hsl, red, blue);", "color:color-mix(in hsl,red,blue)"},
 		//{"color: hwb(0 0% 0%);", "color:red"}, TODO
 		//{"color: hwb(120 20% 20%/50%);", "color:"}, TODO
 		{"background-color:transparent", "background-color:transparent"},
@@ -318,7 +342,7 @@ func TestCSSInline(t *testing.T) {
 		{"background:url('data:\\'\",text')", "background:url('data:\\'\",text')"},
 		{"margin:0 0 18px 0;", "margin:0 0 18px"},
 		{"z-index:1000", "z-index:1000"},
-		{"z-index:calc(1000)", "z-index:calc(1000)"},
+		{"z-index:calc(1000)", "z-index:1000"},
 		//{"flex:0px", "flex:0q"}, // TODO
 		{"g:url('abc\\\ndef')", "g:url(abcdef)"},
 		{"url:local('abc\\\ndef')", "url:local(abcdef)"},
@@ -346,7 +370,7 @@ func TestCSSInline(t *testing.T) {
 		{"background:url(url) TOP RIGHT REPEAT-Y", "background:url(url)100% 0 REPEAT-Y"},
 		{"background:url(url)TOP RIGHT REPEAT-Y", "background:url(url)100% 0 REPEAT-Y"},
 
-		{"margin:calc(10px) calc(20px)", "margin:calc(10px)calc(20px)"},
+		{"margin:calc(10px) calc(20px)", "margin:10px 20px"},
 		{"border-left:0 none", "border-left:0"},
 		{"--custom-variable:0px;", "--custom-variable:0px"},
 		{"--foo: 0px ;", "--foo:0px"},
@@ -355,26 +379,50 @@ func TestCSSInline(t *testing.T) {
 		{"--foo:;", "--foo:"},                 // empty value
 		{"--foo: initial ;", "--foo:initial"}, // invalid value, serializes to empty
 		{"x: var(--0);", "x:var(--0)"},
+		{"--x: 0.50px , 1.0 , 010 ;", "--x:.5px,1.0,10"},
+		{"--x: 20.0% 1.5E2PX / 2;", "--x:20% 150px/2"},
+		{"--x: #FFFFFF  #AbCdEf #FFFFFF88 #header;", "--x:#fff #abcdef #ffffff88 #header"},
+		{"--x: Red !important;", "--x:Red !important"},
+		{"--x: rgb(255, 0, 0.0);", "--x:rgb(255, 0, 0.0)"},
 		{"color=blue;", "color=blue"},
 		{"x: white , white", "x:white,white"},
 
 		// TODO: functions
 		{"width:calc(0%-0px)", "width:calc(0%0px)"}, // invalid
 		{"width:calc(0% - 0px)", "width:calc(0% - 0px)"},
-		{"width:calc(calc(0% - 0px) + 1em)", "width:calc(calc(0% - 0px) + 1em)"},
-		//{"width:calc(5px);", "width:5px"},
-		//{"width:calc(5px - 3px);", "width:2px"},
-		//{"width:calc(5px + -3px);", "width:2px"},
-		//{"width:calc(5px - 3%);", "width:calc(5px - 3%)"},
-		//{"width:calc(2*5px);", "width:10px"},
-		//{"width:calc(10px/2);", "width:5px"},
-		//{"width:calc(calc(5px));", "width:5px"},
-		//{"width:calc(calc(5px - 1em)*3);", "width:calc((5px - 1em)*3)"},
-		//{"width:calc(calc(5px - 1em) - 3%);", "width:calc(5px - 1em - 3%)"},
-		//{"width:calc(3% - calc(5px - 1em));", "width:calc(3% - 5px + 1em)"},
-		//{"width:calc(5px-3px);", "width:calc(5px-3px)"}, // invalid
-		//{"width:calc(5px*3px);", "width:calc(5px*3px)"}, // invalid
-		//{"width:calc(5px/3px);", "width:calc(5px/3px)"}, // invalid
+		{"width:calc(calc(0% - 0px) + 1em)", "width:calc(0% + 1em)"},
+		{"width:calc(5px);", "width:5px"},
+		{"width:calc(5px - 3px);", "width:2px"},
+		{"width:calc(5px + -3px);", "width:2px"},
+		{"width:calc(5px - 3%);", "width:calc(5px - 3%)"},
+		{"width:calc(2*5px);", "width:10px"},
+		{"width:calc(10px/2);", "width:5px"},
+		{"width:calc(calc(5px));", "width:5px"},
+		{"width:calc(calc(5px - 1em)*3);", "width:calc((5px - 1em)*3)"},
+		{"width:calc(calc(5px - 1em) - 3%);", "width:calc(5px - 1em - 3%)"},
+		{"width:calc(3% - calc(5px - 1em));", "width:calc(3% - 5px + 1em)"},
+		{"width:calc(5px-3px);", "width:calc(5px-3px)"}, // invalid
+		{"width:calc(5px*3px);", "width:calc(5px*3px)"}, // invalid
+		{"width:calc(5px/3px);", "width:calc(5px/3px)"}, // invalid
+		{"width:calc(5px/0);", "width:calc(5px/0)"},     // invalid
+		{"width:calc(16px * 2);", "width:32px"},
+		{"width:calc(100% - (2 * 8px));", "width:calc(100% - 16px)"},
+		{"width:calc(1rem + 0px);", "width:1rem"},
+		{"width:calc(100% + 0px);", "width:calc(100% + 0px)"},
+		{"width:calc(0.1px + 0.2px);", "width:.3px"},
+		{"width:calc(1px - 3px);", "width:calc(-2px)"},
+		{"width:calc(1px + var(--x) + 2px);", "width:calc(3px + var(--x))"},
+		{"width:calc(var(--x) * 2 * 3);", "width:calc(var(--x)*2*3)"},
+		{"width:calc(0px - var(--x));", "width:calc(0px - var(--x))"},
+		{"line-height:calc(3 / 2);", "line-height:calc(1.5)"},
+		{"z-index:calc(4 / 2);", "z-index:2"},
+		{"width:min(10px, 20px);", "width:10px"},
+		{"width:max(10px, 20px, 50%);", "width:max(20px,50%)"},
+		{"width:min(10px + 5px, 1em, 2em);", "width:min(15px,1em)"},
+		{"width:clamp(10px, 5px, 20px);", "width:10px"},
+		{"width:clamp(1rem, 2vw, 3rem);", "width:clamp(1rem,2vw,3rem)"},
+		{"width:calc(100% - min(10px, 20px));", "width:calc(100% - 10px)"},
+		{"width:calc(min(-10px, 20px));", "width:calc(-10px)"},
 
 		// TODO: dimensions
 		//{"any:0deg 0s 0ms 0dpi 0dpcm 0dppx 0hz 0khz", "any:0 0s 0s 0dpi 0dpi 0dpi 0hz 0hz"},
@@ -474,6 +522,546 @@ func TestCSS2(t *testing.T) {
 	}
 }
 
+func TestCSSMergeRules(t *testing.T) {
+	cssTests := []struct {
+		css      string
+		expected string
+	}{
+		{"a{color:red}b{color:red}", "a,b{color:red}"},
+		{"a{color:red}a{margin:0}", "a{color:red;margin:0}"},
+		{"a,b{color:red}b,a{margin:0}", "a,b{color:red;margin:0}"},
+		{"html{line-height:1}html{line-height:1}", "html{line-height:1}"},
+		{"a{color:red}c{margin:0}b{color:red}", "a,b{color:red}c{margin:0}"},
+		{"a{color:red}c{margin:0;color:blue}b{color:red}", "a{color:red}c{margin:0;color:blue}b{color:red}"},
+		{"a{margin:0}c{margin-left:1px}b{margin:0}", "a{margin:0}c{margin-left:1px}b{margin:0}"},
+		{"a{left:0}c{inset:1px}b{left:0}", "a{left:0}c{inset:1px}b{left:0}"},
+		{"a{color:red}c{all:unset}b{color:red}", "a{color:red}c{all:unset}b{color:red}"},
+		{"a{color:red;margin:0}c{margin:1px}b{color:red;margin:0}", "a{color:red;margin:0}c{margin:1px}b{color:red;margin:0}"},
+		{"a{color:red}c{color:blue}b{color:red}d{margin:0}", "a{color:red}c{color:blue}b{color:red}d{margin:0}"},
+		{"a{color:red}c{color:blue}b{color:red}d{color:red}", "a{color:red}c{color:blue}b,d{color:red}"},
+		{"a{--x:1}c{--y:2}b{--x:1}", "a,b{--x:1}c{--y:2}"},
+		{"@media print{a{color:red}}@media print{b{color:red}}", "@media print{a,b{color:red}}"},
+		{"@media print{a{color:red}}@media screen{b{color:red}}", "@media print{a{color:red}}@media screen{b{color:red}}"},
+		{"@supports (display:grid){a{display:grid}}@supports (display:grid){b{color:red}}", "@supports(display:grid){a{display:grid}b{color:red}}"},
+		{"a{color:red}@media print{c{color:blue}}b{color:red}", "a{color:red}@media print{c{color:blue}}b{color:red}"},
+		{"a{color:red}@media print{c{margin:0}}b{color:red}", "a,b{color:red}@media print{c{margin:0}}"},
+		{"a{color:red}@font-face{src:url(a)}b{color:red}", "a,b{color:red}@font-face{src:url(a)}"},
+		{"a{color:red}@page{color:blue}b{color:red}", "a{color:red}@page{color:blue}b{color:red}"},
+		{"a{color:red}@import 'x';b{color:red}", "a{color:red}@import 'x';b{color:red}"},
+		{"@keyframes k{from{color:red}to{color:red}}", "@keyframes k{from{color:red}to{color:red}}"},
+		{"a{color:red}b::-webkit-scrollbar{color:red}", "a{color:red}b::-webkit-scrollbar{color:red}"},
+		{"a{color:red}b:focus-visible{color:red}", "a{color:red}b:focus-visible{color:red}"},
+		{"a{color:red}b:not(c,d){color:red}", "a{color:red}b:not(c,d){color:red}"},
+		{"a{color:red}b:hover::before{color:red}", "a,b:hover::before{color:red}"},
+		{"a{color:red}b[title=':x']{color:red}", "a,b[title=':x']{color:red}"},
+		{"a{color:red}b{color:red;x}", "a{color:red}b{color:red;x}"},
+		{"input[type=\"radio\" i]{x:y}a{x:y}", "input[type=radio i]{x:y}a{x:y}"},
+	}
+
+	m := minify.New()
+	o := &Minifier{MergeRules: true}
+	for _, tt := range cssTests {
+		t.Run(tt.css, func(t *testing.T) {
+			r := bytes.NewBufferString(tt.css)
+			w := &bytes.Buffer{}
+			err := o.Minify(m, w, r, nil)
+			test.Minify(t, tt.css, err, w.String(), tt.expected)
+		})
+	}
+}
+
+func TestCSSMergeDeclarations(t *testing.T) {
+	cssTests := []struct {
+		css      string
+		expected string
+	}{
+		{"a{color:red;color:blue}", "a{color:blue}"},
+		{"a{COLOR:red;color:blue}", "a{color:blue}"},
+		{"a{color:red!important;color:blue}", "a{color:red!important;color:blue}"},
+		{"a{color:red;color:blue!important}", "a{color:blue!important}"},
+		{"a{color:red;color:var(--x)}", "a{color:red;color:var(--x)}"},
+		{"a{display:-webkit-box;display:flex}", "a{display:-webkit-box;display:flex}"},
+		{"a{display:flex;display:-webkit-box}", "a{display:flex;display:-webkit-box}"},
+		{"a{height:100vh;height:100dvh}", "a{height:100vh;height:100dvh}"},
+		{"a{overflow-wrap:break-word;overflow-wrap:anywhere}", "a{overflow-wrap:break-word;overflow-wrap:anywhere}"},
+		{"a{font-family:a;font-family:b}", "a{font-family:a;font-family:b}"},
+		{"a{width:1px;width:2em}", "a{width:2em}"},
+		{"a{flex-grow:1;flex:auto}", "a{flex:auto}"},
+		{"a{column-gap:1px;grid:auto/auto}", "a{column-gap:1px;grid:auto/auto}"},
+		{"a{width:100px;width:calc(100% - 10px)}", "a{width:100px;width:calc(100% - 10px)}"},
+		{"a{color:#000;color:#0008}", "a{color:#000;color:#0008}"},
+		{"a{--x:1;--x:2}", "a{--x:2}"},
+		{"a{--x:1;--X:2}", "a{--x:1;--X:2}"},
+		{"a{margin-top:1px;margin:0}", "a{margin:0}"},
+		{"a{border-top-color:red;border:0}", "a{border:0}"},
+		{"a{line-height:2;font:12px serif}", "a{font:12px serif}"},
+		{"a{font-feature-settings:normal;font:12px serif}", "a{font-feature-settings:normal;font:12px serif}"},
+		{"a{margin:0;margin-top:4px}", "a{margin:4px 0 0}"},
+		{"a{margin:1px 2px;margin-left:3px}", "a{margin:1px 2px 1px 3px}"},
+		{"a{padding:0;color:red;padding-bottom:1px}", "a{color:red;padding:0 0 1px}"},
+		{"a{margin:0;margin-top:var(--x)}", "a{margin:0;margin-top:var(--x)}"},
+		{"a{margin:0;margin-top:4px!important}", "a{margin:0;margin-top:4px!important}"},
+		{"a{margin:0;margin-block-start:1px;margin-top:4px}", "a{margin:0;margin-block-start:1px;margin-top:4px}"},
+		{"a{margin-top:1px;margin-right:2px;margin-bottom:1px;margin-left:2px}", "a{margin:1px 2px}"},
+		{"a{margin-top:1px;color:red;margin-right:1px;margin-bottom:1px;margin-left:1px}", "a{color:red;margin:1px}"},
+		{"a{margin-top:1px;margin-block:0;margin-right:1px;margin-bottom:1px;margin-left:1px}", "a{margin-top:1px;margin-block:0;margin-right:1px;margin-bottom:1px;margin-left:1px}"},
+		{"a{margin-top:1px!important;margin-right:1px;margin-bottom:1px;margin-left:1px}", "a{margin-top:1px!important;margin-right:1px;margin-bottom:1px;margin-left:1px}"},
+		{"a{margin-top:1px!important;margin-right:1px!important;margin-bottom:1px!important;margin-left:1px!important}", "a{margin:1px!important}"},
+		{"a{margin-top:inherit;margin-right:1px;margin-bottom:1px;margin-left:1px}", "a{margin-top:inherit;margin-right:1px;margin-bottom:1px;margin-left:1px}"},
+		{"a{padding-top:0;padding-right:0;padding-bottom:0;padding-left:0}", "a{padding:0}"},
+		{"a{top:0;right:0;bottom:0;left:0}", "a{top:0;right:0;bottom:0;left:0}"}, // requires targets
+		{"a{border-top-width:1px;border-right-width:2px;border-bottom-width:1px;border-left-width:2px}", "a{border-width:1px 2px}"},
+		{"a{border-width:1px;border-style:solid;border-color:red}", "a{border-width:1px;border-style:solid;border-color:red}"}, // border resets border-image
+		{"a{border-width:1px 2px;border-style:solid;border-color:red}", "a{border-width:1px 2px;border-style:solid;border-color:red}"},
+		{"a{border-image:none;border-width:1px;border-style:solid;border-color:red}", "a{border-image:none;border-width:1px;border-style:solid;border-color:red}"},
+		{"a{border-width:1px;border-style:solid;border-color:red;border-image:none}", "a{border:1px solid red;border-image:none}"},
+		{"a{border-width:1px!important;border-style:solid!important;border-color:red!important;border-image:none}", "a{border-width:1px!important;border-style:solid!important;border-color:red!important;border-image:none}"},
+		{".a{border-image:url(x.png) 30 round}.a.b{border-width:1px;border-style:solid;border-color:red}", ".a{border-image:url(x.png)30 round}.a.b{border-width:1px;border-style:solid;border-color:red}"},
+		{"a{border-top-width:1px;border-top-style:solid;border-top-color:red}", "a{border-top:1px solid red}"},
+		{"a{border-top:1px solid red;border-right:1px solid red;border-bottom:1px solid red;border-left:1px solid red}", "a{border-top:1px solid red;border-right:1px solid red;border-bottom:1px solid red;border-left:1px solid red}"},
+		{"a{border-top:1px solid red;border-right:1px solid red;border-bottom:1px solid red;border-left:1px solid red;border-image:none}", "a{border:1px solid red;border-image:none}"},
+		{"a{border:1px solid red;border-color:blue;border-image:none}", "a{border:1px solid blue;border-image:none}"},
+		{"a{border:1px solid red;border-color:blue}", "a{border:1px solid red;border-color:blue}"}, // border resets border-image
+		{"a{border:1px solid red;border-image:url(x.png) 30;border-color:blue}", "a{border:1px solid red;border-image:url(x.png)30;border-color:blue}"},
+		{"a{border:1px;border-style:dashed;border-image:none}", "a{border:1px dashed;border-image:none}"},
+		{"a{border:1px solid red;border-width:1px 2px;border-image:none}", "a{border:1px solid red;border-width:1px 2px;border-image:none}"},
+		{"a{border-top:solid rgb(1, 2, 3);border-top-width:thin}", "a{border-top:thin solid #010203}"},
+		{"a{border-top:1px solid red;border-top-width:2px;border-top-color:blue}", "a{border-top:2px solid blue}"},
+		{"a{outline:1px solid red;outline-style:auto}", "a{outline:1px auto red}"},
+		{"a{outline-width:1px;outline-style:solid;outline-color:red}", "a{outline:1px solid red}"},
+		{"a{font-style:italic;font-variant:normal;font-weight:bold;font-stretch:normal;font-size:12px;line-height:1.5;font-family:Arial,sans-serif}", "a{font-style:italic;font-variant:normal;font-weight:700;font-stretch:normal;font-size:12px;line-height:1.5;font-family:Arial,sans-serif}"},
+		{"body{font-kerning:none;font-variant-ligatures:none}p{font-style:italic;font-variant:normal;font-weight:bold;font-stretch:normal;font-size:12px;line-height:1.5;font-family:Arial}", "body{font-kerning:none;font-variant-ligatures:none}p{font-style:italic;font-variant:normal;font-weight:700;font-stretch:normal;font-size:12px;line-height:1.5;font-family:Arial}"},
+		{"a{background-image:url(a.png);background-position:0 0;background-size:auto;background-repeat:no-repeat;background-attachment:scroll;background-origin:padding-box;background-clip:border-box;background-color:red}", "a{background:url(a.png)no-repeat red}"},
+		{"a{background-image:none;background-position:0 0;background-size:auto;background-repeat:repeat;background-attachment:scroll;background-origin:padding-box;background-clip:border-box;background-color:red}", "a{background:red}"},
+		{"a{background-image:url(a.png),none;background-position:0 0;background-size:auto;background-repeat:no-repeat;background-attachment:scroll;background-origin:padding-box;background-clip:border-box;background-color:red}", "a{background-image:url(a.png),none;background-position:0 0;background-size:auto;background-repeat:no-repeat;background-attachment:scroll;background-origin:padding-box;background-clip:border-box;background-color:red}"},
+		{"@font-face{src:url(a.woff);src:url(a.woff2)format('woff2')}", "@font-face{src:url(a.woff);src:url(a.woff2)format('woff2')}"},
+		{"@media print{a{color:red;color:blue}}", "@media print{a{color:blue}}"},
+		{"a{color:red;*color:blue;color:green}", "a{*color:blue;color:green}"},
+	}
+
+	m := minify.New()
+	o := &Minifier{MergeDeclarations: true}
+	for _, tt := range cssTests {
+		t.Run(tt.css, func(t *testing.T) {
+			r := bytes.NewBufferString(tt.css)
+			w := &bytes.Buffer{}
+			err := o.Minify(m, w, r, nil)
+			test.Minify(t, tt.css, err, w.String(), tt.expected)
+		})
+	}
+
+	inlineTests := []struct {
+		css      string
+		expected string
+	}{
+		{"margin:0;margin-left:1px;color:red;color:blue", "margin:0 0 0 1px;color:blue"},
+	}
+
+	params := map[string]string{"inline": "1"}
+	for _, tt := range inlineTests {
+		t.Run(tt.css, func(t *testing.T) {
+			r := bytes.NewBufferString(tt.css)
+			w := &bytes.Buffer{}
+			err := o.Minify(m, w, r, params)
+			test.Minify(t, tt.css, err, w.String(), tt.expected)
+		})
+	}
+
+	// together with merging rules
+	r := bytes.NewBufferString("a{color:red}a{color:blue}b{color:blue}")
+	w := &bytes.Buffer{}
+	err := (&Minifier{MergeRules: true, MergeDeclarations: true}).Minify(m, w, r, nil)
+	test.Minify(t, "a{color:red}a{color:blue}b{color:blue}", err, w.String(), "a,b{color:blue}")
+}
+
+func TestCSSFlattenNesting(t *testing.T) {
+	cssTests := []struct {
+		css      string
+		expected string
+	}{
+		{".card{&:hover{color:red}.title{font-weight:bold}}", ".card:hover{color:red}.card .title{font-weight:700}"},
+		{".a{color:red;.b{color:blue}color:green}", ".a{color:red}.a .b{color:blue}.a{color:green}"},
+		{".a{> .b{c:d}+ .e{f:g}}", ".a>.b{c:d}.a+.e{f:g}"},
+		{".a{.b{.c{d:e}}}", ".a .b .c{d:e}"},
+		{".a,.b{&:hover{c:d}}", ".a:hover,.b:hover{c:d}"},
+		{".a,.b{& + &{c:d}}", ".a+.a,.a+.b,.b+.a,.b+.b{c:d}"},
+		{".a,#b{&:hover{c:d}}", ":is(.a,#b):hover{c:d}"},
+		{".a .b{&.c{d:e}}", ".a .b.c{d:e}"},
+		{".a .b{.c &{d:e}}", ".c :is(.a .b){d:e}"},
+		{"div{.a&{b:c}}", ".a:is(div){b:c}"},
+		{"div{.a &{b:c}}", ".a div{b:c}"},
+		{".a::before{&:hover{b:c}}", ".a::before:hover{b:c}"},
+		{".a{@media print{b:c;.d{e:f}}}", "@media print{.a{b:c}.a .d{e:f}}"},
+		{".a{@supports (display:grid){display:grid}}", "@supports(display:grid){.a{display:grid}}"},
+		{"@media screen{.a{.b{c:d}}}", "@media screen{.a .b{c:d}}"},
+		{"a{b:c}", "a{b:c}"},
+	}
+
+	m := minify.New()
+	o := &Minifier{FlattenNesting: true}
+	for _, tt := range cssTests {
+		t.Run(tt.css, func(t *testing.T) {
+			r := bytes.NewBufferString(tt.css)
+			w := &bytes.Buffer{}
+			err := o.Minify(m, w, r, nil)
+			test.Minify(t, tt.css, err, w.String(), tt.expected)
+		})
+	}
+
+	targetsTests := []struct {
+		targets  Targets
+		css      string
+		expected string
+	}{
+		{Targets{Chrome: 120, Safari: 17.2}, ".a{.b{c:d}}", ".a{.b{c:d}}"},
+		{Targets{Chrome: 100}, ".a{.b{c:d}}", ".a .b{c:d}"},
+		{Targets{Chrome: 100}, ".a,#b{&:hover{c:d}}", ":is(.a,#b):hover{c:d}"},
+		{Targets{Chrome: 80}, ".a,#b{&:hover{c:d}}", ".a:hover,#b:hover{c:d}"},
+	}
+	for _, tt := range targetsTests {
+		t.Run(fmt.Sprint(tt.targets, tt.css), func(t *testing.T) {
+			r := bytes.NewBufferString(tt.css)
+			w := &bytes.Buffer{}
+			o := &Minifier{Targets: tt.targets}
+			err := o.Minify(m, w, r, nil)
+			test.Minify(t, tt.css, err, w.String(), tt.expected)
+		})
+	}
+}
+
+func TestCSSBundle(t *testing.T) {
+	var cssTests = []struct {
+		files    []string // entry point first, as name=content
+		expected string
+	}{
+		{[]string{`main.css=@import "a.css";b{color:red}`, `a.css=a{color:blue}`}, `a{color:blue}b{color:red}`},
+		{[]string{`main.css=@import url(a.css) print;`, `a.css=@import "b.css";a{x:y}`, `b.css=b{x:y}`}, `@media print{b{x:y}a{x:y}}`},
+		{[]string{`main.css=@import "a.css" layer(base) supports(display: grid) screen;`, `a.css=a{x:y}`}, `@media screen{@supports(display:grid){@layer base{a{x:y}}}}`},
+		{[]string{`main.css=@import "a.css" layer;`, `a.css=a{x:y}`}, `@layer{a{x:y}}`},
+		{[]string{`main.css=@charset "utf-8";@import "https://example.com/b.css";@import "sub/a.css";`, `sub/a.css=@import "//example.com/c.css";a{x:y}`}, `@charset "utf-8";@import "https://example.com/b.css";@import "//example.com/c.css";a{x:y}`},
+		{[]string{`main.css=@import "sub/a.css";`, `sub/a.css=a{background:url(b.png),url("../c.png?v=1"),url(/d.png),url(data:,e)}`}, `a{background:url(sub/b.png),url(c.png?v=1),url(/d.png),url(data:,e)}`},
+		{[]string{`main.css=@import "sub/a.css";m{x:y}`, `sub/a.css=@import "../main.css";a{x:y}`}, `a{x:y}m{x:y}`},
+		{[]string{`main.css=@import "sub/a.css";`, `sub/a.css=a{background:image-set("b.png" 1x,url(c.png) 2x,"d.avif" type("image/avif"))}`}, `a{background:image-set("sub/b.png" 1x,url(sub/c.png) 2x,"sub/d.avif" type("image/avif"))}`},
+		{[]string{`main.css=a{x:y}@import "a.css";`, `a.css=b{x:y}`}, `a{x:y}@import "a.css";`},
+	}
+
+	m := minify.New()
+	for _, tt := range cssTests {
+		t.Run(tt.files[0], func(t *testing.T) {
+			fsys := fstest.MapFS{}
+			for _, file := range tt.files {
+				name, data, _ := strings.Cut(file, "=")
+				fsys[name] = &fstest.MapFile{Data: []byte(data)}
+			}
+			w := &bytes.Buffer{}
+			err := (&Minifier{}).Bundle(m, w, fsys, "", "main.css")
+			test.Error(t, err)
+			test.String(t, w.String(), tt.expected)
+		})
+	}
+
+	// output in another directory and multiple entry points
+	fsys := fstest.MapFS{
+		"main.css":  &fstest.MapFile{Data: []byte(`@charset "utf-8";@import "sub/a.css";m{background:url(m.png)}`)},
+		"sub/a.css": &fstest.MapFile{Data: []byte(`a{background:url(a.png)}`)},
+		"b.css":     &fstest.MapFile{Data: []byte(`@charset "utf-8";@import "https://example.com/c.css";b{x:y}`)},
+	}
+	w := &bytes.Buffer{}
+	err := (&Minifier{}).Bundle(m, w, fsys, "sub/out.css", "main.css")
+	test.Error(t, err)
+	test.String(t, w.String(), `@charset "utf-8";a{background:url(a.png)}m{background:url(../m.png)}`)
+
+	w.Reset()
+	err = (&Minifier{}).Bundle(m, w, fsys, "", "main.css", "sub/a.css")
+	test.Error(t, err)
+	test.String(t, w.String(), `@charset "utf-8";a{background:url(sub/a.png)}m{background:url(m.png)}a{background:url(sub/a.png)}`)
+
+	err = (&Minifier{}).Bundle(m, w, fsys, "", "main.css", "b.css")
+	test.T(t, fmt.Sprint(err), "b.css: cannot move import of https://example.com/c.css before the rules of preceding stylesheets")
+}
+
+func TestCSSBundleErrors(t *testing.T) {
+	var cssTests = []struct {
+		files []string
+		err   string
+	}{
+		{[]string{`main.css=@import "nope.css";`}, "main.css: cannot resolve nope.css"},
+		{[]string{`main.css=@import "a.css" print;`, `a.css=@import "https://example.com/b.css";`}, "a.css: cannot move import of https://example.com/b.css out of the conditions of its stylesheet"},
+		{[]string{`main.css=@import "a.css";@import "https://example.com/b.css";`, `a.css=a{x:y}`}, "main.css: cannot move import of https://example.com/b.css before the rules of preceding stylesheets"},
+	}
+
+	m := minify.New()
+	for _, tt := range cssTests {
+		t.Run(tt.files[0], func(t *testing.T) {
+			fsys := fstest.MapFS{}
+			for _, file := range tt.files {
+				name, data, _ := strings.Cut(file, "=")
+				fsys[name] = &fstest.MapFile{Data: []byte(data)}
+			}
+			err := (&Minifier{}).Bundle(m, &bytes.Buffer{}, fsys, "", "main.css")
+			test.T(t, fmt.Sprint(err), tt.err)
+		})
+	}
+}
+
+func TestCSSPurge(t *testing.T) {
+	var cssTests = []struct {
+		css      string
+		expected string
+	}{
+		{`.used{x:y}.unused{x:y}`, `.used{x:y}`},
+		{`.used,.unused{x:y}`, `.used{x:y}`},
+		{`#main{x:y}#other{x:y}`, `#main{x:y}`},
+		{`div{x:y}span{x:y}html,body{x:y}`, `div{x:y}html,body{x:y}`},
+		{`DIV p{x:y}div>.used{x:y}div .unused{x:y}`, `div p{x:y}div>.used{x:y}`},
+		{`[data-x]{x:y}[data-y]{x:y}[href^="/"]{x:y}`, `[data-x]{x:y}[href^="/"]{x:y}`},
+		{`.used:hover{x:y}.used::before{x:y}.unused:hover{x:y}:root{x:y}*{x:y}`, `.used:hover{x:y}.used::before{x:y}:root{x:y}*{x:y}`},
+		{`:is(.used,.unused) a{x:y}:is(.unused) a{x:y}:not(.unused){x:y}div:has(>.unused){x:y}`, `:is(.used,.unused) a{x:y}:not(.unused){x:y}`},
+		{`.md\:flex{x:y}.w-1\/2{x:y}.\31 0{x:y}.lg\:flex{x:y}`, `.md\:flex{x:y}.w-1\/2{x:y}.\31 0{x:y}`},
+		{`.js-toggle{x:y}.js-other{x:y}.svg-icon{x:y}circle{x:y}`, `.js-toggle{x:y}.svg-icon{x:y}circle{x:y}`},
+		{`@media print{.unused{x:y}}@media screen{.used{x:y}}`, `@media screen{.used{x:y}}`},
+		{`@layer base{.unused{x:y}}@media print{@layer base{.used{x:y}}}`, `@media print{@layer base{.used{x:y}}}`},
+		{`.used{x:y;.unused{x:y}&:hover{x:y}}`, `.used{x:y;&:hover{x:y}}`},
+		{`@keyframes spin{to{x:y}}@keyframes fade{to{x:y}}.used{animation:spin 1s}.unused{animation:fade 1s}`, `@keyframes spin{to{x:y}}.used{animation:spin 1s}`},
+		{`@font-face{font-family:"Open Sans";src:url(a.woff)}@font-face{font-family:Mono;src:url(b.woff)}.used{font:12px 'open sans',sans-serif}`, `@font-face{font-family:open sans;src:url(a.woff)}.used{font:12px open sans,sans-serif}`},
+		{`@font-face{font-family:Bar;src:url(a.woff)}@font-face{font-family:A;src:url(b.woff)}:root{--gap:1px}.used{margin:var(--gap);font-family:Arial}`, `:root{--gap:1px}.used{margin:var(--gap);font-family:Arial}`},
+		{`@font-face{font-family:Bar;src:url(a.woff)}@font-face{font-family:Baz;src:url(b.woff)}:root{--font:"Bar",serif}.used{font:bold 1em/2 var(--font)}`, `@font-face{font-family:Bar;src:url(a.woff)}:root{--font:"Bar",serif}.used{font:700 1em/2 var(--font)}`},
+		{`:root{--a:1px;--b:var(--c);--c:2px;--d:3px}.used{margin:var(--a)}.unused{padding:var(--d)}`, `:root{--a:1px}.used{margin:var(--a)}`},
+		{`:root{--a:1px}@property --a{syntax:"*"}.used{x:y}`, `.used{x:y}`},
+		{`:root{--theme:red}.used{x:y}`, `:root{--theme:red}.used{x:y}`},
+		{`.safe{x:y}.safe-1{x:y}.unsafe{x:y}`, `.safe{x:y}.safe-1{x:y}`},
+	}
+
+	usage := NewUsage()
+	test.Error(t, usage.AddHTML(strings.NewReader(`<!doctype html><DIV id="main" class="used  md:flex w-1/2 10" data-x><p><a href="/">x</a></p><svg class="svg-icon"><circle r="1"/></svg><script>el.classList.add("js-toggle")</script></DIV>`)))
+	test.Error(t, usage.AddText(strings.NewReader(`document.body.style.setProperty('--theme', 'blue')`)))
+	usage.Safelist = []string{"safe"}
+	usage.SafelistRegexps = []*regexp.Regexp{regexp.MustCompile(`^safe-`)}
+
+	m := minify.New()
+	o := &Minifier{Purge: usage}
+	for _, tt := range cssTests {
+		t.Run(tt.css, func(t *testing.T) {
+			r := bytes.NewBufferString(tt.css)
+			w := &bytes.Buffer{}
+			err := o.Minify(m, w, r, nil)
+			test.Minify(t, tt.css, err, w.String(), tt.expected)
+		})
+	}
+}
+
+func TestCSSVars(t *testing.T) {
+	var cssTests = []struct {
+		css      string
+		expected string
+	}{
+		{`:root{--a:1px;--b:var(--c);--c:2px;--d:var(--e);--e:3px}a{margin:var(--a)}`, `:root{--a:1px}a{margin:var(--a)}`},
+		{`:root{--a:1px;--b:2px}@keyframes k{to{margin:var(--b)}}`, `:root{--b:2px}@keyframes k{to{margin:var(--b)}}`},
+		{`a{--unused:1px}b{x:y}`, `b{x:y}`},
+		{`@media print{a{--unused:1px}}`, ``},
+	}
+
+	m := minify.New()
+	o := &Minifier{RemoveUnusedVars: true}
+	for _, tt := range cssTests {
+		t.Run(tt.css, func(t *testing.T) {
+			r := bytes.NewBufferString(tt.css)
+			w := &bytes.Buffer{}
+			err := o.Minify(m, w, r, nil)
+			test.Minify(t, tt.css, err, w.String(), tt.expected)
+		})
+	}
+}
+
+func TestCSSRenameVars(t *testing.T) {
+	var cssTests = []struct {
+		css      string
+		expected string
+	}{
+		{`:root{--brand-color:red;--spacing:4px}a{color:var(--brand-color);margin:var(--spacing) calc(2*var(--spacing))}`, `:root{--b:red;--a:4px}a{color:var(--b);margin:var(--a)calc(2*var(--a))}`},
+		{`b{color:var(--brand-color,var(--fallback-color))}`, `b{color:var(--b,var(--c))}`},
+		{`:root{--a:1px;--x:var(--a)}`, `:root{--d:1px;--x:var(--d)}`},
+		{`c{content:"--brand-color";--brand-color:blue}`, `c{content:"--brand-color";--b:blue}`},
+	}
+
+	m := minify.New()
+	names := NewVarNames()
+	o := &Minifier{RenameVars: names}
+	for _, tt := range cssTests {
+		t.Run(tt.css, func(t *testing.T) {
+			r := bytes.NewBufferString(tt.css)
+			w := &bytes.Buffer{}
+			err := o.Minify(m, w, r, nil)
+			test.Minify(t, tt.css, err, w.String(), tt.expected)
+		})
+	}
+	test.T(t, names.Vars, map[string]string{"--brand-color": "--b", "--spacing": "--a", "--fallback-color": "--c", "--a": "--d", "--x": "--x"})
+
+	w := &bytes.Buffer{}
+	err := (&Minifier{Inline: true, RenameVars: names}).Minify(m, w, bytes.NewBufferString(`color:var(--brand-color)`), nil)
+	test.Minify(t, `color:var(--brand-color)`, err, w.String(), `color:var(--b)`)
+}
+
+func TestCSSRewriteURL(t *testing.T) {
+	var cssTests = []struct {
+		css      string
+		expected string
+	}{
+		{`a{background:url(a.png)}`, `a{background:url(https://cdn.example.com/a.png)}`},
+		{`a{background:url( "b c.png" )}`, `a{background:url("https://cdn.example.com/b c.png")}`},
+		{`a{background:url('a"b.png')}`, `a{background:url('https://cdn.example.com/a"b.png')}`},
+		{`a{background:url("quote'.png")}`, `a{background:url("https://cdn.example.com/quote'.png")}`},
+		{`a{background:url(data:,x),url(#a)}`, `a{background:url(data:,x),url(#a)}`},
+		{`@import "a.css";`, `@import "https://cdn.example.com/a.css";`},
+		{`@import url(a.css) print;`, `@import "https://cdn.example.com/a.css" print;`},
+		{`@font-face{src:url(f.woff2)format("woff2")}`, `@font-face{src:url(https://cdn.example.com/f.woff2)format("woff2")}`},
+	}
+
+	m := minify.New()
+	m.RewriteURL = func(mediatype, url string) (string, error) {
+		if mediatype != "text/css" {
+			return "", fmt.Errorf("unexpected mediatype %s", mediatype)
+		} else if url == "error.png" {
+			return "", fmt.Errorf("cannot rewrite %s", url)
+		}
+		return "https://cdn.example.com/" + url, nil
+	}
+	for _, tt := range cssTests {
+		t.Run(tt.css, func(t *testing.T) {
+			r := bytes.NewBufferString(tt.css)
+			w := &bytes.Buffer{}
+			err := Minify(m, w, r, nil)
+			test.Minify(t, tt.css, err, w.String(), tt.expected)
+		})
+	}
+
+	err := Minify(m, &bytes.Buffer{}, bytes.NewBufferString(`a{background:url(error.png)}`), nil)
+	test.T(t, fmt.Sprint(err), "cannot rewrite error.png")
+}
+
+func TestCSSTargets(t *testing.T) {
+	modern := Targets{Chrome: 90, Firefox: 90, Safari: 14.1, IOS: 14.5}
+	old := Targets{Chrome: 90, IE: 11}
+	cssTests := []struct {
+		targets  Targets
+		css      string
+		expected string
+	}{
+		{Targets{}, "a{color:rgba(255,0,0,.5)}", "a{color:rgba(255,0,0,.5)}"},
+		{modern, "a{color:rgba(255,0,0,.5)}", "a{color:#ff000080}"},
+		{modern, "a{--f:#11223344}", "a{--f:#1234}"},
+		{old, "a{--f:#11223344}", "a{--f:#11223344}"},
+		{modern, "a{color:rgba(255,0,0,20%)}", "a{color:#f003}"},
+		{modern, "a{color:rgba(100%,0%,0%,.5)}", "a{color:#ff000080}"},
+		{modern, "a{color:hsla(0,100%,50%,.2)}", "a{color:#f003}"},
+		{modern, "a{color:rgba(255,0,0,1)}", "a{color:red}"},
+		{modern, "a{color:rgba(0,0,0,0)}", "a{color:transparent}"},
+		{old, "a{color:rgba(255,0,0,.5)}", "a{color:rgba(255,0,0,.5)}"},
+		{Targets{Safari: 9}, "a{color:rgba(255,0,0,.5)}", "a{color:rgba(255,0,0,.5)}"},
+		{Targets{Safari: 10}, "a{color:rgba(255,0,0,.5)}", "a{color:#ff000080}"},
+		{Targets{}, "a{color:color(srgb 1 0 0/.5)}", "a{color:color(srgb 1 0 0/.5)}"},
+		{modern, "a{color:color(srgb 1 0 0/.5)}", "a{color:#ff000080}"},
+		{modern, "a{color:color-mix(in srgb,red 20%,transparent)}", "a{color:#f003}"},
+		{modern, "a{color:color-mix(in oklab,#fff 40%,#000 40%)}", "a{color:#636363cc}"},
+	}
+
+	m := minify.New()
+	for _, tt := range cssTests {
+		t.Run(fmt.Sprint(tt.targets, tt.css), func(t *testing.T) {
+			r := bytes.NewBufferString(tt.css)
+			w := &bytes.Buffer{}
+			o := &Minifier{Targets: tt.targets}
+			err := o.Minify(m, w, r, nil)
+			test.Minify(t, tt.css, err, w.String(), tt.expected)
+		})
+	}
+
+	mergeTests := []struct {
+		targets  Targets
+		css      string
+		expected string
+	}{
+		{modern, "a{top:0;right:0;bottom:0;left:0}", "a{inset:0}"},
+		{modern, "a{inset:0;left:1px}", "a{inset:0 0 0 1px}"},
+		{Targets{Chrome: 80}, "a{top:0;right:0;bottom:0;left:0}", "a{top:0;right:0;bottom:0;left:0}"},
+		{old, "a{top:0;right:0;bottom:0;left:0}", "a{top:0;right:0;bottom:0;left:0}"},
+	}
+	for _, tt := range mergeTests {
+		t.Run(fmt.Sprint(tt.targets, tt.css), func(t *testing.T) {
+			r := bytes.NewBufferString(tt.css)
+			w := &bytes.Buffer{}
+			o := &Minifier{MergeDeclarations: true, Targets: tt.targets}
+			err := o.Minify(m, w, r, nil)
+			test.Minify(t, tt.css, err, w.String(), tt.expected)
+		})
+	}
+}
+
+func TestParseTargets(t *testing.T) {
+	targetsTests := []struct {
+		targets  string
+		expected Targets
+	}{
+		{"", Targets{}},
+		{"chrome>=90,safari>=14", Targets{Chrome: 90, Safari: 14}},
+		{" Firefox >= 78 , ios_saf>=14.5, ie>=11", Targets{Firefox: 78, IOS: 14.5, IE: 11}},
+		{"edge>=88,opera>=74,samsung>=13.2,ios>=12", Targets{Edge: 88, Opera: 74, Samsung: 13.2, IOS: 12}},
+	}
+	for _, tt := range targetsTests {
+		t.Run(tt.targets, func(t *testing.T) {
+			targets, err := ParseTargets(tt.targets)
+			test.Error(t, err)
+			test.T(t, targets, tt.expected)
+		})
+	}
+
+	errorTests := []string{"chrome", "chrome>=", "chrome>=x", "chrome>=0", "netscape>=4"}
+	for _, tt := range errorTests {
+		t.Run(tt, func(t *testing.T) {
+			_, err := ParseTargets(tt)
+			test.That(t, err != nil, "must return error")
+		})
+	}
+}
+
+type legalCommentsWriter struct {
+	bytes.Buffer
+	comments string
+}
+
+func (w *legalCommentsWriter) WriteLegalComments(b []byte) (string, error) {
+	w.comments = string(b)
+	return "out.css.LICENSE.txt", nil
+}
+
+func TestCSSLegalComments(t *testing.T) {
+	cssTests := []struct {
+		mode     minify.LegalComments
+		css      string
+		expected string
+		comments string
+	}{
+		{minify.LegalCommentsInline, `/*! a */ a{x:y} /* b */ /* @license c */`, `/*!a*/a{x:y}/* @license c*/`, ``},
+		{minify.LegalCommentsInline, `/* @preserve d */`, `/* @preserve d*/`, ``},
+		{minify.LegalCommentsNone, `/*! a */ a{x:y} /* @license c */`, `a{x:y}`, ``},
+		{minify.LegalCommentsEOF, `/*! a */ a{x:y} /* @license c */ /*! a */`, "a{x:y}\n/*! a */\n/* @license c */", ``},
+		{minify.LegalCommentsExternal, `/*! a */ a{x:y} /* @license c */`, "a{x:y}\n/*! For license information please see out.css.LICENSE.txt */", "/*! a */\n/* @license c */\n"},
+		{minify.LegalCommentsExternal, `a{x:y}`, `a{x:y}`, ``},
+	}
+
+	m := minify.New()
+	for _, tt := range cssTests {
+		t.Run(fmt.Sprint(tt.mode, tt.css), func(t *testing.T) {
+			r := bytes.NewBufferString(tt.css)
+			w := &legalCommentsWriter{}
+			o := &Minifier{LegalComments: tt.mode}
+			err := o.Minify(m, w, r, nil)
+			test.Minify(t, tt.css, err, w.String(), tt.expected)
+			test.String(t, w.comments, tt.comments)
+		})
+	}
+}
+
 func TestReaderErrors(t *testing.T) {
 	r := test.NewErrorReader(0)
 	w := &bytes.Buffer{}
@@ -0,0 +1,590 @@
+package css
+
+import (
+	"bytes"
+	"slices"
+	"strings"
+
+	"github.com/tdewolff/minify/v2"
+	"github.com/tdewolff/parse/v2"
+	"github.com/tdewolff/parse/v2/css"
+)
+
+// shorthand is a shorthand property that can replace a complete set of longhands.
+type shorthand struct {
+	name      string
+	longhands []string
+	resets    []string              // properties that are reset by the shorthand but cannot be set by it, which must be declared after the longhands
+	box       bool                  // whether the values are given for the top, right, bottom and left sides
+	value     func([][]byte) []byte // returns the shorthand value for the longhand values, or nil if they cannot be combined
+}
+
+// shorthands are ordered such that the shorthands for sides and components of borders come before border. The font shorthand is not used as it resets many properties that it cannot set, such as font-kerning and font-variant-ligatures, which may be set explicitly or inherited from elsewhere.
+var shorthands = []shorthand{
+	{name: "margin", longhands: []string{"margin-top", "margin-right", "margin-bottom", "margin-left"}, box: true},
+	{name: "padding", longhands: []string{"padding-top", "padding-right", "padding-bottom", "padding-left"}, box: true},
+	{name: "inset", longhands: []string{"top", "right", "bottom", "left"}, box: true},
+	{name: "border-width", longhands: []string{"border-top-width", "border-right-width", "border-bottom-width", "border-left-width"}, box: true},
+	{name: "border-style", longhands: []string{"border-top-style", "border-right-style", "border-bottom-style", "border-left-style"}, box: true},
+	{name: "border-color", longhands: []string{"border-top-color", "border-right-color", "border-bottom-color", "border-left-color"}, box: true},
+	{name: "border-top", longhands: []string{"border-top-width", "border-top-style", "border-top-color"}, value: joinValues},
+	{name: "border-right", longhands: []string{"border-right-width", "border-right-style", "border-right-color"}, value: joinValues},
+	{name: "border-bottom", longhands: []string{"border-bottom-width", "border-bottom-style", "border-bottom-color"}, value: joinValues},
+	{name: "border-left", longhands: []string{"border-left-width", "border-left-style", "border-left-color"}, value: joinValues},
+	{name: "border", longhands: []string{"border-width", "border-style", "border-color"}, resets: []string{"border-image"}, value: joinValues},
+	{name: "border", longhands: []string{"border-top", "border-right", "border-bottom", "border-left"}, resets: []string{"border-image"}, value: equalValues},
+	{name: "outline", longhands: []string{"outline-width", "outline-style", "outline-color"}, value: joinValues},
+	{name: "background", longhands: []string{"background-image", "background-position", "background-size", "background-repeat", "background-attachment", "background-origin", "background-clip", "background-color"}, value: backgroundValue},
+}
+
+// cssKeywords are the keywords and color names of CSS 2.1 and the extended color names of CSS 3, which are supported by all browsers. Other keywords may be used with a fallback for browsers that do not support them, such as overflow-wrap:break-word;overflow-wrap:anywhere.
+var cssKeywords = map[string]bool{}
+
+func init() {
+	for _, keyword := range strings.Fields(`absolute always aqua armenian auto avoid baseline bidi-override black blink block blue bold bolder both bottom capitalize center circle collapse crosshair cursive dashed decimal decimal-leading-zero default disc dotted double e-resize embed fantasy fixed fuchsia georgian gray green groove help hidden hide inherit inline inline-block inline-table inset inside italic justify large larger left lighter lime line-through list-item lower-alpha lower-greek lower-latin lower-roman lowercase ltr maroon medium middle monospace move n-resize navy ne-resize no-repeat none normal nowrap nw-resize oblique olive orange outset outside overline pointer pre pre-line pre-wrap progress purple red relative repeat repeat-x repeat-y ridge right rtl s-resize sans-serif scroll se-resize separate serif show silver small small-caps smaller solid square static sub super sw-resize table table-caption table-cell table-column table-column-group table-footer-group table-header-group table-row table-row-group teal text text-bottom text-top thick thin top transparent underline upper-alpha upper-latin upper-roman uppercase visible w-resize wait white x-large x-small xx-large xx-small yellow`) {
+		cssKeywords[keyword] = true
+	}
+	for _, name := range ShortenColorHex {
+		cssKeywords[string(name)] = true
+	}
+}
+
+// overrides returns true if the later property sets all values of the earlier property, either because they are the same or because the later property is a shorthand of the earlier property.
+func overrides(later, earlier string) bool {
+	if later == earlier {
+		return true
+	} else if hash := ToHash([]byte(earlier)); hash != 0 && slices.Contains(PropertyOverrides[ToHash([]byte(later))], hash) {
+		return true
+	}
+	for _, sh := range shorthands {
+		if sh.name == later {
+			for _, longhand := range sh.longhands {
+				if overrides(longhand, earlier) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// declMerger removes overridden declarations and merges longhands into shorthands within a block.
+type declMerger struct {
+	m *minify.M
+	o *Minifier // minifier for the values of new shorthands
+}
+
+// mergeDecls merges the declarations of all rulesets in the tree.
+func (d declMerger) mergeDecls(rules []*rule) {
+	for _, r := range rules {
+		if r.kind == rulesetRule && r.hasOnlyDecls() {
+			r.children = d.mergeBlock(r.children)
+		} else if r.kind == rulesetRule || r.kind == atRule {
+			d.mergeDecls(r.children)
+		}
+	}
+}
+
+// mergeBlock removes declarations that are overridden later in the block, and replaces complete sets of longhands by their shorthand. Declarations are only removed if the overriding value is supported by all browsers, so that fallback values are kept.
+func (d declMerger) mergeBlock(decls []*rule) []*rule {
+	decls = removeOverridden(decls)
+	for _, sh := range shorthands {
+		if sh.name == "inset" && !d.o.Targets.supports(insetProperty) {
+			continue
+		}
+		if sh.box {
+			decls = d.mergeIntoBox(decls, sh)
+		} else {
+			decls = d.mergeIntoComponents(decls, sh)
+		}
+		decls = d.mergeLonghands(decls, sh)
+	}
+	return removeOverridden(decls)
+}
+
+func declName(r *rule) string {
+	if bytes.HasPrefix(r.name, []byte("--")) {
+		return string(r.name)
+	}
+	return strings.ToLower(string(r.name))
+}
+
+// declValue returns the value of a declaration without !important.
+func declValue(r *rule) ([]byte, bool) {
+	if len(importantBytes) <= len(r.data) && parse.EqualFold(r.data[len(r.data)-len(importantBytes):], importantBytes) {
+		return parse.TrimWhitespace(r.data[:len(r.data)-len(importantBytes)]), true
+	}
+	return r.data, false
+}
+
+// removeOverridden removes declarations that are overridden by a later declaration of the same property or of a shorthand, taking into account !important.
+func removeOverridden(decls []*rule) []*rule {
+	n := 0
+	for i, decl := range decls {
+		name := declName(decl)
+		value, important := declValue(decl)
+		overridden := false
+		for _, later := range decls[i+1:] {
+			laterValue, laterImportant := declValue(later)
+			if important && !laterImportant || !overrides(declName(later), name) {
+				continue
+			} else if strings.HasPrefix(name, "--") || supportedValue(laterValue) && knownKeywords(laterValue) && !hasVendorPrefix(value) {
+				overridden = true
+				break
+			}
+		}
+		if !overridden {
+			decls[n] = decl
+			n++
+		}
+	}
+	return decls[:n]
+}
+
+// longhandIndices returns the indices of the longhands, or false if any longhand is missing or occurs more than once.
+func longhandIndices(decls []*rule, longhands []string) ([]int, bool) {
+	indices := make([]int, len(longhands))
+	for j, longhand := range longhands {
+		indices[j] = -1
+		for i, decl := range decls {
+			if declName(decl) == longhand {
+				if indices[j] != -1 {
+					return nil, false
+				}
+				indices[j] = i
+			}
+		}
+		if indices[j] == -1 {
+			return nil, false
+		}
+	}
+	return indices, true
+}
+
+// canMerge returns true if the declarations at the given indices can be merged into the shorthand at the position of the last declaration, which requires that they have the same importance, that their values are supported by all browsers, and that no declarations in between interact with them. Properties that are reset by the shorthand must be declared after it in the same block, since their values may otherwise come from other rules.
+func canMerge(decls []*rule, indices []int, sh shorthand) bool {
+	_, important := declValue(decls[indices[0]])
+	first, last := indices[0], indices[0]
+	for _, i := range indices {
+		value, valueImportant := declValue(decls[i])
+		if valueImportant != important || !supportedValue(value) || isGlobalValue(value) {
+			return false
+		}
+		first, last = min(first, i), max(last, i)
+	}
+	for i := 0; i < last; i++ {
+		if slices.Contains(indices, i) {
+			continue
+		}
+		name := declName(decls[i])
+		if first < i {
+			for _, j := range indices {
+				if propertiesInteract(decls[i].name, decls[j].name) {
+					return false
+				}
+			}
+		}
+		for _, reset := range sh.resets {
+			if strings.HasPrefix(name, reset) {
+				return false
+			}
+		}
+	}
+	for _, reset := range sh.resets {
+		set := false
+		for _, decl := range decls[last+1:] {
+			if _, resetImportant := declValue(decl); (resetImportant || !important) && overrides(declName(decl), reset) {
+				set = true
+				break
+			}
+		}
+		if !set {
+			return false
+		}
+	}
+	return true
+}
+
+// mergeLonghands replaces a complete set of longhands by their shorthand.
+func (d declMerger) mergeLonghands(decls []*rule, sh shorthand) []*rule {
+	indices, ok := longhandIndices(decls, sh.longhands)
+	if !ok || !canMerge(decls, indices, sh) {
+		return decls
+	}
+
+	values := make([][]byte, len(indices))
+	for j, i := range indices {
+		values[j], _ = declValue(decls[i])
+	}
+	var value []byte
+	if sh.box {
+		value = boxValue(values)
+	} else {
+		value = sh.value(values)
+	}
+	if value == nil {
+		return decls
+	}
+	return d.replace(decls, indices, sh.name, value)
+}
+
+// mergeIntoBox merges longhands into a preceding shorthand of the same box property, such as margin:0;margin-top:4px.
+func (d declMerger) mergeIntoBox(decls []*rule, sh shorthand) []*rule {
+	k := -1
+	for i, decl := range decls {
+		if declName(decl) == sh.name {
+			if k != -1 {
+				return decls
+			}
+			k = i
+		}
+	}
+	if k == -1 {
+		return decls
+	}
+
+	value, _ := declValue(decls[k])
+	sides := splitValues(value)
+	if !supportedValue(value) || isGlobalValue(value) {
+		return decls
+	}
+	switch len(sides) {
+	case 1:
+		sides = [][]byte{sides[0], sides[0], sides[0], sides[0]}
+	case 2:
+		sides = [][]byte{sides[0], sides[1], sides[0], sides[1]}
+	case 3:
+		sides = [][]byte{sides[0], sides[1], sides[2], sides[1]}
+	case 4:
+	default:
+		return decls
+	}
+
+	indices := []int{k}
+	for j, longhand := range sh.longhands {
+		found := false
+		for i := k + 1; i < len(decls); i++ {
+			if declName(decls[i]) == longhand {
+				if found {
+					return decls // longhand occurs more than once
+				}
+				found = true
+				sides[j], _ = declValue(decls[i])
+				indices = append(indices, i)
+			}
+		}
+	}
+	if len(indices) == 1 || !canMerge(decls, indices, sh) {
+		return decls
+	} else if value = boxValue(sides); value == nil {
+		return decls
+	}
+	return d.replace(decls, indices, sh.name, value)
+}
+
+// borderStyles are the values of border-style and outline-style.
+var borderStyles = map[string]bool{"none": true, "hidden": true, "dotted": true, "dashed": true, "solid": true, "double": true, "groove": true, "ridge": true, "inset": true, "outset": true, "auto": true}
+
+// componentKind returns the longhand suffix of a component of a border or outline value, which is either -width, -style or -color.
+func componentKind(component []byte) string {
+	z := parse.NewInputBytes(component)
+	defer z.Restore()
+
+	l := css.NewLexer(z)
+	switch tt, data := l.Next(); tt {
+	case css.NumberToken, css.DimensionToken:
+		return "-width"
+	case css.IdentToken:
+		if ident := strings.ToLower(string(data)); ident == "thin" || ident == "medium" || ident == "thick" {
+			return "-width"
+		} else if borderStyles[ident] {
+			return "-style"
+		}
+	}
+	return "-color"
+}
+
+// mergeIntoComponents merges width, style and color longhands into a preceding shorthand, such as border:1px solid red;border-color:blue. The components of the shorthand are recognized by their values, and omitted components keep their initial value.
+func (d declMerger) mergeIntoComponents(decls []*rule, sh shorthand) []*rule {
+	kinds := make([]string, len(sh.longhands))
+	for j, longhand := range sh.longhands {
+		kind, ok := strings.CutPrefix(longhand, sh.name)
+		if !ok || kind != "-width" && kind != "-style" && kind != "-color" {
+			return decls
+		}
+		kinds[j] = kind
+	}
+
+	k := -1
+	for i, decl := range decls {
+		if declName(decl) == sh.name {
+			if k != -1 {
+				return decls
+			}
+			k = i
+		}
+	}
+	if k == -1 {
+		return decls
+	}
+
+	value, _ := declValue(decls[k])
+	if !supportedValue(value) || isGlobalValue(value) {
+		return decls
+	}
+	components := make([][]byte, len(kinds))
+	for _, component := range splitValues(value) {
+		j := slices.Index(kinds, componentKind(component))
+		if j == -1 || components[j] != nil {
+			return decls
+		}
+		components[j] = component
+	}
+
+	indices := []int{k}
+	for j, longhand := range sh.longhands {
+		found := false
+		for i := k + 1; i < len(decls); i++ {
+			if declName(decls[i]) == longhand {
+				if found {
+					return decls // longhand occurs more than once
+				}
+				found = true
+				components[j], _ = declValue(decls[i])
+				if len(splitValues(components[j])) != 1 {
+					return decls
+				}
+				indices = append(indices, i)
+			}
+		}
+	}
+	if len(indices) == 1 || !canMerge(decls, indices, sh) {
+		return decls
+	}
+
+	value = value[:0:0]
+	for _, component := range components {
+		if component != nil {
+			if 0 < len(value) {
+				value = append(value, ' ')
+			}
+			value = append(value, component...)
+		}
+	}
+	return d.replace(decls, indices, sh.name, value)
+}
+
+// replace removes the declarations at the given indices and inserts the shorthand at the position of the last one.
+func (d declMerger) replace(decls []*rule, indices []int, name string, value []byte) []*rule {
+	_, important := declValue(decls[indices[0]])
+	last := indices[0]
+	for _, i := range indices {
+		last = max(last, i)
+	}
+	value = d.minifyValue(name, value, important)
+
+	n := 0
+	for i, decl := range decls {
+		if i == last {
+			decls[n] = &rule{kind: declRule, name: []byte(name), data: value}
+			n++
+		} else if !slices.Contains(indices, i) {
+			decls[n] = decl
+			n++
+		}
+	}
+	return decls[:n]
+}
+
+// minifyValue minifies the value of a new shorthand.
+func (d declMerger) minifyValue(name string, value []byte, important bool) []byte {
+	if important {
+		value = append(append(value, ' '), importantBytes...)
+	}
+	decl := append(append([]byte(name), ':'), value...)
+	w := &bytes.Buffer{}
+	if err := d.o.Minify(d.m, w, bytes.NewReader(decl), nil); err != nil || !bytes.HasPrefix(w.Bytes(), decl[:len(name)+1]) || bytes.IndexByte(w.Bytes(), ';') != -1 {
+		return value
+	}
+	return w.Bytes()[len(name)+1:]
+}
+
+func joinValues(values [][]byte) []byte {
+	for _, value := range values {
+		if len(splitValues(value)) != 1 {
+			return nil
+		}
+	}
+	return bytes.Join(values, spaceBytes)
+}
+
+func equalValues(values [][]byte) []byte {
+	for _, value := range values[1:] {
+		if !bytes.Equal(value, values[0]) {
+			return nil
+		}
+	}
+	return values[0]
+}
+
+// boxValue returns the shortest value for the top, right, bottom and left sides.
+func boxValue(sides [][]byte) []byte {
+	for _, side := range sides {
+		if len(splitValues(side)) != 1 {
+			return nil
+		}
+	}
+	if bytes.Equal(sides[1], sides[3]) {
+		sides = sides[:3]
+		if bytes.Equal(sides[0], sides[2]) {
+			sides = sides[:2]
+			if bytes.Equal(sides[0], sides[1]) {
+				sides = sides[:1]
+			}
+		}
+	}
+	return bytes.Join(sides, spaceBytes)
+}
+
+// backgroundValue returns the background shorthand for a single layer.
+func backgroundValue(values [][]byte) []byte {
+	for _, value := range values {
+		if bytes.IndexByte(value, ',') != -1 {
+			return nil
+		}
+	}
+	image, position, size, repeat, attachment, origin, clip, color := values[0], values[1], values[2], values[3], values[4], values[5], values[6], values[7]
+	value := append([]byte{}, image...)
+	value = append(append(value, ' '), position...)
+	value = append(append(value, '/'), size...)
+	if !bytes.EqualFold(repeat, []byte("repeat")) {
+		value = append(append(value, ' '), repeat...)
+	}
+	value = append(append(value, ' '), attachment...)
+	value = append(append(value, ' '), origin...)
+	if !bytes.Equal(origin, clip) {
+		value = append(append(value, ' '), clip...)
+	}
+	return append(append(value, ' '), color...)
+}
+
+// splitValues splits a value at whitespace that is not within functions.
+func splitValues(value []byte) [][]byte {
+	var values [][]byte
+	level, start := 0, 0
+	z := parse.NewInputBytes(value)
+	defer z.Restore()
+
+	l := css.NewLexer(z)
+	for offset := 0; ; {
+		tt, data := l.Next()
+		if tt == css.ErrorToken {
+			break
+		}
+		switch tt {
+		case css.FunctionToken, css.LeftParenthesisToken:
+			level++
+		case css.RightParenthesisToken:
+			level--
+		case css.WhitespaceToken:
+			if level == 0 {
+				if start < offset {
+					values = append(values, value[start:offset])
+				}
+				start = offset + len(data)
+			}
+		}
+		offset += len(data)
+	}
+	if start < len(value) {
+		values = append(values, value[start:])
+	}
+	return values
+}
+
+// supportedValue returns true if the value only uses features that are supported by all browsers, so that a declaration with the value is never dropped by a browser and preceding declarations are not fallbacks.
+func supportedValue(value []byte) bool {
+	z := parse.NewInputBytes(value)
+	defer z.Restore()
+
+	l := css.NewLexer(z)
+	for {
+		tt, data := l.Next()
+		switch tt {
+		case css.ErrorToken:
+			return true
+		case css.IdentToken:
+			if data[0] == '-' || bytes.IndexByte(data, '\\') != -1 {
+				return false
+			}
+		case css.FunctionToken:
+			switch strings.ToLower(string(data)) {
+			case "url(", "rgb(", "rgba(", "hsl(", "hsla(":
+			default:
+				return false
+			}
+		case css.DimensionToken:
+			unit := data
+			for 0 < len(unit) && (unit[0] == '+' || unit[0] == '-' || unit[0] == '.' || '0' <= unit[0] && unit[0] <= '9' || (unit[0] == 'e' || unit[0] == 'E') && 1 < len(unit) && (unit[1] == '-' || unit[1] == '+' || '0' <= unit[1] && unit[1] <= '9')) {
+				unit = unit[1:]
+			}
+			switch strings.ToLower(string(unit)) {
+			case "px", "em", "ex", "ch", "rem", "vw", "vh", "vmin", "vmax", "cm", "mm", "q", "in", "pt", "pc", "deg", "grad", "rad", "turn", "s", "ms", "hz", "khz", "dpi", "dpcm", "dppx", "fr":
+			default:
+				return false
+			}
+		case css.HashToken:
+			if len(data) != 4 && len(data) != 7 {
+				return false
+			}
+		case css.DelimToken:
+			if data[0] != '/' && data[0] != '!' {
+				return false
+			}
+		case css.NumberToken, css.PercentageToken, css.StringToken, css.URLToken, css.CommaToken, css.WhitespaceToken, css.RightParenthesisToken:
+		default:
+			return false
+		}
+	}
+}
+
+// knownKeywords returns true if all identifiers in the value are keywords that are supported by all browsers.
+func knownKeywords(value []byte) bool {
+	z := parse.NewInputBytes(value)
+	defer z.Restore()
+
+	l := css.NewLexer(z)
+	for {
+		tt, data := l.Next()
+		if tt == css.ErrorToken {
+			return true
+		} else if tt == css.IdentToken && !cssKeywords[strings.ToLower(string(data))] && !bytes.EqualFold(data, []byte("important")) {
+			return false
+		}
+	}
+}
+
+// hasVendorPrefix returns true if the value contains vendor-prefixed identifiers or functions.
+func hasVendorPrefix(value []byte) bool {
+	z := parse.NewInputBytes(value)
+	defer z.Restore()
+
+	l := css.NewLexer(z)
+	for {
+		tt, data := l.Next()
+		if tt == css.ErrorToken {
+			return false
+		} else if (tt == css.IdentToken || tt == css.FunctionToken) && 1 < len(data) && data[0] == '-' && data[1] != '-' {
+			return true
+		}
+	}
+}
+
+// isGlobalValue returns true for the CSS-wide keywords, which cannot be combined in shorthands.
+func isGlobalValue(value []byte) bool {
+	switch strings.ToLower(string(value)) {
+	case "inherit", "initial", "unset", "revert", "revert-layer":
+		return true
+	}
+	return false
+}
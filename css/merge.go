@@ -0,0 +1,298 @@
+package css
+
+import (
+	"bytes"
+	"slices"
+
+	"github.com/tdewolff/parse/v2"
+)
+
+// safePseudos are pseudo-classes and pseudo-elements that all browsers support. Merging a selector with other pseudo-classes or pseudo-elements into a selector list is unsafe, since browsers drop the entire rule if they do not support one of the selectors.
+var safePseudos = map[string]bool{
+	"active":           true,
+	"after":            true,
+	"before":           true,
+	"checked":          true,
+	"disabled":         true,
+	"empty":            true,
+	"enabled":          true,
+	"first-child":      true,
+	"first-letter":     true,
+	"first-line":       true,
+	"first-of-type":    true,
+	"focus":            true,
+	"hover":            true,
+	"lang":             true,
+	"last-child":       true,
+	"last-of-type":     true,
+	"link":             true,
+	"not":              true,
+	"nth-child":        true,
+	"nth-last-child":   true,
+	"nth-last-of-type": true,
+	"nth-of-type":      true,
+	"only-child":       true,
+	"only-of-type":     true,
+	"root":             true,
+	"target":           true,
+	"visited":          true,
+}
+
+// mergeRules merges adjacent rulesets with the same selectors, adjacent @media and @supports rules with the same conditions, and rulesets with the same declarations. Rulesets with the same declarations are only merged when the rulesets in between do not set properties that interact with their declarations, so that the cascade order is preserved.
+func mergeRules(rules []*rule) []*rule {
+	for _, r := range rules {
+		if r.isGroupingRule() {
+			r.children = mergeRules(r.children)
+		}
+	}
+
+	for changed := true; changed; {
+		changed = false
+		for i := 0; i+1 < len(rules); {
+			a, b := rules[i], rules[i+1]
+			if a.kind == rulesetRule && b.kind == rulesetRule && a.hasOnlyDecls() && b.hasOnlyDecls() && equalSelectors(a.selectors, b.selectors) {
+				// a{x}a{y}  =>  a{x;y}
+				if !equalDecls(a.children, b.children) {
+					a.children = append(a.children, b.children...)
+				}
+				rules = slices.Delete(rules, i+1, i+2)
+				changed = true
+			} else if a.isGroupingRule() && b.isGroupingRule() && bytes.Equal(a.name, b.name) && bytes.Equal(a.data, b.data) {
+				// @media x{a{}}@media x{b{}}  =>  @media x{a{}b{}}
+				a.children = mergeRules(append(a.children, b.children...))
+				rules = slices.Delete(rules, i+1, i+2)
+				changed = true
+			} else {
+				i++
+			}
+		}
+
+		for i := 0; i < len(rules); i++ {
+			a := rules[i]
+			if a.kind != rulesetRule || !a.hasOnlyDecls() || !mergeableSelectors(a.selectors) {
+				continue
+			}
+			for j := i + 1; j < len(rules); j++ {
+				b := rules[j]
+				if b.kind == rulesetRule && b.hasOnlyDecls() && equalDecls(a.children, b.children) && mergeableSelectors(b.selectors) {
+					// a{x}b{x}  =>  a,b{x}
+					if canMoveRule(b, rules[i+1:j]) {
+						a.selectors = unionSelectors(a.selectors, b.selectors)
+						rules = slices.Delete(rules, j, j+1)
+						changed = true
+						j--
+						continue
+					} else if canMoveRule(a, rules[i+1:j]) {
+						b.selectors = unionSelectors(a.selectors, b.selectors)
+						rules = slices.Delete(rules, i, i+1)
+						changed = true
+						i--
+						break
+					}
+				}
+				if !b.isPassable() {
+					break
+				}
+			}
+		}
+	}
+	return rules
+}
+
+// isGroupingRule returns true for @media and @supports rules.
+func (r *rule) isGroupingRule() bool {
+	if r.kind != atRule || len(r.name) < 2 {
+		return false
+	}
+	name := ToHash(parse.ToLower(parse.Copy(r.name[1:])))
+	return name == Media || name == Supports
+}
+
+// isPassable returns true if rulesets may be moved across the rule when their properties do not interact.
+func (r *rule) isPassable() bool {
+	switch r.kind {
+	case rulesetRule:
+		return true
+	case atRule:
+		if r.isGroupingRule() {
+			return true
+		}
+		name := parse.ToLower(parse.Copy(r.name[1:]))
+		if 0 < len(name) && name[0] == '-' {
+			if i := bytes.IndexByte(name[1:], '-'); i != -1 {
+				name = name[i+2:] // remove vendor prefix
+			}
+		}
+		hash := ToHash(name)
+		return hash == Font_Face || hash == Keyframes
+	case rawRule:
+		return bytes.HasPrefix(r.data, []byte("/*"))
+	}
+	return false
+}
+
+// canMoveRule returns true if the ruleset can be moved across the rules, which is the case if none of the rules set properties that interact with the properties of the ruleset.
+func canMoveRule(r *rule, rules []*rule) bool {
+	for _, other := range rules {
+		if !other.isPassable() {
+			return false
+		} else if other.kind == atRule && !other.isGroupingRule() {
+			continue // @font-face and @keyframes
+		} else if interacts(r.children, other.children) {
+			return false
+		}
+	}
+	return true
+}
+
+// interacts returns true if any of the declarations interact with the declarations in rules, including those in nested rules.
+func interacts(decls []*rule, rules []*rule) bool {
+	for _, other := range rules {
+		if other.kind == declRule {
+			if other.name == nil {
+				return true
+			}
+			for _, decl := range decls {
+				if propertiesInteract(decl.name, other.name) {
+					return true
+				}
+			}
+		} else if other.kind == rulesetRule || other.kind == atRule {
+			if interacts(decls, other.children) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// propertiesInteract returns true if the order of the properties matters in the cascade, which is the case for the same properties, for shorthands and their longhands, and for logical and physical properties. Properties are grouped conservatively by the first part of their name.
+func propertiesInteract(a, b []byte) bool {
+	if bytes.HasPrefix(a, []byte("--")) || bytes.HasPrefix(b, []byte("--")) {
+		return bytes.Equal(a, b)
+	}
+	groupA, groupB := propertyGroup(a), propertyGroup(b)
+	return groupA == "all" || groupB == "all" || groupA == groupB
+}
+
+func propertyGroup(name []byte) string {
+	name = parse.ToLower(parse.Copy(name))
+	if 0 < len(name) && name[0] == '-' {
+		if i := bytes.IndexByte(name[1:], '-'); i != -1 {
+			name = name[i+2:] // remove vendor prefix
+		}
+	}
+	if i := bytes.IndexByte(name, '-'); i != -1 {
+		name = name[:i]
+	}
+	switch group := string(name); group {
+	case "top", "right", "bottom", "left", "inset":
+		return "inset"
+	case "place", "justify", "align":
+		return "align"
+	case "gap", "row", "column", "columns", "grid":
+		return "grid"
+	case "width", "height", "inline", "block", "min", "max":
+		return "size"
+	case "page", "break":
+		return "break"
+	case "word", "overflow":
+		return "overflow"
+	case "line", "font":
+		return "font"
+	case "white", "text":
+		return "text"
+	default:
+		return group
+	}
+}
+
+// mergeableSelectors returns true if the selectors can be merged into a selector list with other selectors. This excludes selectors with pseudo-classes, pseudo-elements, or attribute flags that are not supported by all browsers, and selector lists within pseudo-classes.
+func mergeableSelectors(selectors [][]byte) bool {
+	for _, selector := range selectors {
+		level := 0
+		for i := 0; i < len(selector); i++ {
+			switch c := selector[i]; c {
+			case '\\':
+				i++
+			case '"', '\'':
+				for i++; i < len(selector) && selector[i] != c; i++ {
+					if selector[i] == '\\' {
+						i++
+					}
+				}
+			case '[':
+				// attribute selectors with case-sensitivity flags are not supported by all browsers
+				j := i + 1
+				for j < len(selector) && selector[j] != ']' {
+					if c := selector[j]; c == '\\' {
+						j++
+					} else if c == '"' || c == '\'' {
+						for j++; j < len(selector) && selector[j] != c; j++ {
+							if selector[j] == '\\' {
+								j++
+							}
+						}
+					}
+					j++
+				}
+				attr := parse.TrimWhitespace(selector[i+1 : min(j, len(selector))])
+				if 2 < len(attr) && (attr[len(attr)-1]|0x20 == 'i' || attr[len(attr)-1]|0x20 == 's') && (parse.IsWhitespace(attr[len(attr)-2]) || attr[len(attr)-2] == '"' || attr[len(attr)-2] == '\'') {
+					return false
+				}
+				i = j
+			case '(':
+				level++
+			case ')':
+				level--
+			case ',':
+				if 0 < level {
+					return false
+				}
+			case ':':
+				if i+1 < len(selector) && selector[i+1] == ':' {
+					i++
+				}
+				j := i + 1
+				for j < len(selector) && isIdentByte(selector[j]) {
+					j++
+				}
+				if !safePseudos[string(parse.ToLower(parse.Copy(selector[i+1:j])))] {
+					return false
+				}
+				i = j - 1
+			}
+		}
+	}
+	return true
+}
+
+// equalSelectors returns true if both selector lists contain the same selectors.
+func equalSelectors(a, b [][]byte) bool {
+	for _, selector := range a {
+		if !slices.ContainsFunc(b, func(s []byte) bool { return bytes.Equal(s, selector) }) {
+			return false
+		}
+	}
+	for _, selector := range b {
+		if !slices.ContainsFunc(a, func(s []byte) bool { return bytes.Equal(s, selector) }) {
+			return false
+		}
+	}
+	return true
+}
+
+// unionSelectors returns the selectors of a followed by the selectors of b that are not in a.
+func unionSelectors(a, b [][]byte) [][]byte {
+	selectors := slices.Clone(a)
+	for _, selector := range b {
+		if !slices.ContainsFunc(selectors, func(s []byte) bool { return bytes.Equal(s, selector) }) {
+			selectors = append(selectors, selector)
+		}
+	}
+	return selectors
+}
+
+func isIdentByte(c byte) bool {
+	return c == '-' || c == '_' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || 0x80 <= c
+}
@@ -0,0 +1,379 @@
+package css
+
+import (
+	"bytes"
+
+	"github.com/tdewolff/parse/v2"
+)
+
+// maxNestingSelectors is the maximum number of selectors that a nested selector is expanded into when its parent selectors are substituted textually, otherwise :is() is used.
+const maxNestingSelectors = 16
+
+// flattenNesting rewrites nested style rules as plain rulesets, and hoists @media, @supports, @container, @layer, and @starting-style rules out of style rules. Parent selectors are substituted textually when that keeps the same meaning and specificity, otherwise they are wrapped in :is() if useIs is set. It returns false when the stylesheet has no nested rules.
+func flattenNesting(b []byte, useIs bool) ([]byte, bool) {
+	rules := parseRules(b)
+	if !hasNesting(rules) {
+		return b, false
+	}
+
+	f := flattener{useIs}
+	buf := &bytes.Buffer{}
+	writeRules(buf, f.flattenRules(rules))
+	return buf.Bytes(), true
+}
+
+// hasNesting returns true if any of the style rules contain rules.
+func hasNesting(rules []*rule) bool {
+	for _, r := range rules {
+		if r.kind == rulesetRule {
+			for _, child := range r.children {
+				if child.kind == rulesetRule || child.kind == atRule {
+					return true
+				}
+			}
+		} else if r.kind == atRule && hasNesting(r.children) {
+			return true
+		}
+	}
+	return false
+}
+
+type flattener struct {
+	useIs bool
+}
+
+// flattenRules flattens the style rules at the top level or within an at-rule.
+func (f flattener) flattenRules(rules []*rule) []*rule {
+	var flat []*rule
+	for _, r := range rules {
+		switch r.kind {
+		case rulesetRule:
+			flat = append(flat, f.flattenBody(r.selectors, r.children)...)
+		case atRule:
+			r.children = f.flattenRules(r.children)
+			flat = append(flat, r)
+		default:
+			flat = append(flat, r)
+		}
+	}
+	return flat
+}
+
+// flattenBody returns the rules for the body of a style rule with the given selectors. Declarations that follow nested rules are put in a separate ruleset to keep their order in the cascade.
+func (f flattener) flattenBody(selectors [][]byte, children []*rule) []*rule {
+	var flat, decls []*rule
+	flush := func() {
+		for _, decl := range decls {
+			if decl.kind == declRule {
+				flat = append(flat, &rule{kind: rulesetRule, selectors: selectors, children: decls})
+				break
+			}
+		}
+		decls = nil
+	}
+	for _, child := range children {
+		if child.kind == rulesetRule {
+			flush()
+			flat = append(flat, f.flattenBody(f.resolve(child.selectors, selectors), child.children)...)
+		} else if child.kind == atRule && isNestedGroupingRule(child.name) {
+			// a{@media x{b:c}}  =>  @media x{a{b:c}}
+			flush()
+			flat = append(flat, &rule{kind: atRule, name: child.name, data: child.data, children: f.flattenBody(selectors, child.children)})
+		} else {
+			decls = append(decls, child)
+		}
+	}
+	flush()
+	return flat
+}
+
+// isNestedGroupingRule returns true for at-rules that may be nested in style rules and that may contain declarations.
+func isNestedGroupingRule(name []byte) bool {
+	switch string(parse.ToLower(parse.Copy(name))) {
+	case "@media", "@supports", "@container", "@layer", "@starting-style":
+		return true
+	}
+	return false
+}
+
+// resolve returns the selectors of a nested style rule with the nesting selector replaced by its parent selectors. Relative selectors without a nesting selector are prefixed by it.
+func (f flattener) resolve(selectors, parents [][]byte) [][]byte {
+	var resolved [][]byte
+	for _, selector := range selectors {
+		positions := nestingPositions(selector)
+		if len(positions) == 0 {
+			// b, >b  =>  & b, & >b
+			selector = append([]byte("& "), selector...)
+			positions = []int{0}
+		}
+
+		if !f.useIs || f.isTextual(selector, positions, parents) {
+			resolved = unionSelectors(resolved, substituteNesting(selector, positions, parents))
+			continue
+		}
+
+		is := []byte(":is(")
+		for i, parent := range parents {
+			if i != 0 {
+				is = append(is, ',')
+			}
+			is = append(is, parent...)
+		}
+		is = append(is, ')')
+		resolved = unionSelectors(resolved, substituteNesting(selector, positions, [][]byte{is}))
+	}
+	return resolved
+}
+
+// isTextual returns true if substituting the parent selectors for the nesting selectors gives the same meaning and specificity as :is().
+func (f flattener) isTextual(selector []byte, positions []int, parents [][]byte) bool {
+	n := 1
+	for range positions {
+		n *= len(parents)
+		if maxNestingSelectors < n {
+			return false
+		}
+	}
+
+	for i, parent := range parents {
+		if hasPseudoElement(parent) {
+			return true // pseudo-elements are not allowed in :is()
+		} else if 0 < i && specificity(parent) != specificity(parents[0]) {
+			return false
+		}
+
+		complex := isComplexSelector(parent)
+		typed := 0 < len(parent) && (isIdentByte(parent[0]) && (parent[0] < '0' || '9' < parent[0]) || parent[0] == '*' || parent[0] == '|' || parent[0] == '\\')
+		for _, pos := range positions {
+			if complex && pos != 0 {
+				return false // .a{.b &{}}  =>  .b :is(.a .c)
+			} else if typed && 0 < pos && !isCompoundStart(selector[pos-1]) {
+				return false // div{.a&{}}  =>  .a:is(div)
+			}
+		}
+	}
+	return true
+}
+
+func isCompoundStart(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f' || c == '>' || c == '+' || c == '~' || c == '(' || c == ','
+}
+
+// substituteNesting replaces the nesting selectors at the given positions by each combination of the parent selectors.
+func substituteNesting(selector []byte, positions []int, parents [][]byte) [][]byte {
+	selectors := [][]byte{{}}
+	prev := 0
+	for _, pos := range positions {
+		next := make([][]byte, 0, len(selectors)*len(parents))
+		for _, s := range selectors {
+			for _, parent := range parents {
+				t := append(append([]byte{}, s...), selector[prev:pos]...)
+				next = append(next, append(t, parent...))
+			}
+		}
+		selectors = next
+		prev = pos + 1
+	}
+	for i := range selectors {
+		selectors[i] = append(selectors[i], selector[prev:]...)
+	}
+	return selectors
+}
+
+// nestingPositions returns the positions of the nesting selectors.
+func nestingPositions(selector []byte) []int {
+	var positions []int
+	for i := 0; i < len(selector); i++ {
+		switch c := selector[i]; c {
+		case '\\':
+			i++
+		case '"', '\'':
+			i = skipString(selector, i)
+		case '&':
+			positions = append(positions, i)
+		}
+	}
+	return positions
+}
+
+// skipString returns the position of the closing quote of the string that starts at i.
+func skipString(selector []byte, i int) int {
+	c := selector[i]
+	for i++; i < len(selector) && selector[i] != c; i++ {
+		if selector[i] == '\\' {
+			i++
+		}
+	}
+	return i
+}
+
+// skipIdent returns the position after the identifier that starts at i.
+func skipIdent(selector []byte, i int) int {
+	for i < len(selector) && (isIdentByte(selector[i]) || selector[i] == '\\') {
+		if selector[i] == '\\' {
+			i++
+		}
+		i++
+	}
+	return min(i, len(selector))
+}
+
+// skipParens returns the position of the closing parenthesis of the parenthesis at i.
+func skipParens(selector []byte, i int) int {
+	level := 0
+	for ; i < len(selector); i++ {
+		switch c := selector[i]; c {
+		case '\\':
+			i++
+		case '"', '\'':
+			i = skipString(selector, i)
+		case '(':
+			level++
+		case ')':
+			level--
+			if level == 0 {
+				return i
+			}
+		}
+	}
+	return len(selector)
+}
+
+// splitSelectorList splits a selector list at the commas that are not within parentheses or strings.
+func splitSelectorList(list []byte) [][]byte {
+	var selectors [][]byte
+	start := 0
+	for i := 0; i < len(list); i++ {
+		switch c := list[i]; c {
+		case '\\':
+			i++
+		case '"', '\'':
+			i = skipString(list, i)
+		case '(':
+			i = skipParens(list, i)
+		case ',':
+			selectors = append(selectors, parse.TrimWhitespace(list[start:i]))
+			start = i + 1
+		}
+	}
+	return append(selectors, parse.TrimWhitespace(list[start:]))
+}
+
+// isComplexSelector returns true if the selector consists of more than one compound selector.
+func isComplexSelector(selector []byte) bool {
+	selector = parse.TrimWhitespace(selector)
+	for i := 0; i < len(selector); i++ {
+		switch c := selector[i]; c {
+		case '\\':
+			i++
+		case '"', '\'':
+			i = skipString(selector, i)
+		case '(':
+			i = skipParens(selector, i)
+		case ' ', '\t', '\n', '\r', '\f', '>', '+', '~':
+			return true
+		}
+	}
+	return false
+}
+
+// hasPseudoElement returns true if the selector has a pseudo-element.
+func hasPseudoElement(selector []byte) bool {
+	for i := 0; i < len(selector); i++ {
+		switch c := selector[i]; c {
+		case '\\':
+			i++
+		case '"', '\'':
+			i = skipString(selector, i)
+		case '(':
+			i = skipParens(selector, i)
+		case ':':
+			if i+1 < len(selector) && selector[i+1] == ':' {
+				return true
+			}
+			j := skipIdent(selector, i+1)
+			switch string(parse.ToLower(parse.Copy(selector[i+1 : j]))) {
+			case "before", "after", "first-line", "first-letter":
+				return true
+			}
+			i = j - 1
+		}
+	}
+	return false
+}
+
+// specificity returns the specificity of a selector as the number of ID selectors, the number of class, attribute, and pseudo-class selectors, and the number of type selectors and pseudo-elements.
+func specificity(selector []byte) [3]int {
+	s := [3]int{}
+	for i := 0; i < len(selector); {
+		switch c := selector[i]; c {
+		case '#':
+			s[0]++
+			i = skipIdent(selector, i+1)
+		case '.':
+			s[1]++
+			i = skipIdent(selector, i+1)
+		case '[':
+			s[1]++
+			for i++; i < len(selector) && selector[i] != ']'; i++ {
+				if selector[i] == '\\' {
+					i++
+				} else if selector[i] == '"' || selector[i] == '\'' {
+					i = skipString(selector, i)
+				}
+			}
+			i++
+		case ':':
+			if i+1 < len(selector) && selector[i+1] == ':' {
+				s[2]++
+				i = skipIdent(selector, i+2)
+				if i < len(selector) && selector[i] == '(' {
+					i = skipParens(selector, i) + 1
+				}
+				break
+			}
+			j := skipIdent(selector, i+1)
+			name := string(parse.ToLower(parse.Copy(selector[i+1 : j])))
+			var args []byte
+			if j < len(selector) && selector[j] == '(' {
+				end := skipParens(selector, j)
+				args = selector[j+1 : min(end, len(selector))]
+				j = end + 1
+			}
+			switch name {
+			case "before", "after", "first-line", "first-letter":
+				s[2]++
+			case "where":
+			case "is", "not", "has", "matches", "-webkit-any", "-moz-any":
+				// the specificity of the most specific argument
+				most := [3]int{}
+				for _, arg := range splitSelectorList(args) {
+					if t := specificity(arg); most[0] < t[0] || most[0] == t[0] && (most[1] < t[1] || most[1] == t[1] && most[2] < t[2]) {
+						most = t
+					}
+				}
+				s[0] += most[0]
+				s[1] += most[1]
+				s[2] += most[2]
+			default:
+				s[1]++
+			}
+			i = j
+		case '\\':
+			s[2]++
+			i = skipIdent(selector, i)
+		default:
+			if isIdentByte(c) && (c < '0' || '9' < c) {
+				if j := skipIdent(selector, i); j < len(selector) && selector[j] == '|' && (j+1 == len(selector) || selector[j+1] != '=') {
+					i = j + 1 // namespace prefix
+				} else {
+					s[2]++
+					i = j
+				}
+			} else {
+				i++
+			}
+		}
+	}
+	return s
+}
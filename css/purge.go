@@ -0,0 +1,503 @@
+package css
+
+import (
+	"bytes"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/tdewolff/parse/v2"
+	"github.com/tdewolff/parse/v2/html"
+	"github.com/tdewolff/parse/v2/xml"
+)
+
+// Usage is the set of class names, IDs, tag names, and attribute names that are used by content files such as HTML documents, templates, and scripts. It is used by the Purge option to remove the rules of a stylesheet that cannot match any element.
+type Usage struct {
+	Safelist        []string         // class names, IDs, tag names, attribute names, keyframes, font families, and custom properties that are always kept
+	SafelistRegexps []*regexp.Regexp // names that match are always kept
+
+	classes map[string]bool
+	ids     map[string]bool
+	tags    map[string]bool
+	attrs   map[string]bool
+	words   map[string]bool // words in scripts and other text, which may be used as any name
+}
+
+// NewUsage returns a new Usage, where the html and body elements are used as browsers always create them.
+func NewUsage() *Usage {
+	return &Usage{
+		classes: map[string]bool{},
+		ids:     map[string]bool{},
+		tags:    map[string]bool{"html": true, "body": true},
+		attrs:   map[string]bool{},
+		words:   map[string]bool{},
+	}
+}
+
+// AddHTML adds the tag names, attribute names, class names, and IDs of an HTML document. Other attribute values and text, such as inline scripts, are added as with AddText.
+func (u *Usage) AddHTML(r io.Reader) error {
+	z := parse.NewInput(r)
+	defer z.Restore()
+
+	l := html.NewLexer(z)
+	for {
+		tt, data := l.Next()
+		switch tt {
+		case html.ErrorToken:
+			if l.Err() != io.EOF {
+				return l.Err()
+			}
+			return nil
+		case html.StartTagToken:
+			u.tags[string(parse.ToLower(parse.Copy(l.Text())))] = true
+		case html.AttributeToken:
+			u.addAttribute(l.Text(), l.AttrVal())
+		case html.TextToken:
+			u.addWords(data)
+		case html.SVGToken, html.MathToken:
+			if err := u.addXML(data); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// addXML adds the tag names, attribute names, class names, and IDs of inline SVG or MathML.
+func (u *Usage) addXML(b []byte) error {
+	z := parse.NewInputBytes(b)
+	defer z.Restore()
+
+	l := xml.NewLexer(z)
+	for {
+		tt, data := l.Next()
+		switch tt {
+		case xml.ErrorToken:
+			if l.Err() != io.EOF {
+				return l.Err()
+			}
+			return nil
+		case xml.StartTagToken:
+			u.tags[string(parse.ToLower(parse.Copy(l.Text())))] = true
+		case xml.AttributeToken:
+			u.addAttribute(l.Text(), l.AttrVal())
+		case xml.TextToken, xml.CDATAToken:
+			u.addWords(data)
+		}
+	}
+}
+
+func (u *Usage) addAttribute(name, val []byte) {
+	name = parse.ToLower(parse.Copy(name))
+	u.attrs[string(name)] = true
+	if 1 < len(val) && (val[0] == '"' || val[0] == '\'') && val[len(val)-1] == val[0] {
+		val = val[1 : len(val)-1]
+	}
+	if bytes.Equal(name, []byte("class")) {
+		for _, class := range strings.Fields(string(val)) {
+			u.classes[class] = true
+		}
+	} else if bytes.Equal(name, []byte("id")) {
+		u.ids[string(parse.TrimWhitespace(val))] = true
+	}
+	u.addWords(val)
+}
+
+// AddText adds the words of a script, template, or other text file, which may be used as class names, IDs, tag names, or attribute names.
+func (u *Usage) AddText(r io.Reader) error {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	u.addWords(b)
+	return nil
+}
+
+// addWords adds runs of characters delimited by whitespace, quotes, and punctuation such as md:flex and w-1/2, as well as the identifiers within them.
+func (u *Usage) addWords(b []byte) {
+	start := -1
+	for i := 0; i <= len(b); i++ {
+		if i < len(b) && !isWordDelimiter(b[i]) {
+			if start == -1 {
+				start = i
+			}
+			continue
+		} else if start == -1 {
+			continue
+		}
+
+		word := b[start:i]
+		u.words[string(word)] = true
+		for j := 0; j < len(word); {
+			k := j
+			for k < len(word) && isIdentByte(word[k]) {
+				k++
+			}
+			if j < k && k-j < len(word) {
+				u.words[string(word[j:k])] = true
+			}
+			j = k + 1
+		}
+		start = -1
+	}
+}
+
+func isWordDelimiter(c byte) bool {
+	switch c {
+	case ' ', '\t', '\n', '\r', '\f', '"', '\'', '`', '<', '>', '=', '(', ')', '{', '}', ';', ',':
+		return true
+	}
+	return false
+}
+
+// used returns true if the name is in the set of used names, in the words of text content, or in the safelist.
+func (u *Usage) used(set map[string]bool, name string) bool {
+	if set[name] || u.words[name] {
+		return true
+	}
+	for _, s := range u.Safelist {
+		if s == name {
+			return true
+		}
+	}
+	for _, re := range u.SafelistRegexps {
+		if re.MatchString(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// purge removes the rulesets of which no selector can match the used names, and selectors that cannot match from selector lists. Afterwards, it removes the @keyframes, @font-face, and custom properties that are no longer referenced. It returns false when nothing was removed.
+func (u *Usage) purge(b []byte) ([]byte, bool) {
+	rules := parseRules(b)
+	rules, purged := u.purgeRules(rules)
+
+	var ok bool
+	if rules, ok = u.purgeAllCustomProperties(rules); ok {
+		purged = true
+	}
+
+	refs := &bytes.Buffer{}
+	collectReferences(refs, rules)
+	if rules, ok = u.purgeAtRules(rules, parse.ToLower(refs.Bytes())); ok {
+		purged = true
+	}
+	if !purged {
+		return b, false
+	}
+
+	buf := &bytes.Buffer{}
+	writeRules(buf, rules)
+	return buf.Bytes(), true
+}
+
+// purgeRules removes the rulesets and selectors that cannot match, also within conditional group rules that are removed when they become empty.
+func (u *Usage) purgeRules(rules []*rule) ([]*rule, bool) {
+	purged := false
+	kept := rules[:0]
+	for _, r := range rules {
+		if r.kind == rulesetRule {
+			selectors := r.selectors[:0]
+			for _, selector := range r.selectors {
+				if u.matches(selector) {
+					selectors = append(selectors, selector)
+				}
+			}
+			if len(selectors) != len(r.selectors) {
+				purged = true
+			}
+			if len(selectors) == 0 {
+				continue
+			}
+			r.selectors = selectors
+
+			var ok bool
+			if r.children, ok = u.purgeRules(r.children); ok {
+				purged = true
+			}
+		} else if r.kind == atRule && isConditionalGroupRule(r.name) {
+			var ok bool
+			if r.children, ok = u.purgeRules(r.children); ok {
+				purged = true
+				if len(r.children) == 0 && !bytes.EqualFold(r.name, []byte("@layer")) {
+					continue // keep empty layers as they set the layer order
+				}
+			}
+		}
+		kept = append(kept, r)
+	}
+	return kept, purged
+}
+
+// isConditionalGroupRule returns true for at-rules that contain style rules.
+func isConditionalGroupRule(name []byte) bool {
+	switch string(parse.ToLower(parse.Copy(name))) {
+	case "@media", "@supports", "@container", "@layer", "@scope", "@starting-style", "@document", "@-moz-document":
+		return true
+	}
+	return false
+}
+
+// matches returns true if the selector may match an element given the used names. Only class names, IDs, type selectors, and attribute names must be used, and selectors in functional pseudo-classes other than :is(), :where(), and :has() are ignored.
+func (u *Usage) matches(selector []byte) bool {
+	compoundStart := true
+	for i := 0; i < len(selector); {
+		c := selector[i]
+		switch c {
+		case '.', '#':
+			name, j := unescapeIdent(selector, i+1)
+			if c == '.' && !u.used(u.classes, name) || c == '#' && !u.used(u.ids, name) {
+				return false
+			}
+			i = j
+		case '[':
+			j := i + 1
+			for j < len(selector) && (selector[j] == ' ' || selector[j] == '\t' || selector[j] == '\n' || selector[j] == '\r' || selector[j] == '\f') {
+				j++
+			}
+			name, k := unescapeIdent(selector, j)
+			if k < len(selector) && selector[k] == '|' && (k+1 == len(selector) || selector[k+1] != '=') {
+				name, k = unescapeIdent(selector, k+1) // namespace prefix
+			}
+			if name != "" && !u.used(u.attrs, strings.ToLower(name)) {
+				return false
+			}
+			for i = k; i < len(selector) && selector[i] != ']'; i++ {
+				if selector[i] == '\\' {
+					i++
+				} else if selector[i] == '"' || selector[i] == '\'' {
+					i = skipString(selector, i)
+				}
+			}
+			i++
+		case ':':
+			j := i + 1
+			if j < len(selector) && selector[j] == ':' {
+				j++
+			}
+			name, k := unescapeIdent(selector, j)
+			if k < len(selector) && selector[k] == '(' {
+				end := skipParens(selector, k)
+				switch strings.ToLower(name) {
+				case "is", "where", "has", "matches", "-webkit-any", "-moz-any":
+					match := false
+					for _, arg := range splitSelectorList(selector[k+1 : min(end, len(selector))]) {
+						if 0 < len(arg) && (arg[0] == '>' || arg[0] == '+' || arg[0] == '~') {
+							arg = arg[1:] // relative selector of :has()
+						}
+						if u.matches(arg) {
+							match = true
+							break
+						}
+					}
+					if !match {
+						return false
+					}
+				}
+				k = end + 1
+			}
+			i = k
+		case '\\':
+			name, j := unescapeIdent(selector, i)
+			if compoundStart && !u.used(u.tags, strings.ToLower(name)) {
+				return false
+			}
+			i = j
+		case '"', '\'':
+			i = skipString(selector, i) + 1
+		case '(':
+			i = skipParens(selector, i) + 1
+		default:
+			if isIdentByte(c) && (c < '0' || '9' < c) && (c != '-' || i+1 < len(selector) && !('0' <= selector[i+1] && selector[i+1] <= '9')) {
+				name, j := unescapeIdent(selector, i)
+				if j < len(selector) && selector[j] == '|' && (j+1 == len(selector) || selector[j+1] != '=') {
+					i = j + 1 // namespace prefix
+					continue
+				} else if compoundStart && !u.used(u.tags, strings.ToLower(name)) {
+					return false
+				}
+				i = j
+			} else {
+				i++
+			}
+		}
+		compoundStart = isCompoundStart(c) || c == '&'
+	}
+	return true
+}
+
+// unescapeIdent returns the identifier that starts at i with its escapes resolved, and the position after it.
+func unescapeIdent(b []byte, i int) (string, int) {
+	var sb strings.Builder
+	for i < len(b) {
+		if b[i] == '\\' && i+1 < len(b) {
+			i++
+			n := 0
+			for n < 6 && i+n < len(b) && ('0' <= b[i+n] && b[i+n] <= '9' || 'a' <= b[i+n] && b[i+n] <= 'f' || 'A' <= b[i+n] && b[i+n] <= 'F') {
+				n++
+			}
+			if n == 0 {
+				sb.WriteByte(b[i])
+				i++
+				continue
+			}
+			r, _ := strconv.ParseUint(string(b[i:i+n]), 16, 32)
+			sb.WriteRune(rune(r))
+			i += n
+			if i < len(b) && (b[i] == ' ' || b[i] == '\t' || b[i] == '\n' || b[i] == '\r' || b[i] == '\f') {
+				i++ // whitespace terminates an escape
+			}
+		} else if isIdentByte(b[i]) {
+			sb.WriteByte(b[i])
+			i++
+		} else {
+			break
+		}
+	}
+	return sb.String(), i
+}
+
+// collectReferences writes the values of all declarations outside of @font-face rules, which are searched for references to keyframes, font families, and custom properties.
+func collectReferences(w *bytes.Buffer, rules []*rule) {
+	for _, r := range rules {
+		switch r.kind {
+		case declRule:
+			w.Write(r.data)
+			w.WriteByte('\n')
+		case rulesetRule, atRule:
+			if r.kind == atRule && bytes.EqualFold(r.name, []byte("@font-face")) {
+				continue
+			}
+			collectReferences(w, r.children)
+		}
+	}
+}
+
+// purgeAllCustomProperties removes the custom properties that are not referenced, until removing them doesn't leave other custom properties unreferenced. It returns false when nothing was removed.
+func (u *Usage) purgeAllCustomProperties(rules []*rule) ([]*rule, bool) {
+	purged := false
+	refs := &bytes.Buffer{}
+	for {
+		refs.Reset()
+		collectReferences(refs, rules)
+
+		var ok bool
+		if rules, ok = u.purgeCustomProperties(rules, refs.Bytes()); !ok {
+			return rules, purged
+		}
+		purged = true
+	}
+}
+
+// purgeCustomProperties removes the declarations of custom properties that are not referenced by the values of the declarations, nor by text content, and their @property rules. It returns false when nothing was removed.
+func (u *Usage) purgeCustomProperties(rules []*rule, refs []byte) ([]*rule, bool) {
+	purged := false
+	kept := rules[:0]
+	for _, r := range rules {
+		if r.kind == declRule && 2 < len(r.name) && r.name[0] == '-' && r.name[1] == '-' && !u.referenced(refs, r.name) {
+			purged = true
+			continue
+		} else if r.kind == atRule && bytes.EqualFold(r.name, []byte("@property")) && !u.referenced(refs, parse.TrimWhitespace(r.data)) {
+			purged = true
+			continue
+		} else if r.kind == rulesetRule || r.kind == atRule && isConditionalGroupRule(r.name) {
+			var ok bool
+			if r.children, ok = u.purgeCustomProperties(r.children, refs); ok {
+				purged = true
+				if len(r.children) == 0 && !bytes.EqualFold(r.name, []byte("@layer")) {
+					continue
+				}
+			}
+		}
+		kept = append(kept, r)
+	}
+	return kept, purged
+}
+
+// referenced returns true if the custom property is used in refs, in text content, or in the safelist.
+func (u *Usage) referenced(refs, name []byte) bool {
+	for i := 0; i < len(refs); {
+		j := bytes.Index(refs[i:], name)
+		if j == -1 {
+			break
+		}
+		j += i
+		if (j == 0 || !isIdentByte(refs[j-1])) && (len(refs) <= j+len(name) || !isIdentByte(refs[j+len(name)])) {
+			return true
+		}
+		i = j + 1
+	}
+	return u.used(nil, string(name))
+}
+
+// purgeAtRules removes the @keyframes and @font-face rules of which the name or font family is not referenced by the values of the declarations, nor by text content. The references must be in lowercase. It returns false when nothing was removed.
+func (u *Usage) purgeAtRules(rules []*rule, refs []byte) ([]*rule, bool) {
+	purged := false
+	kept := rules[:0]
+	for _, r := range rules {
+		if r.kind == atRule {
+			name := parse.ToLower(parse.Copy(r.name))
+			if bytes.HasSuffix(name, []byte("keyframes")) {
+				if keyframes := unquote(parse.TrimWhitespace(r.data)); !u.referenced(refs, parse.ToLower(parse.Copy(keyframes))) && !u.used(nil, string(keyframes)) {
+					purged = true
+					continue
+				}
+			} else if bytes.Equal(name, []byte("@font-face")) {
+				if family := fontFaceFamily(r.children); family != nil && !fontFamilyReferenced(refs, parse.ToLower(parse.Copy(family))) && !u.used(nil, string(family)) {
+					purged = true
+					continue
+				}
+			} else if isConditionalGroupRule(r.name) {
+				var ok bool
+				if r.children, ok = u.purgeAtRules(r.children, refs); ok {
+					purged = true
+				}
+			}
+		}
+		kept = append(kept, r)
+	}
+	return kept, purged
+}
+
+// fontFamilyReferenced returns true if the font family is one of the comma-separated families in the values of refs, which includes the values of custom properties. Families are matched as a whole, either quoted or as the identifiers at the end of a family, such as in the font shorthand. Both must be in lowercase.
+func fontFamilyReferenced(refs, family []byte) bool {
+	family = bytes.Join(bytes.Fields(family), []byte(" "))
+	for _, value := range bytes.Split(refs, []byte("\n")) {
+		for _, part := range bytes.Split(value, []byte(",")) {
+			part = parse.TrimWhitespace(part)
+			if n := len(part); 1 < n && (part[n-1] == '"' || part[n-1] == '\'') {
+				if i := bytes.LastIndexByte(part[:n-1], part[n-1]); i != -1 && bytes.Equal(part[i+1:n-1], family) {
+					return true
+				}
+				continue
+			}
+
+			// 12px open sans  =>  sans, open sans, 12px open sans
+			words := bytes.Fields(part)
+			for i := len(words) - 1; 0 <= i; i-- {
+				if bytes.Equal(bytes.Join(words[i:], []byte(" ")), family) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// fontFaceFamily returns the font family of a @font-face rule without quotes, or nil if it has none.
+func fontFaceFamily(decls []*rule) []byte {
+	for _, decl := range decls {
+		if decl.kind == declRule && bytes.EqualFold(decl.name, []byte("font-family")) {
+			return unquote(parse.TrimWhitespace(decl.data))
+		}
+	}
+	return nil
+}
+
+func unquote(b []byte) []byte {
+	if 1 < len(b) && (b[0] == '"' || b[0] == '\'') && b[len(b)-1] == b[0] {
+		return b[1 : len(b)-1]
+	}
+	return b
+}
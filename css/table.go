@@ -181,7 +181,7 @@ var PropertyOverrides = map[Hash][]Hash{
 	Columns:         {Columns, Column_Width, Column_Count},
 	Flex:            {Flex, Flex_Basis, Flex_Grow, Flex_Shrink},
 	Flex_Flow:       {Flex_Flow, Flex_Direction, Flex_Wrap},
-	Grid:            {Grid, Grid_Template_Rows, Grid_Template_Columns, Grid_Template_Areas, Grid_Auto_Rows, Grid_Auto_Columns, Grid_Auto_Flow, Grid_Column_Gap, Grid_Row_Gap, Column_Gap, Row_Gap},
+	Grid:            {Grid, Grid_Template_Rows, Grid_Template_Columns, Grid_Template_Areas, Grid_Auto_Rows, Grid_Auto_Columns, Grid_Auto_Flow},
 	Grid_Area:       {Grid_Area, Grid_Row_Start, Grid_Column_Start, Grid_Row_End, Grid_Column_End},
 	Grid_Row:        {Grid_Row, Grid_Row_Start, Grid_Row_End},
 	Grid_Column:     {Grid_Column, Grid_Column_Start, Grid_Column_End},
@@ -0,0 +1,99 @@
+package css
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Targets are the minimum browser versions that the output must support, such as Targets{Chrome: 90, Safari: 14.1}. Browsers with a zero version are not targeted. Optimizations that introduce newer syntax are only used when all targeted browsers support it, and are not used at all when no browsers are targeted.
+type Targets struct {
+	Chrome  float64
+	Edge    float64
+	Firefox float64
+	Safari  float64
+	IOS     float64 // Safari on iOS
+	Opera   float64
+	Samsung float64
+	IE      float64
+}
+
+// ParseTargets parses a comma-separated list of minimum browser versions, such as "chrome>=90,safari>=14.1". The browsers are chrome, edge, firefox, safari, ios (or ios_saf), opera, samsung, and ie.
+func ParseTargets(s string) (Targets, error) {
+	t := Targets{}
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		name, version, ok := strings.Cut(item, ">=")
+		if !ok {
+			return Targets{}, fmt.Errorf("invalid target %q, expected BROWSER>=VERSION", item)
+		}
+		v, err := strconv.ParseFloat(strings.TrimSpace(version), 64)
+		if err != nil || v <= 0.0 {
+			return Targets{}, fmt.Errorf("invalid target %q, bad version %q", item, strings.TrimSpace(version))
+		}
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "chrome":
+			t.Chrome = v
+		case "edge":
+			t.Edge = v
+		case "firefox":
+			t.Firefox = v
+		case "safari":
+			t.Safari = v
+		case "ios", "ios_saf":
+			t.IOS = v
+		case "opera":
+			t.Opera = v
+		case "samsung":
+			t.Samsung = v
+		case "ie":
+			t.IE = v
+		default:
+			return Targets{}, fmt.Errorf("invalid target %q, unknown browser %q", item, strings.TrimSpace(name))
+		}
+	}
+	return t, nil
+}
+
+type feature int
+
+const (
+	hexAlphaColors feature = iota // #rrggbbaa and #rgba
+	insetProperty                 // inset shorthand
+	isSelector                    // :is() pseudo-class
+	nesting                       // nested style rules
+)
+
+// features are the first browser versions that support each feature, where a zero version means that the browser does not support it. The versions are taken from caniuse.com.
+var features = map[feature]Targets{
+	hexAlphaColors: {Chrome: 62, Edge: 79, Firefox: 49, Safari: 10, IOS: 10, Opera: 49, Samsung: 8.2},
+	insetProperty:  {Chrome: 87, Edge: 87, Firefox: 66, Safari: 14.1, IOS: 14.5, Opera: 73, Samsung: 14},
+	isSelector:     {Chrome: 88, Edge: 88, Firefox: 78, Safari: 14, IOS: 14, Opera: 74, Samsung: 15},
+	nesting:        {Chrome: 120, Edge: 120, Firefox: 117, Safari: 17.2, IOS: 17.2, Opera: 106, Samsung: 25},
+}
+
+// supports returns true if all targeted browsers support the feature, and false if no browsers are targeted.
+func (t Targets) supports(f feature) bool {
+	if t == (Targets{}) {
+		return false
+	}
+	support := features[f]
+	for _, v := range [][2]float64{
+		{t.Chrome, support.Chrome},
+		{t.Edge, support.Edge},
+		{t.Firefox, support.Firefox},
+		{t.Safari, support.Safari},
+		{t.IOS, support.IOS},
+		{t.Opera, support.Opera},
+		{t.Samsung, support.Samsung},
+		{t.IE, support.IE},
+	} {
+		if v[0] != 0.0 && (v[1] == 0.0 || v[0] < v[1]) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,239 @@
+package css
+
+import (
+	"bytes"
+	"io"
+
+	"github.com/tdewolff/parse/v2"
+	"github.com/tdewolff/parse/v2/css"
+)
+
+type ruleKind int
+
+const (
+	rawRule     ruleKind = iota // comment or at-rule statement such as @import, written as is
+	declRule                    // declaration, without a name if it could not be parsed
+	rulesetRule                 // selectors with a block
+	atRule                      // at-rule with a block
+)
+
+// rule is a node in the tree of a minified stylesheet, which is used for optimizations across rules.
+type rule struct {
+	kind      ruleKind
+	name      []byte   // name of the at-rule including the @, or of the property
+	data      []byte   // raw text, prelude of the at-rule, or value of the declaration
+	selectors [][]byte // selectors of the ruleset
+	children  []*rule  // declarations and rules in the block
+}
+
+// ruleParser parses a stylesheet into a tree of rules. Unlike the parser of the parse package, it keeps all tokens of selectors and values, and it allows declarations and rules to be mixed in all blocks, as with CSS nesting.
+type ruleParser struct {
+	l    *css.Lexer
+	tt   css.TokenType
+	data []byte
+}
+
+// parseRules parses a stylesheet or a list of declarations into a tree of rules.
+func parseRules(b []byte) []*rule {
+	z := parse.NewInputBytes(b)
+	defer z.Restore()
+
+	p := &ruleParser{l: css.NewLexer(z)}
+	p.next()
+	var rules []*rule
+	for {
+		rules = append(rules, p.parseBlock()...)
+		if p.tt == css.ErrorToken {
+			return rules
+		}
+		rules = append(rules, &rule{kind: rawRule, data: p.data}) // unmatched closing brace
+		p.next()
+	}
+}
+
+func (p *ruleParser) next() {
+	p.tt, p.data = p.l.Next()
+}
+
+// parseBlock parses rules and declarations until the end of the block.
+func (p *ruleParser) parseBlock() []*rule {
+	var rules []*rule
+	for {
+		switch p.tt {
+		case css.ErrorToken, css.RightBraceToken:
+			return rules
+		case css.WhitespaceToken, css.SemicolonToken:
+			p.next()
+			continue
+		case css.CommentToken:
+			rules = append(rules, &rule{kind: rawRule, data: p.data})
+			p.next()
+			continue
+		}
+
+		// a declaration, or the prelude of a rule or at-rule
+		var tokens []css.Token
+		level := 0
+		for p.tt != css.ErrorToken && p.tt != css.LeftBraceToken && p.tt != css.RightBraceToken && (p.tt != css.SemicolonToken || level != 0) {
+			switch p.tt {
+			case css.FunctionToken, css.LeftParenthesisToken, css.LeftBracketToken:
+				level++
+			case css.RightParenthesisToken, css.RightBracketToken:
+				if 0 < level {
+					level--
+				}
+			}
+			tokens = append(tokens, css.Token{TokenType: p.tt, Data: p.data})
+			p.next()
+		}
+		for 0 < len(tokens) && tokens[len(tokens)-1].TokenType == css.WhitespaceToken {
+			tokens = tokens[:len(tokens)-1]
+		}
+
+		if p.tt == css.LeftBraceToken {
+			p.next()
+			children := p.parseBlock()
+			if p.tt == css.RightBraceToken {
+				p.next()
+			}
+			if 0 < len(tokens) && tokens[0].TokenType == css.AtKeywordToken {
+				rules = append(rules, &rule{kind: atRule, name: tokens[0].Data, data: tokensBytes(tokens[1:]), children: children})
+			} else {
+				rules = append(rules, &rule{kind: rulesetRule, selectors: splitSelectors(tokens), children: children})
+			}
+		} else if 0 < len(tokens) && tokens[0].TokenType == css.AtKeywordToken {
+			rules = append(rules, &rule{kind: rawRule, data: append(tokensBytes(tokens), ';')})
+		} else if 0 < len(tokens) {
+			rules = append(rules, parseDecl(tokens))
+		}
+	}
+}
+
+// parseDecl parses a declaration, which has no name if it is invalid. Names with the star and underscore hacks for old versions of IE keep their prefix.
+func parseDecl(tokens []css.Token) *rule {
+	var name []byte
+	i := 1
+	if tokens[0].TokenType == css.IdentToken || tokens[0].TokenType == css.CustomPropertyNameToken {
+		name = tokens[0].Data
+	} else if tokens[0].TokenType == css.DelimToken && (tokens[0].Data[0] == '*' || tokens[0].Data[0] == '_') && 1 < len(tokens) && tokens[1].TokenType == css.IdentToken {
+		name = append(parse.Copy(tokens[0].Data), tokens[1].Data...)
+		i = 2
+	}
+	if name != nil {
+		for i < len(tokens) && tokens[i].TokenType == css.WhitespaceToken {
+			i++
+		}
+		if i < len(tokens) && tokens[i].TokenType == css.ColonToken {
+			i++
+			for i < len(tokens) && tokens[i].TokenType == css.WhitespaceToken {
+				i++
+			}
+			return &rule{kind: declRule, name: name, data: tokensBytes(tokens[i:])}
+		}
+	}
+	return &rule{kind: declRule, data: tokensBytes(tokens)}
+}
+
+func tokensBytes(tokens []css.Token) []byte {
+	n := 0
+	for _, t := range tokens {
+		n += len(t.Data)
+	}
+	b := make([]byte, 0, n)
+	for _, t := range tokens {
+		b = append(b, t.Data...)
+	}
+	return b
+}
+
+// splitSelectors splits a selector list at the commas that are not within parentheses.
+func splitSelectors(tokens []css.Token) [][]byte {
+	var selectors [][]byte
+	level, start := 0, 0
+	for i := 0; i <= len(tokens); i++ {
+		if i < len(tokens) {
+			switch tokens[i].TokenType {
+			case css.FunctionToken, css.LeftParenthesisToken:
+				level++
+				continue
+			case css.RightParenthesisToken:
+				level--
+				continue
+			}
+			if tokens[i].TokenType != css.CommaToken || level != 0 {
+				continue
+			}
+		}
+		selector := tokens[start:i]
+		for 0 < len(selector) && selector[0].TokenType == css.WhitespaceToken {
+			selector = selector[1:]
+		}
+		for 0 < len(selector) && selector[len(selector)-1].TokenType == css.WhitespaceToken {
+			selector = selector[:len(selector)-1]
+		}
+		selectors = append(selectors, tokensBytes(selector))
+		start = i + 1
+	}
+	return selectors
+}
+
+// writeRules writes out the tree of rules.
+func writeRules(w io.Writer, rules []*rule) {
+	semicolon := false
+	for _, r := range rules {
+		if semicolon {
+			w.Write(semicolonBytes)
+			semicolon = false
+		}
+		switch r.kind {
+		case rawRule:
+			w.Write(r.data)
+		case declRule:
+			if r.name != nil {
+				w.Write(r.name)
+				w.Write(colonBytes)
+			}
+			w.Write(r.data)
+			semicolon = true
+		case rulesetRule:
+			for i, selector := range r.selectors {
+				if i != 0 {
+					w.Write(commaBytes)
+				}
+				w.Write(selector)
+			}
+			w.Write(leftBracketBytes)
+			writeRules(w, r.children)
+			w.Write(rightBracketBytes)
+		case atRule:
+			w.Write(r.name)
+			w.Write(r.data)
+			w.Write(leftBracketBytes)
+			writeRules(w, r.children)
+			w.Write(rightBracketBytes)
+		}
+	}
+}
+
+// equalDecls returns true if both blocks consist of the same declarations in the same order.
+func equalDecls(a, b []*rule) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].kind != declRule || b[i].kind != declRule || !bytes.Equal(a[i].name, b[i].name) || !bytes.Equal(a[i].data, b[i].data) {
+			return false
+		}
+	}
+	return true
+}
+
+// hasOnlyDecls returns true if the block contains only declarations that could be parsed.
+func (r *rule) hasOnlyDecls() bool {
+	for _, child := range r.children {
+		if child.kind != declRule || child.name == nil {
+			return false
+		}
+	}
+	return true
+}
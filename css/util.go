@@ -53,3 +53,16 @@ func rgbToToken(r, g, b float64) Token {
 	}
 	return Token{css.HashToken, val, nil, 0, 0}
 }
+
+func rgbaToToken(r, g, b, a float64) Token {
+	// r, g, b, a are in interval [0.0, 1.0]
+	if a == 1.0 {
+		return rgbToToken(r, g, b)
+	}
+	rgba := []byte{byte((r * 255.0) + 0.5), byte((g * 255.0) + 0.5), byte((b * 255.0) + 0.5), byte((a * 255.0) + 0.5)}
+
+	val := make([]byte, 9)
+	val[0] = '#'
+	hex.Encode(val[1:], rgba)
+	return minifyColor(Token{css.HashToken, val, nil, 0, 0})
+}
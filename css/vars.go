@@ -0,0 +1,235 @@
+package css
+
+import (
+	"bytes"
+	"io"
+	"sort"
+	"sync"
+
+	"github.com/tdewolff/minify/v2"
+	"github.com/tdewolff/parse/v2"
+	"github.com/tdewolff/parse/v2/css"
+)
+
+// VarNames maps original custom property names to short names. It can be shared between minifications so that custom properties have the same name in all stylesheets and style attributes, and stored as JSON so that scripts that read or set custom properties can use the short names.
+type VarNames struct {
+	Vars map[string]string `json:"vars"`
+
+	mu sync.Mutex
+}
+
+// NewVarNames returns an empty map of custom property names.
+func NewVarNames() *VarNames {
+	return &VarNames{
+		Vars: map[string]string{},
+	}
+}
+
+const varNameChars = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789_"
+
+// varName returns the i-th short custom property name.
+func varName(i int) string {
+	b := []byte("--")
+	for {
+		b = append(b, varNameChars[i%len(varNameChars)])
+		i = i/len(varNameChars) - 1
+		if i < 0 {
+			return string(b)
+		}
+	}
+}
+
+// rename renames all custom properties in the stylesheet, where the most frequent names get the shortest names. Names that are not longer than a new name keep their name. It returns false when no names were changed.
+func (names *VarNames) rename(b []byte) ([]byte, bool) {
+	z := parse.NewInputBytes(b)
+	defer z.Restore()
+
+	var tokens []css.Token
+	counts := map[string]int{}
+	l := css.NewLexer(z)
+	for {
+		tt, data := l.Next()
+		if tt == css.ErrorToken {
+			break
+		} else if tt == css.CustomPropertyNameToken {
+			counts[string(data)]++
+		}
+		tokens = append(tokens, css.Token{TokenType: tt, Data: data})
+	}
+	if len(counts) == 0 {
+		return b, false
+	}
+
+	names.mu.Lock()
+	defer names.mu.Unlock()
+	if names.Vars == nil {
+		names.Vars = map[string]string{}
+	}
+
+	var rename []string
+	for name := range counts {
+		if _, ok := names.Vars[name]; !ok {
+			rename = append(rename, name)
+		}
+	}
+	sort.Slice(rename, func(i, j int) bool {
+		if counts[rename[i]] != counts[rename[j]] {
+			return counts[rename[i]] > counts[rename[j]]
+		}
+		return rename[i] < rename[j]
+	})
+	if 0 < len(rename) {
+		used := map[string]bool{}
+		for _, newName := range names.Vars {
+			used[newName] = true
+		}
+		i := 0
+		for _, name := range rename {
+			newName := varName(i)
+			for used[newName] {
+				i++
+				newName = varName(i)
+			}
+			if len(name) <= len(newName) && !used[name] {
+				newName = name
+			} else {
+				i++
+			}
+			names.Vars[name] = newName
+			used[newName] = true
+		}
+	}
+
+	renamed := false
+	buf := &bytes.Buffer{}
+	for _, t := range tokens {
+		if t.TokenType == css.CustomPropertyNameToken {
+			if newName := names.Vars[string(t.Data)]; newName != string(t.Data) {
+				buf.WriteString(newName)
+				renamed = true
+				continue
+			}
+		}
+		buf.Write(t.Data)
+	}
+	if !renamed || l.Err() != io.EOF {
+		return b, false
+	}
+	return buf.Bytes(), true
+}
+
+// removeUnusedCustomProperties removes the declarations of custom properties that are not referenced anywhere in the stylesheet, nor by other custom properties that are used. It returns false when nothing was removed.
+func removeUnusedCustomProperties(b []byte) ([]byte, bool) {
+	rules := parseRules(b)
+	rules, ok := (&Usage{}).purgeAllCustomProperties(rules)
+	if !ok {
+		return b, false
+	}
+
+	buf := &bytes.Buffer{}
+	writeRules(buf, rules)
+	return buf.Bytes(), true
+}
+
+// minifyCustomPropertyValue minifies the numbers, dimensions, and hex colors of a custom property value, and removes whitespace around commas and slashes. Values with other tokens, such as functions and strings, are returned unchanged, as the meaning of a custom property depends on where it is used. Therefore numbers keep their type and units are kept for zero values.
+func (c *cssMinifier) minifyCustomPropertyValue(value []byte) []byte {
+	z := parse.NewInputBytes(value)
+	defer z.Restore()
+
+	var tokens []css.Token
+	l := css.NewLexer(z)
+	for {
+		tt, data := l.Next()
+		if tt == css.ErrorToken {
+			if l.Err() != io.EOF {
+				return value
+			}
+			break
+		}
+		switch tt {
+		case css.NumberToken, css.PercentageToken, css.DimensionToken, css.HashToken, css.IdentToken, css.WhitespaceToken, css.CommaToken:
+		case css.DelimToken:
+			if data[0] != '/' && data[0] != '!' {
+				return value
+			}
+		default:
+			return value
+		}
+		tokens = append(tokens, css.Token{TokenType: tt, Data: parse.Copy(data)})
+	}
+	for 0 < len(tokens) && tokens[0].TokenType == css.WhitespaceToken {
+		tokens = tokens[1:]
+	}
+	for 0 < len(tokens) && tokens[len(tokens)-1].TokenType == css.WhitespaceToken {
+		tokens = tokens[:len(tokens)-1]
+	}
+	if len(tokens) == 0 {
+		return value
+	}
+
+	b := make([]byte, 0, len(value))
+	for i, t := range tokens {
+		switch t.TokenType {
+		case css.WhitespaceToken:
+			if isSeparatorToken(tokens[i-1]) || isSeparatorToken(tokens[i+1]) {
+				continue
+			}
+			b = append(b, ' ')
+		case css.NumberToken:
+			num := c.minifyNumber(t.Data)
+			if isIntegerNumber(num) == isIntegerNumber(t.Data) {
+				t.Data = num
+			}
+			b = append(b, t.Data...)
+		case css.PercentageToken:
+			b = append(b, c.minifyNumber(t.Data[:len(t.Data)-1])...)
+			b = append(b, '%')
+		case css.DimensionToken:
+			dim, _ := c.minifyDimension(Token{TokenType: t.TokenType, Data: t.Data})
+			b = append(b, dim.Data...)
+		case css.HashToken:
+			b = append(b, minifyHexColor(t.Data, c.o.Targets.supports(hexAlphaColors))...)
+		default:
+			b = append(b, t.Data...)
+		}
+	}
+	return b
+}
+
+func (c *cssMinifier) minifyNumber(num []byte) []byte {
+	if c.o.Version <= 2 {
+		return minify.Decimal(num, c.o.Precision) // don't use exponents
+	}
+	return minify.Number(num, c.o.Precision)
+}
+
+func isSeparatorToken(t css.Token) bool {
+	return t.TokenType == css.CommaToken || t.TokenType == css.DelimToken && t.Data[0] == '/'
+}
+
+// isIntegerNumber returns true if the number is an integer type in CSS, that is without a decimal point or exponent.
+func isIntegerNumber(num []byte) bool {
+	return bytes.IndexAny(num, ".eE") == -1
+}
+
+// minifyHexColor lowercases a hex color and uses the three digit notation when possible, or the four digit notation if hexAlpha is set. Other hashes are returned unchanged.
+func minifyHexColor(hash []byte, hexAlpha bool) []byte {
+	n := len(hash) - 1
+	if n != 3 && n != 4 && n != 6 && n != 8 {
+		return hash
+	}
+	for _, c := range hash[1:] {
+		if !('0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F') {
+			return hash
+		}
+	}
+	hash = parse.ToLower(hash)
+	if (n == 6 || n == 8 && hexAlpha) && hash[1] == hash[2] && hash[3] == hash[4] && hash[5] == hash[6] && (n == 6 || hash[7] == hash[8]) {
+		short := []byte{'#', hash[1], hash[3], hash[5]}
+		if n == 8 {
+			short = append(short, hash[7])
+		}
+		return short
+	}
+	return hash
+}
@@ -481,8 +481,19 @@ func (o *Minifier) Minify(m *minify.M, w io.Writer, r io.Reader, _ map[string]st
 							if len(val) == 0 {
 								continue
 							}
+						} else if (attr.Hash == Srcset || attr.Hash == Imagesrcset) && m.RewriteURL != nil {
+							var err error
+							if val, err = rewriteSrcset(m, val); err != nil {
+								return err
+							}
 						} else if attr.Traits&urlAttr != 0 { // anchors are already handled
 							val = parse.TrimWhitespace(val)
+							if attr.Hash != Xmlns && m.RewriteURL != nil {
+								var err error
+								if val, err = minify.RewriteURL(m, "text/html", val); err != nil {
+									return err
+								}
+							}
 							if 5 < len(val) {
 								if parse.EqualFold(val[:4], httpBytes) {
 									if val[4] == ':' {
@@ -544,3 +555,38 @@ func (o *Minifier) Minify(m *minify.M, w io.Writer, r io.Reader, _ map[string]st
 		}
 	}
 }
+
+// rewriteSrcset rewrites the URLs of the image candidates in a srcset attribute with the URL rewriting callback.
+func rewriteSrcset(m *minify.M, val []byte) ([]byte, error) {
+	b := make([]byte, 0, len(val))
+	for i := 0; i < len(val); {
+		if parse.IsWhitespace(val[i]) || val[i] == ',' {
+			b = append(b, val[i])
+			i++
+			continue
+		}
+
+		// image candidate: URL followed by optional descriptors
+		start := i
+		for i < len(val) && !parse.IsWhitespace(val[i]) {
+			i++
+		}
+		end := i
+		for start < end && val[end-1] == ',' {
+			end-- // trailing commas separate candidates without descriptors
+		}
+		url, err := minify.RewriteURL(m, "text/html", val[start:end])
+		if err != nil {
+			return val, err
+		}
+		b = append(b, url...)
+		b = append(b, val[end:i]...)
+		if end == i {
+			for i < len(val) && val[i] != ',' {
+				b = append(b, val[i])
+				i++
+			}
+		}
+	}
+	return b, nil
+}
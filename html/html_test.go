@@ -367,6 +367,46 @@ func TestHTMLURL(t *testing.T) {
 	}
 }
 
+func TestHTMLRewriteURL(t *testing.T) {
+	htmlTests := []struct {
+		html     string
+		expected string
+	}{
+		{`<a href="/about">x</a>`, `<a href=https://cdn.example.com/about>x</a>`},
+		{`<img src=a.png srcset="a.png 1x, b.png 2x">`, `<img src=https://cdn.example.com/a.png srcset="https://cdn.example.com/a.png 1x, https://cdn.example.com/b.png 2x">`},
+		{`<img srcset="a.png, b.png 2x">`, `<img srcset="https://cdn.example.com/a.png, https://cdn.example.com/b.png 2x">`},
+		{`<link rel=preload as=image imagesrcset="a,b.png 100w">`, `<link rel=preload as=image imagesrcset="https://cdn.example.com/a,b.png 100w">`},
+		{`<video poster=p.jpg></video>`, `<video poster=https://cdn.example.com/p.jpg></video>`},
+		{`<a href="#top">x</a><img src="data:,x">`, `<a href=#top>x</a><img src=data:,x>`},
+		{`<html xmlns="http://www.w3.org/1999/xhtml"></html>`, `<html xmlns=http://www.w3.org/1999/xhtml>`},
+		{`<p style="background:url(a.png)">`, `<p style=background:url(https://cdn.example.com/a.png)>`},
+	}
+
+	m := minify.New()
+	m.AddFunc("text/css", css.Minify)
+	m.RewriteURL = func(mediatype, url string) (string, error) {
+		if url == "error.png" {
+			return "", fmt.Errorf("cannot rewrite %s", url)
+		}
+		return "https://cdn.example.com/" + strings.TrimPrefix(url, "/"), nil
+	}
+	for _, tt := range htmlTests {
+		t.Run(tt.html, func(t *testing.T) {
+			r := bytes.NewBufferString(tt.html)
+			w := &bytes.Buffer{}
+			err := Minify(m, w, r, nil)
+			test.Minify(t, tt.html, err, w.String(), tt.expected)
+		})
+	}
+
+	for _, html := range []string{`<img src=error.png>`, `<img srcset="a.png, error.png 2x">`} {
+		t.Run(html, func(t *testing.T) {
+			err := Minify(m, &bytes.Buffer{}, bytes.NewBufferString(html), nil)
+			test.T(t, fmt.Sprint(err), "cannot rewrite error.png")
+		})
+	}
+}
+
 func TestHTMLGoTemplates(t *testing.T) {
 	htmlTests := []struct {
 		html     string
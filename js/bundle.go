@@ -0,0 +1,1017 @@
+package js
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"path"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/tdewolff/minify/v2"
+	"github.com/tdewolff/parse/v2"
+	"github.com/tdewolff/parse/v2/js"
+)
+
+// Chunk is an output file of a bundle.
+type Chunk struct {
+	Name string // file name relative to the output of the entry point, empty for the entry point itself
+	Data []byte
+}
+
+// bundleDep is an imported module, either a bundled module or an external module such as a package.
+type bundleDep struct {
+	mod  *bundleModule
+	spec string // specifier of an external module
+}
+
+// bundleImport is an imported binding.
+type bundleImport struct {
+	dep  bundleDep
+	name string // imported name, * for the namespace
+}
+
+// bundleExport is an exported binding, which is either a local variable, a local name that may be an import binding, or a re-exported binding.
+type bundleExport struct {
+	v     *js.Var
+	local string
+	imp   *bundleImport
+}
+
+// bundleRef is a resolved binding: a local variable of a module, the namespace of a module, or a binding of an external module.
+type bundleRef struct {
+	mod  *bundleModule // nil for external modules
+	v    *js.Var       // nil for the namespace of mod
+	spec string
+	name string
+}
+
+type bundleModule struct {
+	path    string
+	ast     *js.AST
+	list    []js.IStmt // statements without imports and exports
+	vars    []*js.Var  // declarations added for default exports
+	index   int        // order of evaluation
+	reach   []bool     // entry points from which the module is imported statically
+	chunk   *bundleChunk
+	deps    []bundleDep
+	imports map[string]bundleImport // local name => import
+	exports map[string]bundleExport // exported name => binding
+	stars   []bundleDep             // export * from
+	dynamic map[*js.CallExpr]*bundleModule
+	ns      *js.Var // namespace object
+	nsDone  bool
+}
+
+type bundleChunk struct {
+	name    string
+	root    *bundleModule // entry point whose exports are exported by the chunk
+	modules []*bundleModule
+
+	ast      *js.AST
+	m        *jsMinifier
+	globals  []*js.Var                     // free variables of generated code
+	vars     []*js.Var                     // import bindings of other chunks and external modules
+	proxies  map[*js.Var]*js.Var           // variable of another chunk => import binding
+	external map[string]map[string]*js.Var // specifier => imported name => import binding
+	exported map[*js.Var]bool              // variables imported by other chunks
+	exports  []string
+	refs     []*js.Var
+}
+
+type bundler struct {
+	o       *Minifier
+	fsys    fs.FS
+	m       *jsMinifier
+	split   bool
+	modules map[string]*bundleModule
+	roots   []*bundleModule // entry point and dynamically imported modules
+	order   []*bundleModule
+	chunks  []*bundleChunk
+	outputs map[*bundleModule]*bundleChunk // chunk that exports the entry point
+}
+
+// Bundle bundles the ES module at the entry path of fsys together with all modules it imports using relative specifiers. The modules are hoisted into a single scope where the top-level variables are renamed so that they do not collide, and exports that are not used are removed (tree shaking). Imports of other modules, such as packages, are kept. Dynamically imported modules are included in the bundle, unless split is set in which case they are written to separate chunks that are loaded on demand, together with chunks for the modules they share. The first chunk is the entry point. Modules are evaluated eagerly and in the order they are first imported.
+func (o *Minifier) Bundle(fsys fs.FS, entry string, split bool) ([]Chunk, error) {
+	b := &bundler{
+		o:       o,
+		fsys:    fsys,
+		m:       &jsMinifier{o: o, pure: map[js.IExpr]bool{}},
+		split:   split,
+		modules: map[string]*bundleModule{},
+		outputs: map[*bundleModule]*bundleChunk{},
+	}
+	entryMod, err := b.load(path.Clean(entry))
+	if err != nil {
+		return nil, err
+	}
+	roots := []*bundleModule{entryMod}
+	for _, root := range b.roots {
+		if root != entryMod {
+			roots = append(roots, root)
+		}
+	}
+	b.roots = roots
+
+	b.sortModules()
+	b.assignChunks()
+	if err := b.link(); err != nil {
+		return nil, err
+	}
+
+	// mangled property names must be the same in all chunks
+	o2 := *o
+	if o2.MangleProps != nil && o2.NameCache == nil {
+		o2.NameCache = NewNameCache()
+	}
+	for _, chunk := range b.chunks {
+		if err := b.optimize(&o2, chunk); err != nil {
+			return nil, err
+		}
+	}
+	chunks := make([]Chunk, 0, len(b.chunks))
+	for _, chunk := range b.chunks {
+		chunks = append(chunks, Chunk{chunk.name, b.write(chunk)})
+	}
+	sort.SliceStable(chunks, func(i, j int) bool {
+		return chunks[i].Name == "" && chunks[j].Name != ""
+	})
+	return chunks, nil
+}
+
+// resolve returns the path of the module imported by the specifier, and false for external modules.
+func (b *bundler) resolve(importer, spec string) (string, bool, error) {
+	var p string
+	if strings.HasPrefix(spec, "./") || strings.HasPrefix(spec, "../") {
+		p = path.Join(path.Dir(importer), spec)
+	} else if strings.HasPrefix(spec, "/") {
+		p = path.Clean(spec[1:])
+	} else {
+		return "", false, nil
+	}
+	for _, candidate := range []string{p, p + ".js", p + ".mjs", p + "/index.js"} {
+		if info, err := fs.Stat(b.fsys, candidate); err == nil && !info.IsDir() {
+			return candidate, true, nil
+		}
+	}
+	return "", false, fmt.Errorf("%s: cannot resolve %s", importer, spec)
+}
+
+// dep loads the imported module, the specifier is a quoted string.
+func (b *bundler) dep(importer string, quoted []byte) (bundleDep, error) {
+	spec := string(quoted[1 : len(quoted)-1])
+	p, ok, err := b.resolve(importer, spec)
+	if err != nil {
+		return bundleDep{}, err
+	} else if !ok {
+		return bundleDep{spec: spec}, nil
+	}
+	mod, err := b.load(p)
+	if err != nil {
+		return bundleDep{}, err
+	}
+	return bundleDep{mod: mod}, nil
+}
+
+// load parses the module and the modules it imports, it removes its import and export statements and records the bindings instead.
+func (b *bundler) load(p string) (*bundleModule, error) {
+	if mod, ok := b.modules[p]; ok {
+		return mod, nil
+	}
+	src, err := fs.ReadFile(b.fsys, p)
+	if err != nil {
+		return nil, err
+	}
+	ast, err := b.m.parse(parse.NewInputBytes(src), js.Options{WhileToFor: true})
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", p, err)
+	}
+
+	mod := &bundleModule{
+		path:    p,
+		ast:     ast,
+		imports: map[string]bundleImport{},
+		exports: map[string]bundleExport{},
+		dynamic: map[*js.CallExpr]*bundleModule{},
+	}
+	b.modules[p] = mod
+	for _, item := range ast.List {
+		switch stmt := item.(type) {
+		case *js.ImportStmt:
+			dep, err := b.dep(p, stmt.Module)
+			if err != nil {
+				return nil, err
+			}
+			mod.deps = append(mod.deps, dep)
+			if stmt.Default != nil {
+				mod.imports[string(stmt.Default)] = bundleImport{dep, "default"}
+			}
+			for _, alias := range stmt.List {
+				if alias.Binding != nil {
+					name := alias.Binding
+					if alias.Name != nil {
+						name = alias.Name
+					}
+					mod.imports[string(alias.Binding)] = bundleImport{dep, exportName(name)}
+				}
+			}
+		case *js.ExportStmt:
+			if stmt.Module != nil {
+				dep, err := b.dep(p, stmt.Module)
+				if err != nil {
+					return nil, err
+				}
+				mod.deps = append(mod.deps, dep)
+				for _, alias := range stmt.List {
+					if alias.Name == nil && bytes.Equal(alias.Binding, starBytes) {
+						mod.stars = append(mod.stars, dep)
+					} else if alias.Binding != nil {
+						mod.exports[exportName(alias.Binding)] = bundleExport{imp: &bundleImport{dep, exportName(localName(alias))}}
+					}
+				}
+			} else if stmt.Decl == nil {
+				for _, alias := range stmt.List {
+					if alias.Binding != nil {
+						mod.exports[exportName(alias.Binding)] = bundleExport{local: string(localName(alias))}
+					}
+				}
+			} else if !stmt.Default {
+				switch decl := stmt.Decl.(type) {
+				case *js.VarDecl:
+					var vs []*js.Var
+					for _, item := range decl.List {
+						vs = appendBindingVars(vs, item.Binding)
+					}
+					for _, v := range vs {
+						mod.exports[string(v.Data)] = bundleExport{v: v}
+					}
+				case *js.FuncDecl:
+					mod.exports[string(decl.Name.Data)] = bundleExport{v: decl.Name}
+				case *js.ClassDecl:
+					mod.exports[string(decl.Name.Data)] = bundleExport{v: decl.Name}
+				}
+				mod.list = append(mod.list, stmt.Decl.(js.IStmt))
+			} else {
+				mod.list = append(mod.list, mod.exportDefault(stmt.Decl))
+			}
+		default:
+			mod.list = append(mod.list, item)
+		}
+	}
+
+	// dynamic imports with a relative specifier
+	var err2 error
+	js.Walk(exprReplacer(func(i js.IExpr) js.IExpr {
+		if call, ok := i.(*js.CallExpr); ok && len(call.Args.List) == 1 && !call.Args.List[0].Rest {
+			callee, ok := call.X.(*js.LiteralExpr)
+			spec, ok2 := call.Args.List[0].Value.(*js.LiteralExpr)
+			if ok && ok2 && callee.TokenType == js.ImportToken && spec.TokenType == js.StringToken {
+				if dep, err := b.dep(p, spec.Data); err != nil {
+					err2 = err
+				} else if dep.mod != nil {
+					mod.dynamic[call] = dep.mod
+					if !dep.mod.isRoot(b.roots) {
+						b.roots = append(b.roots, dep.mod)
+					}
+				}
+			}
+		}
+		return i
+	}), &js.BlockStmt{List: mod.list})
+	if err2 != nil {
+		return nil, err2
+	}
+	return mod, nil
+}
+
+func (mod *bundleModule) isRoot(roots []*bundleModule) bool {
+	for _, root := range roots {
+		if root == mod {
+			return true
+		}
+	}
+	return false
+}
+
+// exportDefault returns the declaration of the default export.
+func (mod *bundleModule) exportDefault(i js.IExpr) js.IStmt {
+	switch decl := i.(type) {
+	case *js.FuncDecl:
+		if decl.Name == nil {
+			decl.Name = mod.declare("default", js.FunctionDecl)
+		}
+		if mod.isDeclared(decl.Name) {
+			mod.exports["default"] = bundleExport{v: decl.Name}
+			return decl
+		}
+	case *js.ClassDecl:
+		if decl.Name == nil {
+			decl.Name = mod.declare("default", js.LexicalDecl)
+		}
+		if mod.isDeclared(decl.Name) {
+			mod.exports["default"] = bundleExport{v: decl.Name}
+			return decl
+		}
+	}
+	v := mod.declare("default", js.VariableDecl)
+	mod.exports["default"] = bundleExport{v: v}
+	varDecl := &js.VarDecl{
+		TokenType: js.VarToken,
+		List:      []js.BindingElement{{Binding: v, Default: i}},
+		Scope:     &mod.ast.Scope,
+	}
+	mod.ast.Scope.VarDecls = append(mod.ast.Scope.VarDecls, varDecl)
+	return varDecl
+}
+
+// declare adds a top-level variable named after the module.
+func (mod *bundleModule) declare(name string, decl js.DeclType) *js.Var {
+	v := &js.Var{Data: append(identifierName(path.Base(mod.path)), "_"+name...), Uses: 1, Decl: decl}
+	mod.vars = append(mod.vars, v)
+	return v
+}
+
+func (mod *bundleModule) isDeclared(v *js.Var) bool {
+	for _, w := range mod.ast.Scope.Declared {
+		if v == w {
+			return true
+		}
+	}
+	for _, w := range mod.vars {
+		if v == w {
+			return true
+		}
+	}
+	return false
+}
+
+// sortModules orders the modules by their evaluation order, where imported modules are evaluated before the importing module.
+func (b *bundler) sortModules() {
+	visited := map[*bundleModule]bool{}
+	var visit func(*bundleModule)
+	visit = func(mod *bundleModule) {
+		if visited[mod] {
+			return
+		}
+		visited[mod] = true
+		for _, dep := range mod.deps {
+			if dep.mod != nil {
+				visit(dep.mod)
+			}
+		}
+		mod.index = len(b.order)
+		b.order = append(b.order, mod)
+	}
+	for _, root := range b.roots {
+		visit(root)
+	}
+}
+
+// assignChunks puts the modules that are imported statically by the same entry points in the same chunk. Without splitting there is only one chunk.
+func (b *bundler) assignChunks() {
+	if !b.split {
+		chunk := &bundleChunk{root: b.roots[0], modules: b.order}
+		for _, mod := range b.order {
+			mod.chunk = chunk
+		}
+		b.chunks = append(b.chunks, chunk)
+		b.outputs[b.roots[0]] = chunk
+		return
+	}
+
+	for i, root := range b.roots {
+		var visit func(*bundleModule)
+		visit = func(mod *bundleModule) {
+			if mod.reach == nil {
+				mod.reach = make([]bool, len(b.roots))
+			} else if mod.reach[i] {
+				return
+			}
+			mod.reach[i] = true
+			for _, dep := range mod.deps {
+				if dep.mod != nil {
+					visit(dep.mod)
+				}
+			}
+		}
+		visit(root)
+	}
+
+	keys := map[string]*bundleChunk{}
+	for _, mod := range b.order {
+		key := fmt.Sprint(mod.reach)
+		chunk, ok := keys[key]
+		if !ok {
+			chunk = &bundleChunk{}
+			keys[key] = chunk
+			b.chunks = append(b.chunks, chunk)
+		}
+		chunk.modules = append(chunk.modules, mod)
+		mod.chunk = chunk
+	}
+
+	// entry points that share their chunk with other entry points are exported by a separate chunk
+	for i, root := range b.roots {
+		chunk := root.chunk
+		for j, reach := range root.reach {
+			if reach && j != i {
+				chunk = &bundleChunk{}
+				b.chunks = append(b.chunks, chunk)
+				break
+			}
+		}
+		chunk.root = root
+		b.outputs[root] = chunk
+	}
+
+	n := 0
+	for _, chunk := range b.chunks {
+		if chunk.root != b.roots[0] {
+			n++
+			chunk.name = "chunk-" + strconv.Itoa(n) + ".js"
+		}
+	}
+}
+
+// resolveExport returns the binding that the module exports by the name.
+func (b *bundler) resolveExport(mod *bundleModule, name string, visited map[*bundleModule]bool) (bundleRef, bool, error) {
+	if visited[mod] {
+		return bundleRef{}, false, nil
+	}
+	visited[mod] = true
+	defer delete(visited, mod)
+
+	if export, ok := mod.exports[name]; ok {
+		if export.v != nil {
+			return bundleRef{mod: mod, v: export.v}, true, nil
+		} else if export.imp != nil {
+			return b.resolveImport(mod, *export.imp, visited)
+		}
+		for _, v := range mod.ast.Scope.Declared {
+			if string(v.Data) == export.local {
+				return bundleRef{mod: mod, v: v}, true, nil
+			}
+		}
+		if imp, ok := mod.imports[export.local]; ok {
+			return b.resolveImport(mod, imp, visited)
+		}
+		return bundleRef{}, false, fmt.Errorf("%s: %s is not declared", mod.path, export.local)
+	} else if name != "default" {
+		for _, star := range mod.stars {
+			if star.mod != nil {
+				if ref, ok, err := b.resolveExport(star.mod, name, visited); ok || err != nil {
+					return ref, ok, err
+				}
+			}
+		}
+		for _, star := range mod.stars {
+			if star.mod == nil {
+				return bundleRef{spec: star.spec, name: name}, true, nil
+			}
+		}
+	}
+	return bundleRef{}, false, nil
+}
+
+// resolveImport returns the binding of the import.
+func (b *bundler) resolveImport(mod *bundleModule, imp bundleImport, visited map[*bundleModule]bool) (bundleRef, bool, error) {
+	if imp.dep.mod == nil {
+		return bundleRef{spec: imp.dep.spec, name: imp.name}, true, nil
+	} else if imp.name == "*" {
+		return bundleRef{mod: imp.dep.mod}, true, nil
+	}
+	ref, ok, err := b.resolveExport(imp.dep.mod, imp.name, visited)
+	if err == nil && !ok {
+		err = fmt.Errorf("%s: %s does not export %s", mod.path, imp.dep.mod.path, imp.name)
+	}
+	return ref, ok, err
+}
+
+// exportNames returns the names exported by the module in sorted order, including those of export * from, except for external modules.
+func (b *bundler) exportNames(mod *bundleModule, visited map[*bundleModule]bool) []string {
+	if visited[mod] {
+		return nil
+	}
+	visited[mod] = true
+
+	names := make([]string, 0, len(mod.exports))
+	for name := range mod.exports {
+		names = append(names, name)
+	}
+	for _, star := range mod.stars {
+		if star.mod != nil {
+			for _, name := range b.exportNames(star.mod, visited) {
+				if _, ok := mod.exports[name]; !ok && name != "default" {
+					names = append(names, name)
+				}
+			}
+		}
+	}
+	sort.Strings(names)
+	return slices.Compact(names)
+}
+
+// externalStars adds the external modules that are re-exported by export * from, directly or through other modules.
+func (b *bundler) externalStars(mod *bundleModule, stars map[string]bool, visited map[*bundleModule]bool) {
+	if visited[mod] {
+		return
+	}
+	visited[mod] = true
+	for _, star := range mod.stars {
+		if star.mod == nil {
+			stars[star.spec] = true
+		} else {
+			b.externalStars(star.mod, stars, visited)
+		}
+	}
+}
+
+// varFor returns the variable in the chunk for the binding.
+func (b *bundler) varFor(chunk *bundleChunk, ref bundleRef) *js.Var {
+	if ref.mod == nil {
+		if chunk.external == nil {
+			chunk.external = map[string]map[string]*js.Var{}
+		}
+		if chunk.external[ref.spec] == nil {
+			chunk.external[ref.spec] = map[string]*js.Var{}
+		}
+		v, ok := chunk.external[ref.spec][ref.name]
+		if !ok {
+			name := ref.name
+			if name == "*" || name == "default" {
+				name = path.Base(ref.spec)
+			}
+			v = &js.Var{Data: identifierName(name), Decl: js.LexicalDecl}
+			chunk.external[ref.spec][ref.name] = v
+			chunk.vars = append(chunk.vars, v)
+		}
+		return v
+	}
+
+	v := ref.v
+	if v == nil {
+		v = ref.mod.namespace()
+	}
+	if ref.mod.chunk == chunk {
+		return v
+	}
+	if chunk.proxies == nil {
+		chunk.proxies = map[*js.Var]*js.Var{}
+	}
+	proxy, ok := chunk.proxies[v]
+	if !ok {
+		proxy = &js.Var{Data: append([]byte{}, v.Data...), Decl: js.LexicalDecl}
+		chunk.proxies[v] = proxy
+		chunk.vars = append(chunk.vars, proxy)
+
+		exporter := ref.mod.chunk
+		if exporter.exported == nil {
+			exporter.exported = map[*js.Var]bool{}
+		}
+		if !exporter.exported[v] {
+			exporter.exported[v] = true
+			v.Uses++
+		}
+	}
+	return proxy
+}
+
+// namespace returns the variable of the namespace object of the module.
+func (mod *bundleModule) namespace() *js.Var {
+	if mod.ns == nil {
+		mod.ns = mod.declare("ns", js.VariableDecl)
+	}
+	return mod.ns
+}
+
+// linkVar makes the variable refer to the target variable.
+func linkVar(v, target *js.Var) {
+	v.Link = target
+	target.Uses += v.Uses
+}
+
+// parseSnippet parses generated code, in which the identifiers $0, $1, ... refer to the given variables. Other free variables are added to the globals of the chunk.
+func (chunk *bundleChunk) parseSnippet(src string, vars []*js.Var) (js.IExpr, error) {
+	ast, err := js.Parse(parse.NewInputString("("+src+")"), js.Options{})
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range ast.Scope.Undeclared {
+		if v.Data[0] == '$' {
+			i, _ := strconv.Atoi(string(v.Data[1:]))
+			linkVar(v, vars[i])
+		} else {
+			chunk.globals = append(chunk.globals, v)
+		}
+	}
+	return ast.List[0].(*js.ExprStmt).Value.(*js.GroupExpr).X, nil
+}
+
+// link resolves the imports of all modules and makes their variables refer to the imported variables.
+func (b *bundler) link() error {
+	for _, root := range b.roots {
+		chunk, ok := b.outputs[root]
+		if !ok {
+			continue // dynamically imported without splitting
+		}
+		for _, name := range b.exportNames(root, map[*bundleModule]bool{}) {
+			ref, ok, err := b.resolveExport(root, name, map[*bundleModule]bool{})
+			if err != nil {
+				return err
+			} else if ok {
+				v := b.varFor(chunk, ref)
+				v.Uses++
+				chunk.exports = append(chunk.exports, name)
+				chunk.refs = append(chunk.refs, v)
+			}
+		}
+	}
+
+	for _, mod := range b.order {
+		// unused imports must exist too
+		names := make([]string, 0, len(mod.imports))
+		for name := range mod.imports {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if _, _, err := b.resolveImport(mod, mod.imports[name], map[*bundleModule]bool{}); err != nil {
+				return err
+			}
+		}
+
+		for _, v := range mod.ast.Scope.Undeclared {
+			if v.Link != nil {
+				continue
+			} else if imp, ok := mod.imports[string(v.Data)]; ok {
+				ref, _, err := b.resolveImport(mod, imp, map[*bundleModule]bool{})
+				if err != nil {
+					return err
+				}
+				linkVar(v, b.varFor(mod.chunk, ref))
+			}
+		}
+
+		var err error
+		js.Walk(exprReplacer(func(i js.IExpr) js.IExpr {
+			call, ok := i.(*js.CallExpr)
+			if !ok || mod.dynamic[call] == nil {
+				return i
+			}
+			target := mod.dynamic[call]
+			if b.split && target != b.roots[0] {
+				call.Args.List[0].Value = &js.LiteralExpr{TokenType: js.StringToken, Data: []byte(strconv.Quote("./" + b.outputs[target].name))}
+				return i
+			}
+			var expr js.IExpr
+			expr, err = mod.chunk.parseSnippet("Promise.resolve().then(()=>$0)", []*js.Var{b.varFor(mod.chunk, bundleRef{mod: target})})
+			if err != nil {
+				return i
+			}
+			return expr
+		}), &js.BlockStmt{List: mod.list})
+		if err != nil {
+			return err
+		}
+	}
+
+	// namespace objects may require other namespace objects
+	for changed := true; changed; {
+		changed = false
+		for _, mod := range b.order {
+			if mod.ns != nil && !mod.nsDone {
+				if err := b.declareNamespace(mod); err != nil {
+					return err
+				}
+				changed = true
+			}
+		}
+	}
+	return nil
+}
+
+// declareNamespace adds the declaration of the namespace object with a getter for every export to the module.
+func (b *bundler) declareNamespace(mod *bundleModule) error {
+	mod.nsDone = true
+	var sb strings.Builder
+	var vars []*js.Var
+	sb.WriteString("{__proto__:null")
+	for _, name := range b.exportNames(mod, map[*bundleModule]bool{}) {
+		ref, ok, err := b.resolveExport(mod, name, map[*bundleModule]bool{})
+		if err != nil {
+			return err
+		} else if ok {
+			sb.WriteString(",get ")
+			sb.Write(propertyName(name))
+			sb.WriteString("(){return $")
+			sb.WriteString(strconv.Itoa(len(vars)))
+			sb.WriteString("}")
+			vars = append(vars, b.varFor(mod.chunk, ref))
+		}
+	}
+	sb.WriteString("}")
+	expr, err := mod.chunk.parseSnippet(sb.String(), vars)
+	if err != nil {
+		return err
+	}
+	varDecl := &js.VarDecl{
+		TokenType: js.VarToken,
+		List:      []js.BindingElement{{Binding: mod.ns, Default: expr}},
+		Scope:     &mod.ast.Scope,
+	}
+	mod.ast.Scope.VarDecls = append(mod.ast.Scope.VarDecls, varDecl)
+	mod.list = append([]js.IStmt{varDecl}, mod.list...)
+	return nil
+}
+
+// scopeMover moves the top-level statements of a module into the scope of the chunk.
+type scopeMover struct {
+	from, to *js.Scope
+}
+
+func (s scopeMover) move(scope *js.Scope) {
+	if scope.Parent == s.from {
+		scope.Parent = s.to
+	}
+	if scope.Func == s.from {
+		scope.Func = s.to
+	}
+}
+
+func (s scopeMover) Enter(n js.INode) js.IVisitor {
+	switch node := n.(type) {
+	case *js.BlockStmt:
+		s.move(&node.Scope)
+	case *js.SwitchStmt:
+		s.move(&node.Scope)
+	case *js.VarDecl:
+		if node.Scope == s.from {
+			node.Scope = s.to
+		}
+	}
+	return s
+}
+
+func (scopeMover) Exit(js.INode) {}
+
+// optimize hoists the modules of the chunk into a single scope, removes unused declarations, and renames the variables.
+func (b *bundler) optimize(o *Minifier, chunk *bundleChunk) error {
+	ast := &js.AST{}
+	ast.Scope.Func = &ast.Scope
+	ast.Scope.IsGlobalOrFunc = true
+	for _, mod := range chunk.modules {
+		js.Walk(scopeMover{&mod.ast.Scope, &ast.Scope}, &js.BlockStmt{List: mod.list})
+		ast.List = append(ast.List, mod.list...)
+		ast.Scope.Declared = append(ast.Scope.Declared, mod.ast.Scope.Declared...)
+		ast.Scope.Declared = append(ast.Scope.Declared, mod.vars...)
+		ast.Scope.VarDecls = append(ast.Scope.VarDecls, mod.ast.Scope.VarDecls...)
+		for _, v := range mod.ast.Scope.Undeclared {
+			if v.Link == nil {
+				ast.Scope.Undeclared = append(ast.Scope.Undeclared, v)
+			}
+		}
+	}
+	ast.Scope.Declared = append(ast.Scope.Declared, chunk.vars...)
+	ast.Scope.Undeclared = append(ast.Scope.Undeclared, chunk.globals...)
+	chunk.ast = ast
+
+	m := &jsMinifier{
+		o:       o,
+		renamer: newRenamer(!o.KeepVarNames, !o.useAlphabetVarNames),
+		pure:    b.m.pure,
+		legal:   b.m.legal,
+	}
+	chunk.m = m
+	if err := m.optimize(ast, true); err != nil {
+		return err
+	}
+
+	// exported names are aliased, but they must not be the same as the names of variables exported to other chunks
+	scope := ast.Scope
+	if 0 < len(chunk.exported) {
+		scope.Undeclared = scope.Undeclared[:len(scope.Undeclared):len(scope.Undeclared)]
+		for _, name := range chunk.exports {
+			scope.Undeclared = append(scope.Undeclared, &js.Var{Data: []byte(name)})
+		}
+	}
+	if m.renamer.rename {
+		m.renamer.renameScope(scope)
+	} else {
+		deconflict(scope)
+		js.Walk(deconflicter{}, &js.BlockStmt{List: ast.List})
+	}
+	return nil
+}
+
+// deconflict renames variables that have the same name as other variables in the scope or as the variables it references, when variables are not renamed otherwise. Top-level variables of different modules may have the same name, and nested variables may shadow the variables that imports refer to.
+func deconflict(scope js.Scope) {
+	used := map[string]bool{}
+	for _, v := range scope.Undeclared {
+		for v.Link != nil {
+			v = v.Link
+		}
+		used[string(v.Data)] = true
+	}
+	for _, v := range scope.Declared {
+		name := string(v.Data)
+		for i := 1; used[name]; i++ {
+			name = string(v.Data) + "$" + strconv.Itoa(i)
+		}
+		v.Data = []byte(name)
+		used[name] = true
+	}
+}
+
+// deconflicter deconflicts the variables of nested scopes, parent scopes are visited first.
+type deconflicter struct{}
+
+func (d deconflicter) Enter(n js.INode) js.IVisitor {
+	switch node := n.(type) {
+	case *js.BlockStmt:
+		deconflict(node.Scope)
+	case *js.SwitchStmt:
+		deconflict(node.Scope)
+	}
+	return d
+}
+
+func (deconflicter) Exit(js.INode) {}
+
+// write writes the chunk with its imports and exports.
+func (b *bundler) write(chunk *bundleChunk) []byte {
+	var list []js.IStmt
+
+	// imports of other chunks and external modules in order of evaluation
+	seen := map[any]bool{}
+	var deps []bundleDep
+	for _, mod := range chunk.modules {
+		for _, dep := range mod.deps {
+			if dep.mod == nil && !seen[dep.spec] {
+				seen[dep.spec] = true
+				deps = append(deps, dep)
+			} else if dep.mod != nil && dep.mod.chunk != chunk && !seen[dep.mod.chunk] {
+				seen[dep.mod.chunk] = true
+				deps = append(deps, dep)
+			}
+		}
+	}
+	if chunk.root != nil && chunk.root.chunk != chunk && !seen[chunk.root.chunk] {
+		seen[chunk.root.chunk] = true
+		deps = append(deps, bundleDep{mod: chunk.root})
+	}
+	for _, other := range b.chunks {
+		if !seen[other] {
+			for v := range chunk.proxies {
+				if other.exported[v] {
+					seen[other] = true
+					deps = append(deps, bundleDep{mod: other.modules[0]})
+					break
+				}
+			}
+		}
+	}
+
+	stars := map[string]bool{}
+	if chunk.root != nil {
+		b.externalStars(chunk.root, stars, map[*bundleModule]bool{})
+	}
+	for _, dep := range deps {
+		if dep.mod != nil {
+			other := dep.mod.chunk
+			stmt := &js.ImportStmt{Module: []byte(strconv.Quote("./" + other.name))}
+			for _, v := range sortedVars(other.exported) {
+				if proxy, ok := chunk.proxies[v]; ok && 0 < proxy.Uses {
+					stmt.List = append(stmt.List, alias(v.Data, proxy.Data))
+				}
+			}
+			list = append(list, stmt)
+		} else if stmts := chunk.importExternal(dep.spec, b.m.isPureModule(dep.spec)); stars[dep.spec] {
+			// re-export the external module in place of its side-effect import
+			for _, stmt := range stmts {
+				if imp := stmt.(*js.ImportStmt); imp.Default != nil || imp.List != nil {
+					list = append(list, imp)
+				}
+			}
+			list = append(list, &js.ExportStmt{List: []js.Alias{{Binding: starBytes}}, Module: []byte(strconv.Quote(dep.spec))})
+		} else {
+			list = append(list, stmts...)
+		}
+	}
+
+	list = append(list, chunk.ast.List...)
+	if 0 < len(chunk.exported) || 0 < len(chunk.exports) {
+		stmt := &js.ExportStmt{}
+		for _, v := range sortedVars(chunk.exported) {
+			stmt.List = append(stmt.List, js.Alias{Binding: v.Data})
+		}
+		for i, name := range chunk.exports {
+			stmt.List = append(stmt.List, alias(chunk.refs[i].Data, propertyName(name)))
+		}
+		if 0 < len(stmt.List) {
+			list = append(list, stmt)
+		}
+	}
+
+	buf := &bytes.Buffer{}
+	m := chunk.m
+	m.w = buf
+	for _, item := range list {
+		m.writeSemicolon()
+		m.minifyStmt(item)
+	}
+	minify.WriteLegalComments(buf, m.o.LegalComments, m.legalComments) // writing to a bytes.Buffer does not fail
+	return buf.Bytes()
+}
+
+// importExternal returns the import statements of the external module for the used bindings. Without bindings, the module is imported for its side effects unless it is pure.
+func (chunk *bundleChunk) importExternal(spec string, pure bool) []js.IStmt {
+	quoted := []byte(strconv.Quote(spec))
+	stmt := &js.ImportStmt{Module: quoted}
+	var nsStmt *js.ImportStmt
+	names := make([]string, 0, len(chunk.external[spec]))
+	for name := range chunk.external[spec] {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		v := chunk.external[spec][name]
+		if v.Uses == 0 {
+			continue
+		} else if name == "default" {
+			stmt.Default = v.Data
+		} else if name == "*" {
+			nsStmt = &js.ImportStmt{List: []js.Alias{{Name: starBytes, Binding: v.Data}}, Module: quoted}
+		} else {
+			stmt.List = append(stmt.List, alias(propertyName(name), v.Data))
+		}
+	}
+
+	var list []js.IStmt
+	if nsStmt != nil {
+		if stmt.Default != nil && stmt.List == nil {
+			nsStmt.Default = stmt.Default
+			return append(list, nsStmt)
+		}
+		list = append(list, nsStmt)
+	}
+	if stmt.Default != nil || stmt.List != nil || nsStmt == nil && !pure {
+		list = append(list, stmt)
+	}
+	return list
+}
+
+// sortedVars returns the variables in order of their name.
+func sortedVars(vs map[*js.Var]bool) []*js.Var {
+	list := make([]*js.Var, 0, len(vs))
+	for v := range vs {
+		list = append(list, v)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return bytes.Compare(list[i].Data, list[j].Data) < 0
+	})
+	return list
+}
+
+// alias returns the import or export specifier that renames name to binding.
+func alias(name, binding []byte) js.Alias {
+	if bytes.Equal(name, binding) {
+		return js.Alias{Binding: binding}
+	}
+	return js.Alias{Name: name, Binding: binding}
+}
+
+// exportName returns the name of an import or export specifier, which may be a string.
+func exportName(name []byte) string {
+	if name[0] == '"' || name[0] == '\'' {
+		return string(name[1 : len(name)-1])
+	}
+	return string(name)
+}
+
+// propertyName returns the name as an identifier or a string.
+func propertyName(name string) []byte {
+	if js.AsIdentifierName([]byte(name)) {
+		return []byte(name)
+	}
+	return []byte(strconv.Quote(name))
+}
+
+// identifierName returns a valid identifier for the name, such as for a file name.
+func identifierName(name string) []byte {
+	name = strings.TrimSuffix(name, path.Ext(name))
+	b := make([]byte, 0, len(name)+1)
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || c == '_' || c == '$' {
+			b = append(b, c)
+		} else {
+			b = append(b, '_')
+		}
+	}
+	if len(b) == 0 || '0' <= b[0] && b[0] <= '9' {
+		b = append([]byte{'_'}, b...)
+	}
+	return b
+}
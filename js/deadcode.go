@@ -0,0 +1,538 @@
+package js
+
+import (
+	"bytes"
+
+	"github.com/tdewolff/parse/v2/js"
+)
+
+// useDecrementer decrements the number of uses of all variables in the visited nodes, it is used for code that is removed.
+type useDecrementer struct{}
+
+func (d useDecrementer) Enter(n js.INode) js.IVisitor {
+	if v, ok := n.(*js.Var); ok {
+		for ; v != nil; v = v.Link {
+			if 0 < v.Uses {
+				v.Uses--
+			}
+		}
+	}
+	return d
+}
+
+func (useDecrementer) Exit(js.INode) {}
+
+// varCollector collects the variable declarations and function names in the visited statements that are hoisted to the function scope.
+type varCollector struct {
+	vars     []*js.Var
+	varDecls []*js.VarDecl
+}
+
+func (c *varCollector) Enter(n js.INode) js.IVisitor {
+	switch node := n.(type) {
+	case *js.VarDecl:
+		if node.TokenType == js.VarToken {
+			for _, item := range node.List {
+				c.vars = appendBindingVars(c.vars, item.Binding)
+			}
+			c.varDecls = append(c.varDecls, node)
+		}
+	case *js.FuncDecl:
+		if node.Name != nil && node.Name.Decl == js.FunctionDecl {
+			// function declarations in blocks are hoisted as variables
+			c.vars = append(c.vars, node.Name)
+		}
+		return nil
+	case *js.ArrowFunc, *js.MethodDecl, *js.ClassDecl:
+		return nil
+	}
+	return c
+}
+
+func (c *varCollector) Exit(js.INode) {}
+
+type deadCode struct {
+	m       *jsMinifier
+	scope   *js.Scope // scope of the current block
+	added   []*js.VarDecl
+	removed map[*js.VarDecl]bool
+	changed bool
+}
+
+// removeDeadCode removes unreachable code from the function body, such as statements after return, throw, break, or continue, and branches of if statements that are never taken. If removeUnused is set, unreferenced function declarations and variables whose initializers have no side effects are removed as well. Variables and functions that are hoisted from unreachable code remain declared.
+func (m *jsMinifier) removeDeadCode(body *js.BlockStmt, removeUnused bool) {
+	d := &deadCode{
+		m:       m,
+		scope:   &body.Scope,
+		removed: map[*js.VarDecl]bool{},
+	}
+	js.Walk(commaPruner{d}, body)
+	body.List = d.unreachableStmtList(body.List)
+	if removeUnused && !body.Scope.HasWith && !usesEval(body.Scope) {
+		for d.changed = true; d.changed; {
+			d.changed = false
+			body.List = d.unusedStmtList(body.List)
+		}
+	}
+
+	// update the variable declarations of the function scope for hoisting
+	if 0 < len(d.removed) || 0 < len(d.added) {
+		varDecls := make([]*js.VarDecl, 0, len(body.Scope.VarDecls)+len(d.added))
+		for _, varDecl := range append(body.Scope.VarDecls, d.added...) {
+			if !d.removed[varDecl] {
+				varDecls = append(varDecls, varDecl)
+			}
+		}
+		body.Scope.VarDecls = varDecls
+	}
+}
+
+// usesEval returns true if eval is called from within the scope, in which case variables may be referenced by name.
+func usesEval(scope js.Scope) bool {
+	for _, v := range scope.Undeclared {
+		if bytes.Equal(v.Data, []byte("eval")) {
+			return true
+		}
+	}
+	return false
+}
+
+// fold evaluates constant expressions so that conditions such as those of replaced defines can be decided.
+func (d *deadCode) fold(i js.IExpr) js.IExpr {
+	if i == nil || d.m.o.KeepConstants {
+		return i
+	}
+	return d.m.foldExpr(i, 0)
+}
+
+// mapStmt applies f to the statement as a statement list.
+func (d *deadCode) mapStmt(i js.IStmt, f func([]js.IStmt) []js.IStmt) js.IStmt {
+	if block, ok := i.(*js.BlockStmt); ok {
+		d.mapBlock(block, f)
+		return block
+	}
+	list := f([]js.IStmt{i})
+	if len(list) == 0 {
+		return &js.EmptyStmt{}
+	} else if len(list) == 1 {
+		return list[0]
+	}
+	return &js.BlockStmt{List: list, Scope: js.Scope{}}
+}
+
+// mapBlock applies f to the statement list of the block.
+func (d *deadCode) mapBlock(block *js.BlockStmt, f func([]js.IStmt) []js.IStmt) {
+	parent := d.scope
+	if block.Scope.Func != nil {
+		d.scope = &block.Scope
+	}
+	block.List = f(block.List)
+	d.scope = parent
+}
+
+// mapStmts applies f to all statement lists directly contained in the statement, not descending into functions or classes.
+func (d *deadCode) mapStmts(i js.IStmt, f func([]js.IStmt) []js.IStmt) {
+	switch stmt := i.(type) {
+	case *js.BlockStmt:
+		d.mapBlock(stmt, f)
+	case *js.IfStmt:
+		stmt.Body = d.mapStmt(stmt.Body, f)
+		if stmt.Else != nil {
+			stmt.Else = d.mapStmt(stmt.Else, f)
+		}
+	case *js.DoWhileStmt:
+		stmt.Body = d.mapStmt(stmt.Body, f)
+	case *js.WhileStmt:
+		stmt.Body = d.mapStmt(stmt.Body, f)
+	case *js.ForStmt:
+		d.mapBlock(stmt.Body, f)
+	case *js.ForInStmt:
+		d.mapBlock(stmt.Body, f)
+	case *js.ForOfStmt:
+		d.mapBlock(stmt.Body, f)
+	case *js.SwitchStmt:
+		parent := d.scope
+		d.scope = &stmt.Scope
+		for j := range stmt.List {
+			stmt.List[j].List = f(stmt.List[j].List)
+		}
+		d.scope = parent
+	case *js.TryStmt:
+		d.mapBlock(stmt.Body, f)
+		if stmt.Catch != nil {
+			d.mapBlock(stmt.Catch, f)
+		}
+		if stmt.Finally != nil {
+			d.mapBlock(stmt.Finally, f)
+		}
+	case *js.LabelledStmt:
+		stmt.Value = d.mapStmt(stmt.Value, f)
+	case *js.WithStmt:
+		stmt.Body = d.mapStmt(stmt.Body, f)
+	}
+}
+
+// unreachableStmtList removes statements after return, throw, break, and continue statements and removes branches that are never taken.
+func (d *deadCode) unreachableStmtList(list []js.IStmt) []js.IStmt {
+	stmts := make([]js.IStmt, 0, len(list))
+	for i, istmt := range list {
+		switch stmt := istmt.(type) {
+		case *js.IfStmt:
+			stmt.Cond = d.fold(stmt.Cond)
+			if truthy, ok := isTruthy(stmt.Cond); ok {
+				live, dead := stmt.Body, stmt.Else
+				if !truthy {
+					live, dead = stmt.Else, stmt.Body
+				}
+				if d.m.hasSideEffects(stmt.Cond) {
+					if truthy {
+						stmt.Body, stmt.Else = d.mapStmt(live, d.unreachableStmtList), nil
+					} else if live != nil {
+						stmt.Body, stmt.Else = &js.EmptyStmt{}, d.mapStmt(live, d.unreachableStmtList)
+					} else {
+						stmt.Body = &js.EmptyStmt{}
+					}
+					stmts = append(stmts, stmt)
+				} else if live != nil {
+					stmts = append(stmts, d.mapStmt(live, d.unreachableStmtList))
+				}
+				if dead != nil {
+					stmts = d.appendHoisted(stmts, []js.IStmt{dead}, false)
+				}
+				continue
+			}
+		case *js.ForStmt:
+			stmt.Cond = d.fold(stmt.Cond)
+			// while statements are converted to for statements with an empty variable declaration
+			varDecl, isVarDecl := stmt.Init.(*js.VarDecl)
+			if falsy, ok := isFalsy(stmt.Cond); ok && falsy && (stmt.Init == nil || isVarDecl && len(varDecl.List) == 0) && !d.m.hasSideEffects(stmt.Cond) {
+				if isVarDecl {
+					d.removed[varDecl] = true
+				}
+				stmts = d.appendHoisted(stmts, []js.IStmt{stmt.Body}, false)
+				continue
+			}
+		case *js.ExprStmt:
+			if stmt.Value = d.unusedExpr(stmt.Value); stmt.Value == nil {
+				continue
+			}
+		case *js.DebuggerStmt:
+			if d.m.o.DropDebugger {
+				continue
+			}
+		}
+		d.mapStmts(istmt, d.unreachableStmtList)
+		stmts = append(stmts, istmt)
+		if isFlowStmt(istmt) && i+1 < len(list) {
+			stmts = d.appendHoisted(stmts, list[i+1:], true)
+			break
+		}
+	}
+	return stmts
+}
+
+// unusedExpr removes the pure calls from an expression whose result is unused, keeping their arguments with side effects. It returns nil if nothing remains.
+func (d *deadCode) unusedExpr(i js.IExpr) js.IExpr {
+	var args []js.Arg
+	switch expr := i.(type) {
+	case *js.CommaExpr:
+		list := expr.List[:0]
+		for _, item := range expr.List {
+			if item = d.unusedExpr(item); item != nil {
+				list = append(list, item)
+			}
+		}
+		if len(list) == 0 {
+			return nil
+		} else if len(list) == 1 {
+			return list[0]
+		}
+		expr.List = list
+		return expr
+	case *js.GroupExpr:
+		if expr.X = d.unusedExpr(expr.X); expr.X == nil {
+			return nil
+		}
+		return expr
+	case *js.CallExpr:
+		if !d.m.isPure(expr) {
+			return expr
+		}
+		args = expr.Args.List
+	case *js.NewExpr:
+		if !d.m.isPure(expr) {
+			return expr
+		} else if expr.Args != nil {
+			args = expr.Args.List
+		}
+	default:
+		return i
+	}
+
+	// pure call or new expression, keep the arguments with side effects
+	var list []js.IExpr
+	for _, arg := range args {
+		if arg.Rest {
+			return i // spread arguments may call iterators
+		}
+		if !d.m.hasSideEffects(arg.Value) || isDeclaredVar(arg.Value) {
+			js.Walk(useDecrementer{}, arg.Value)
+		} else if x := d.unusedExpr(arg.Value); x != nil {
+			list = append(list, x)
+		}
+	}
+	if call, ok := i.(*js.CallExpr); ok {
+		js.Walk(useDecrementer{}, call.X)
+	} else {
+		js.Walk(useDecrementer{}, i.(*js.NewExpr).X)
+	}
+	if len(list) == 0 {
+		return nil
+	} else if len(list) == 1 {
+		return list[0]
+	}
+	return &js.CommaExpr{List: list}
+}
+
+// commaPruner removes the pure calls from the elements of comma expressions whose values are unused, as in x=(console.log(1),2), and from the initializer and update expressions of for statements. It does not descend into functions, whose dead code is removed when they are minified.
+type commaPruner struct {
+	d *deadCode
+}
+
+func (p commaPruner) Enter(n js.INode) js.IVisitor {
+	switch node := n.(type) {
+	case *js.FuncDecl, *js.MethodDecl, *js.ArrowFunc:
+		return nil
+	case *js.ForStmt:
+		// the values of the initializer and update expressions are unused as well
+		if _, ok := node.Init.(*js.VarDecl); !ok && node.Init != nil {
+			node.Init = p.d.unusedExpr(node.Init)
+		}
+		if node.Post != nil {
+			node.Post = p.d.unusedExpr(node.Post)
+		}
+	}
+	if exprReplacer(p.d.pruneComma).Enter(n) == nil {
+		return nil
+	}
+	return p
+}
+
+func (commaPruner) Exit(js.INode) {}
+
+// pruneComma removes the pure calls from all but the last element of a comma expression.
+func (d *deadCode) pruneComma(i js.IExpr) js.IExpr {
+	comma, ok := i.(*js.CommaExpr)
+	if !ok {
+		return i
+	}
+	last := comma.List[len(comma.List)-1]
+	list := comma.List[:0]
+	for _, item := range comma.List[:len(comma.List)-1] {
+		if item = d.unusedExpr(item); item != nil {
+			list = append(list, item)
+		}
+	}
+	if len(list) == 0 {
+		switch x := last.(type) {
+		case *js.DotExpr, *js.IndexExpr:
+			// keep (0,a.b)() from being called as a method
+		case *js.Var:
+			if !bytes.Equal(x.Data, []byte("eval")) {
+				return last
+			}
+			// keep (0,eval)() from being a direct eval
+		default:
+			return last
+		}
+		list = append(list, &js.LiteralExpr{TokenType: js.DecimalToken, Data: zeroBytes})
+	}
+	comma.List = append(list, last)
+	return comma
+}
+
+// isPropertyRead returns true if the expression only reads a variable or a chain of properties.
+func isPropertyRead(i js.IExpr) bool {
+	switch expr := i.(type) {
+	case *js.Var:
+		return true
+	case *js.DotExpr:
+		return isPropertyRead(expr.X)
+	case *js.IndexExpr:
+		_, isLiteral := expr.Y.(*js.LiteralExpr)
+		return (isLiteral || isPropertyRead(expr.Y)) && isPropertyRead(expr.X)
+	}
+	return false
+}
+
+// isDeclaredVar returns true if the expression is a variable that is declared, which cannot throw a ReferenceError other than in its temporal dead zone.
+func isDeclaredVar(i js.IExpr) bool {
+	if v, ok := i.(*js.Var); ok {
+		for v.Link != nil {
+			v = v.Link
+		}
+		return v.Decl != js.NoDecl
+	}
+	return false
+}
+
+// appendHoisted appends the declarations of the unreachable statements that must remain, that is the variable declarations without their initializers and, if inList is set, the function declarations and the lexical declarations that are referenced elsewhere.
+func (d *deadCode) appendHoisted(stmts []js.IStmt, dead []js.IStmt, inList bool) []js.IStmt {
+	var lexicals []*js.Var
+	c := &varCollector{}
+	for _, istmt := range dead {
+		if inList {
+			switch stmt := istmt.(type) {
+			case *js.Comment:
+				stmts = append(stmts, stmt)
+				continue
+			case *js.FuncDecl:
+				stmts = append(stmts, stmt)
+				continue
+			case *js.VarDecl:
+				if stmt.TokenType != js.VarToken {
+					for _, item := range stmt.List {
+						if bindingUsed(item.Binding) {
+							lexicals = appendBindingVars(lexicals, item.Binding)
+						}
+					}
+				}
+			case *js.ClassDecl:
+				if stmt.Name != nil && bindingUsed(stmt.Name) {
+					lexicals = append(lexicals, stmt.Name)
+				}
+			}
+		}
+		js.Walk(c, istmt)
+		js.Walk(useDecrementer{}, istmt)
+	}
+	for _, varDecl := range c.varDecls {
+		d.removed[varDecl] = true
+	}
+
+	if decl := d.declare(js.VarToken, c.vars); decl != nil {
+		d.added = append(d.added, decl)
+		stmts = append(stmts, decl)
+	}
+	if decl := d.declare(js.LetToken, lexicals); decl != nil {
+		stmts = append(stmts, decl)
+	}
+	return stmts
+}
+
+// declare returns a declaration without initializers for the given variables, omitting duplicates.
+func (d *deadCode) declare(tt js.TokenType, vars []*js.Var) *js.VarDecl {
+	if len(vars) == 0 {
+		return nil
+	}
+	decl := &js.VarDecl{TokenType: tt, Scope: d.scope}
+VarLoop:
+	for _, v := range vars {
+		for _, item := range decl.List {
+			if item.Binding.(*js.Var) == v {
+				continue VarLoop
+			}
+		}
+		v.Uses++ // the declaration remains
+		decl.List = append(decl.List, js.BindingElement{Binding: v, Default: nil})
+	}
+	return decl
+}
+
+// unusedStmtList removes function declarations and variables that are not referenced. The initializers of unreferenced variables that have side effects are kept as expression statements.
+func (d *deadCode) unusedStmtList(list []js.IStmt) []js.IStmt {
+	stmts := make([]js.IStmt, 0, len(list))
+	for _, istmt := range list {
+		switch stmt := istmt.(type) {
+		case *js.FuncDecl:
+			if stmt.Name != nil && stmt.Name.Uses <= 1 {
+				js.Walk(useDecrementer{}, stmt)
+				d.changed = true
+				continue
+			}
+		case *js.VarDecl:
+			stmts = d.unusedVarDecl(stmts, stmt)
+			continue
+		case *js.ExprStmt:
+			if stmt.Value = d.foldedExpr(stmt.Value); stmt.Value == nil {
+				d.changed = true
+				continue
+			}
+		default:
+			d.mapStmts(istmt, d.unusedStmtList)
+		}
+		stmts = append(stmts, istmt)
+	}
+	return stmts
+}
+
+// foldedExpr removes the elements of an expression whose result is unused that fold to constants without side effects, such as typeof true. It returns nil if nothing remains.
+func (d *deadCode) foldedExpr(i js.IExpr) js.IExpr {
+	if comma, ok := i.(*js.CommaExpr); ok {
+		list := comma.List[:0]
+		for _, item := range comma.List {
+			if item = d.foldedExpr(item); item != nil {
+				list = append(list, item)
+			}
+		}
+		if len(list) == 0 {
+			return nil
+		} else if len(list) == 1 {
+			return list[0]
+		}
+		comma.List = list
+		return comma
+	} else if x := d.fold(i); x != i && !d.m.hasSideEffects(x) {
+		js.Walk(useDecrementer{}, i)
+		return nil
+	}
+	return i
+}
+
+// unusedVarDecl appends the declaration to stmts without the variables that are not referenced. The declaration is split where such a variable has an initializer with side effects, which is kept as an expression statement in between.
+func (d *deadCode) unusedVarDecl(stmts []js.IStmt, stmt *js.VarDecl) []js.IStmt {
+	decl := stmt
+	list := stmt.List
+	stmt.List = stmt.List[:0]
+	for _, item := range list {
+		v, ok := item.Binding.(*js.Var)
+		if !ok || 1 < v.Uses || item.Default != nil && isPropertyRead(item.Default) && d.m.hasSideEffects(item.Default) {
+			// keep reads of variables and properties, which may throw, in the declaration
+			if decl == nil {
+				// declaration after an initializer that is kept
+				decl = &js.VarDecl{TokenType: stmt.TokenType, Scope: stmt.Scope}
+				if decl.TokenType == js.VarToken {
+					d.added = append(d.added, decl)
+				}
+			}
+			decl.List = append(decl.List, item)
+			continue
+		}
+
+		d.changed = true
+		if item.Default == nil || !d.m.hasSideEffects(item.Default) {
+			js.Walk(useDecrementer{}, &item)
+			continue
+		}
+		js.Walk(useDecrementer{}, v)
+		if decl != nil {
+			if 0 < len(decl.List) {
+				stmts = append(stmts, decl)
+			} else if decl == stmt {
+				d.removed[stmt] = true
+			}
+			decl = nil
+		}
+		if x := d.unusedExpr(item.Default); x != nil {
+			stmts = append(stmts, &js.ExprStmt{Value: x})
+		}
+	}
+	if decl != nil {
+		if 0 < len(decl.List) {
+			stmts = append(stmts, decl)
+		} else if decl == stmt {
+			d.removed[stmt] = true
+		}
+	}
+	return stmts
+}
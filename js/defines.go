@@ -0,0 +1,123 @@
+package js
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/tdewolff/parse/v2"
+	"github.com/tdewolff/parse/v2/js"
+)
+
+// defineReplacer replaces unbound global identifiers and member expressions by the defined expressions.
+type defineReplacer struct {
+	defines map[string]string // identifier or member expression => literal expression
+	roots   map[string]bool   // first identifiers of the defines
+}
+
+// newDefineReplacer returns a replacer for the defines, it returns an error if a define is not a literal expression.
+func newDefineReplacer(defines map[string]string) (*defineReplacer, error) {
+	d := &defineReplacer{
+		defines: defines,
+		roots:   map[string]bool{},
+	}
+	for name, value := range defines {
+		if _, err := parseDefine(value); err != nil {
+			return nil, fmt.Errorf("define %s: %w", name, err)
+		}
+		if i := strings.IndexByte(name, '.'); i != -1 {
+			name = name[:i]
+		}
+		d.roots[name] = true
+	}
+	return d, nil
+}
+
+// parseDefine parses the value of a define, which must be a literal expression such as a string, number, boolean, null, undefined, or an array or object of these.
+func parseDefine(value string) (js.IExpr, error) {
+	ast, err := js.Parse(parse.NewInputString("("+value+")"), js.Options{})
+	if err != nil {
+		return nil, err
+	} else if len(ast.List) != 1 {
+		return nil, fmt.Errorf("must be a single expression")
+	}
+	exprStmt, ok := ast.List[0].(*js.ExprStmt)
+	if !ok {
+		return nil, fmt.Errorf("must be a single expression")
+	}
+	group, ok := exprStmt.Value.(*js.GroupExpr)
+	if !ok {
+		return nil, fmt.Errorf("must be a single expression")
+	}
+	var literal literalChecker = true
+	js.Walk(&literal, group.X)
+	if !literal {
+		return nil, fmt.Errorf("must be a literal expression")
+	}
+	if exprPrec(group.X) == js.OpPrimary {
+		return group.X, nil
+	}
+	return group, nil
+}
+
+// literalChecker checks whether the visited expression consists only of literals.
+type literalChecker bool
+
+func (c *literalChecker) Enter(n js.INode) js.IVisitor {
+	switch node := n.(type) {
+	case *js.Var:
+		if !bytes.Equal(node.Data, undefinedBytes) && !bytes.Equal(node.Data, nanBytes) && !bytes.Equal(node.Data, infinityBytes) {
+			*c = false
+		}
+	case *js.UnaryExpr:
+		if node.Op != js.NegToken && node.Op != js.PosToken && node.Op != js.NotToken && node.Op != js.VoidToken {
+			*c = false
+		}
+	case *js.Property:
+		if node.Name == nil || node.Spread {
+			*c = false
+		}
+	case *js.LiteralExpr, *js.ArrayExpr, *js.Element, *js.ObjectExpr, *js.PropertyName, *js.GroupExpr:
+	default:
+		*c = false
+	}
+	if !*c {
+		return nil
+	}
+	return c
+}
+
+func (c *literalChecker) Exit(js.INode) {}
+
+// name returns the name of an unbound global identifier or of a member expression of such an identifier.
+func (d *defineReplacer) name(i js.IExpr) (string, bool) {
+	switch expr := i.(type) {
+	case *js.Var:
+		for expr.Link != nil {
+			expr = expr.Link
+		}
+		if expr.Decl == js.NoDecl && d.roots[string(expr.Data)] {
+			return string(expr.Data), true
+		}
+	case *js.DotExpr:
+		if expr.Optional {
+			return "", false
+		} else if y, ok := expr.Y.(js.LiteralExpr); ok {
+			if x, ok := d.name(expr.X); ok {
+				return x + "." + string(y.Data), true
+			}
+		}
+	}
+	return "", false
+}
+
+// replace returns the defined expression if the expression is defined.
+func (d *defineReplacer) replace(i js.IExpr) js.IExpr {
+	if name, ok := d.name(i); ok {
+		if value, ok := d.defines[name]; ok {
+			// parse again so that every replacement is a distinct node, the value has been validated
+			i, _ = parseDefine(value)
+		}
+	}
+	return i
+}
@@ -0,0 +1,567 @@
+package js
+
+import (
+	"bytes"
+	"math"
+	"strconv"
+
+	"github.com/tdewolff/parse/v2/js"
+)
+
+// maxFoldDepth limits the recursion depth of constant folding.
+const maxFoldDepth = 50
+
+// foldExpr evaluates constant expressions, such as arithmetic on numbers, string concatenation, comparisons, typeof, and lengths of literal strings and arrays. Numbers are only replaced if the result is not longer than the original expression, which prevents expanding for example 1/3.
+func (m *jsMinifier) foldExpr(i js.IExpr, depth int) js.IExpr {
+	if maxFoldDepth < depth {
+		return i
+	}
+	switch expr := i.(type) {
+	case *js.Var:
+		if m.consts != nil {
+			for expr.Link != nil {
+				expr = expr.Link
+			}
+			if val, ok := m.consts[expr]; ok {
+				if _, ok := val.(*js.LiteralExpr); !ok {
+					return &js.GroupExpr{X: val}
+				}
+				return val
+			}
+		}
+	case *js.GroupExpr:
+		expr.X = m.foldExpr(expr.X, depth+1)
+		if lit, ok := expr.X.(*js.LiteralExpr); ok && lit.TokenType != js.RegExpToken {
+			return lit
+		}
+	case *js.UnaryExpr:
+		if expr.Op == js.PreIncrToken || expr.Op == js.PreDecrToken || expr.Op == js.PostIncrToken || expr.Op == js.PostDecrToken || expr.Op == js.DeleteToken {
+			break
+		}
+		expr.X = m.foldExpr(expr.X, depth+1)
+		return m.foldUnaryExpr(expr)
+	case *js.BinaryExpr:
+		if binaryLeftPrecMap[expr.Op] == js.OpLHS {
+			// assignment
+			expr.Y = m.foldExpr(expr.Y, depth+1)
+			break
+		}
+		expr.X = m.foldExpr(expr.X, depth+1)
+		expr.Y = m.foldExpr(expr.Y, depth+1)
+		return m.foldBinaryExpr(expr)
+	case *js.DotExpr:
+		if lit, ok := expr.Y.(js.LiteralExpr); !ok || !bytes.Equal(lit.Data, lengthBytes) || expr.Optional {
+			break
+		}
+		expr.X = m.foldExpr(expr.X, depth+1)
+		switch x := innerExpr(expr.X).(type) {
+		case *js.LiteralExpr:
+			if x.TokenType == js.StringToken && bytes.IndexByte(x.Data, '\\') == -1 {
+				// length in UTF-16 code units
+				n := 0
+				for _, r := range string(x.Data[1 : len(x.Data)-1]) {
+					if 0xFFFF < r {
+						n++
+					}
+					n++
+				}
+				return numberExpr(float64(n))
+			}
+		case *js.ArrayExpr:
+			for _, item := range x.List {
+				if item.Spread || item.Value != nil && m.hasSideEffects(item.Value) {
+					return i
+				}
+			}
+			return numberExpr(float64(len(x.List)))
+		}
+	}
+	return i
+}
+
+func (m *jsMinifier) foldUnaryExpr(expr *js.UnaryExpr) js.IExpr {
+	x := innerExpr(expr.X)
+	switch expr.Op {
+	case js.NotToken:
+		if isPrimitive(x) {
+			if truthy, ok := isTruthy(x); ok {
+				return booleanExpr(!truthy)
+			}
+		}
+	case js.NegToken:
+		if f, ok := numberValue(x); ok && !math.IsNaN(f) && f != 0.0 {
+			return numberExpr(-f)
+		}
+	case js.PosToken:
+		if f, ok := numberValue(x); ok {
+			return numberExpr(f)
+		}
+	case js.BitNotToken:
+		if f, ok := numberValue(x); ok {
+			return m.foldNumber(expr, float64(^toInt32(f)))
+		}
+	case js.TypeofToken:
+		var typ []byte
+		switch y := x.(type) {
+		case *js.LiteralExpr:
+			switch y.TokenType {
+			case js.DecimalToken, js.IntegerToken, js.BinaryToken, js.OctalToken, js.HexadecimalToken:
+				if y.Data[len(y.Data)-1] != 'n' {
+					typ = numberBytes
+				}
+			case js.StringToken:
+				typ = stringBytes
+			case js.TrueToken, js.FalseToken:
+				typ = booleanBytes
+			case js.NullToken, js.RegExpToken:
+				typ = objectBytes
+			}
+		case *js.Var:
+			if isUndefined(y) {
+				typ = undefinedBytes
+			}
+		case *js.FuncDecl, *js.ArrowFunc:
+			typ = functionBytes
+		}
+		if typ != nil {
+			return stringExpr(typ, '"')
+		}
+	}
+	return expr
+}
+
+func (m *jsMinifier) foldBinaryExpr(expr *js.BinaryExpr) js.IExpr {
+	x, y := innerExpr(expr.X), innerExpr(expr.Y)
+	switch expr.Op {
+	case js.AndToken, js.OrToken:
+		if isPrimitive(x) {
+			if truthy, ok := isTruthy(x); ok {
+				if truthy == (expr.Op == js.AndToken) {
+					return expr.Y
+				}
+				return expr.X
+			}
+		}
+		return expr
+	case js.NullishToken:
+		if isUndefinedOrNull(x) && !m.hasSideEffects(x) {
+			return expr.Y
+		} else if isPrimitive(x) {
+			return expr.X
+		}
+		return expr
+	}
+
+	if a, ok := numberValue(x); ok {
+		if b, ok := numberValue(y); ok {
+			var f float64
+			switch expr.Op {
+			case js.AddToken:
+				f = a + b
+			case js.SubToken:
+				f = a - b
+			case js.MulToken:
+				f = a * b
+			case js.DivToken:
+				f = a / b
+			case js.ModToken:
+				f = math.Mod(a, b)
+			case js.ExpToken:
+				if math.IsNaN(b) || (a == 1.0 || a == -1.0) && math.IsInf(b, 0) {
+					return expr // differs from Go
+				}
+				f = math.Pow(a, b)
+			case js.BitAndToken:
+				f = float64(toInt32(a) & toInt32(b))
+			case js.BitOrToken:
+				f = float64(toInt32(a) | toInt32(b))
+			case js.BitXorToken:
+				f = float64(toInt32(a) ^ toInt32(b))
+			case js.LtLtToken:
+				f = float64(toInt32(a) << (uint32(toInt32(b)) & 31))
+			case js.GtGtToken:
+				f = float64(toInt32(a) >> (uint32(toInt32(b)) & 31))
+			case js.GtGtGtToken:
+				f = float64(uint32(toInt32(a)) >> (uint32(toInt32(b)) & 31))
+			case js.LtToken:
+				return booleanExpr(a < b)
+			case js.GtToken:
+				return booleanExpr(a > b)
+			case js.LtEqToken:
+				return booleanExpr(a <= b)
+			case js.GtEqToken:
+				return booleanExpr(a >= b)
+			case js.EqEqToken, js.EqEqEqToken:
+				return booleanExpr(a == b)
+			case js.NotEqToken, js.NotEqEqToken:
+				return booleanExpr(a != b)
+			default:
+				return expr
+			}
+			return m.foldNumber(expr, f)
+		}
+	}
+
+	if a, ok := x.(*js.LiteralExpr); ok && a.TokenType == js.StringToken {
+		if expr.Op == js.AddToken {
+			if s, ok := toString(y); ok {
+				return stringExpr(append(append([]byte{}, a.Data[1:len(a.Data)-1]...), s...), a.Data[0])
+			}
+		} else if b, ok := y.(*js.LiteralExpr); ok && b.TokenType == js.StringToken && bytes.IndexByte(a.Data, '\\') == -1 && bytes.IndexByte(b.Data, '\\') == -1 {
+			equal := bytes.Equal(a.Data[1:len(a.Data)-1], b.Data[1:len(b.Data)-1])
+			switch expr.Op {
+			case js.EqEqToken, js.EqEqEqToken:
+				return booleanExpr(equal)
+			case js.NotEqToken, js.NotEqEqToken:
+				return booleanExpr(!equal)
+			}
+		}
+	} else if b, ok := y.(*js.LiteralExpr); ok && b.TokenType == js.StringToken && expr.Op == js.AddToken {
+		if s, ok := toString(x); ok {
+			return stringExpr(append(s, b.Data[1:len(b.Data)-1]...), b.Data[0])
+		}
+	}
+	return expr
+}
+
+// foldNumber returns the number f if it is not longer than the original expression.
+func (m *jsMinifier) foldNumber(expr js.IExpr, f float64) js.IExpr {
+	if math.IsNaN(f) || math.IsInf(f, 0) || f == 0.0 && math.Signbit(f) {
+		return expr
+	}
+	n := 0
+	if f < 0.0 {
+		n++
+	}
+	n += len(decimalNumber(formatNumber(math.Abs(f)), m.o.Precision))
+	if m.exprLength(expr) < n {
+		return expr
+	}
+	return numberExpr(f)
+}
+
+// exprLength returns the minified length of an expression consisting of numbers and operators, or a large number otherwise.
+func (m *jsMinifier) exprLength(i js.IExpr) int {
+	switch expr := i.(type) {
+	case *js.LiteralExpr:
+		if expr.TokenType == js.DecimalToken || expr.TokenType == js.IntegerToken {
+			return len(decimalNumber(expr.Data, m.o.Precision))
+		} else if expr.TokenType == js.BinaryToken {
+			return len(binaryNumber(expr.Data, m.o.Precision))
+		} else if expr.TokenType == js.OctalToken {
+			return len(octalNumber(expr.Data, m.o.Precision))
+		} else if expr.TokenType == js.HexadecimalToken {
+			return len(hexadecimalNumber(expr.Data, m.o.Precision))
+		}
+	case *js.UnaryExpr:
+		return len(expr.Op.Bytes()) + m.exprLength(expr.X)
+	case *js.BinaryExpr:
+		return m.exprLength(expr.X) + len(expr.Op.Bytes()) + m.exprLength(expr.Y)
+	case *js.GroupExpr:
+		return 2 + m.exprLength(expr.X)
+	}
+	return math.MaxInt32
+}
+
+// isPrimitive returns true for literals that are primitive values.
+func isPrimitive(i js.IExpr) bool {
+	if lit, ok := i.(*js.LiteralExpr); ok {
+		return lit.TokenType != js.RegExpToken
+	} else if unary, ok := i.(*js.UnaryExpr); ok && (unary.Op == js.NotToken || unary.Op == js.NegToken) {
+		return isPrimitive(innerExpr(unary.X))
+	}
+	return false
+}
+
+// numberValue returns the value of a number literal, BigInts and legacy octal numbers are not supported.
+func numberValue(i js.IExpr) (float64, bool) {
+	if unary, ok := i.(*js.UnaryExpr); ok && unary.Op == js.NegToken {
+		if f, ok := numberValue(innerExpr(unary.X)); ok {
+			return -f, true
+		}
+		return 0.0, false
+	}
+	lit, ok := i.(*js.LiteralExpr)
+	if !ok {
+		return 0.0, false
+	}
+	b, suffix := removeUnderscoresAndSuffix(lit.Data)
+	if suffix {
+		return 0.0, false
+	}
+	switch lit.TokenType {
+	case js.DecimalToken, js.IntegerToken:
+		if 1 < len(b) && b[0] == '0' && '0' <= b[1] && b[1] <= '9' {
+			return 0.0, false // legacy octal
+		}
+		f, err := strconv.ParseFloat(string(b), 64)
+		return f, err == nil
+	case js.BinaryToken, js.OctalToken, js.HexadecimalToken:
+		base := 16
+		if lit.TokenType == js.BinaryToken {
+			base = 2
+		} else if lit.TokenType == js.OctalToken {
+			base = 8
+		}
+		n, err := strconv.ParseUint(string(b[2:]), base, 53)
+		return float64(n), err == nil
+	}
+	return 0.0, false
+}
+
+// toInt32 converts a number to a 32-bit integer following ECMAScript's ToInt32.
+func toInt32(f float64) int32 {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return 0
+	}
+	return int32(uint32(int64(math.Mod(math.Trunc(f), 4294967296.0))))
+}
+
+// toString returns the string value of a primitive literal as it would be converted by concatenation, or false if unsupported.
+func toString(i js.IExpr) ([]byte, bool) {
+	if f, ok := numberValue(i); ok {
+		return numberString(f), true
+	} else if lit, ok := i.(*js.LiteralExpr); ok {
+		switch lit.TokenType {
+		case js.TrueToken:
+			return trueBytes, true
+		case js.FalseToken:
+			return falseBytes, true
+		case js.NullToken:
+			return nullBytes, true
+		}
+	}
+	return nil, false
+}
+
+// numberString returns the string representation of a number following ECMAScript's Number::toString.
+func numberString(f float64) []byte {
+	if math.IsNaN(f) {
+		return []byte("NaN")
+	} else if math.IsInf(f, 1) {
+		return []byte("Infinity")
+	} else if math.IsInf(f, -1) {
+		return []byte("-Infinity")
+	} else if f == 0.0 {
+		return []byte("0")
+	}
+	abs := math.Abs(f)
+	if abs < 1e-6 || 1e21 <= abs {
+		b := strconv.AppendFloat(nil, f, 'e', -1, 64)
+		// remove leading zeros in exponent
+		i := bytes.IndexByte(b, 'e') + 2
+		j := i
+		for j < len(b)-1 && b[j] == '0' {
+			j++
+		}
+		return append(b[:i], b[j:]...)
+	}
+	return strconv.AppendFloat(nil, f, 'f', -1, 64)
+}
+
+func numberExpr(f float64) js.IExpr {
+	if f < 0.0 {
+		return &js.UnaryExpr{Op: js.NegToken, X: numberExpr(-f)}
+	}
+	return &js.LiteralExpr{TokenType: js.DecimalToken, Data: formatNumber(f)}
+}
+
+// formatNumber returns the shortest representation of a number that parses to the same value, without a plus sign or leading zeros in the exponent.
+func formatNumber(f float64) []byte {
+	b := strconv.AppendFloat(nil, f, 'g', -1, 64)
+	if i := bytes.IndexByte(b, 'e'); i != -1 {
+		j := i + 1
+		if b[j] == '+' || b[j] == '-' {
+			if b[j] == '-' {
+				i++
+			}
+			j++
+		}
+		for j < len(b)-1 && b[j] == '0' {
+			j++
+		}
+		b = append(b[:i+1], b[j:]...)
+	}
+	return b
+}
+
+func booleanExpr(b bool) js.IExpr {
+	if b {
+		return &js.LiteralExpr{TokenType: js.TrueToken, Data: trueBytes}
+	}
+	return &js.LiteralExpr{TokenType: js.FalseToken, Data: falseBytes}
+}
+
+// stringExpr returns a string literal of s, which may not contain unescaped quotes other than quote.
+func stringExpr(s []byte, quote byte) js.IExpr {
+	if quote != '"' && quote != '\'' {
+		quote = '"'
+	}
+	b := make([]byte, 0, len(s)+2)
+	b = append(b, quote)
+	b = append(b, s...)
+	b = append(b, quote)
+	return &js.LiteralExpr{TokenType: js.StringToken, Data: b}
+}
+
+// constFinder finds const declarations of primitive values that are used once, so that they can be inlined.
+type constFinder struct {
+	m      *jsMinifier
+	seen   map[*js.Var]bool // used before declaration
+	unsafe map[*js.Var]bool // assigned to, deleted, or used within a with statement
+	consts []constDecl
+	inWith bool
+
+	ctxs    []js.INode           // enclosing functions and case clauses
+	declCtx map[*js.Var]js.INode // context of the declaration of each const
+}
+
+type constDecl struct {
+	decl *js.VarDecl
+	v    *js.Var
+}
+
+func (f *constFinder) mark(vs map[*js.Var]bool, v *js.Var) {
+	for v.Link != nil {
+		v = v.Link
+	}
+	vs[v] = true
+}
+
+// ctx returns the innermost function or case clause.
+func (f *constFinder) ctx() js.INode {
+	if len(f.ctxs) == 0 {
+		return nil
+	}
+	return f.ctxs[len(f.ctxs)-1]
+}
+
+// inDeclCtx returns true if the current context is the declaration's context or is nested in it by case clauses only. Functions are hoisted and may be called before the const is initialized, and other case clauses may be reached without passing the declaration.
+func (f *constFinder) inDeclCtx(v *js.Var) bool {
+	ctx, ok := f.declCtx[v]
+	if !ok {
+		return true
+	}
+	for i := len(f.ctxs) - 1; 0 <= i; i-- {
+		if f.ctxs[i] == ctx {
+			return true
+		} else if _, ok := f.ctxs[i].(*js.CaseClause); !ok {
+			return false
+		}
+	}
+	return ctx == nil
+}
+
+func (f *constFinder) Enter(n js.INode) js.IVisitor {
+	switch node := n.(type) {
+	case *js.FuncDecl, *js.CaseClause:
+		f.ctxs = append(f.ctxs, n)
+	case *js.Var:
+		f.mark(f.seen, node)
+		if f.inWith {
+			f.mark(f.unsafe, node)
+		}
+		v := node
+		for v.Link != nil {
+			v = v.Link
+		}
+		if !f.inDeclCtx(v) {
+			f.mark(f.unsafe, v)
+		}
+	case *js.VarDecl:
+		if node.TokenType == js.ConstToken && node.Scope != nil && node.Scope.Parent != nil && !f.inWith {
+			for j := range node.List {
+				item := &node.List[j]
+				if v, ok := item.Binding.(*js.Var); ok && v.Uses == 2 && !f.seen[v] && item.Default != nil {
+					item.Default = f.m.foldExpr(item.Default, 0)
+					if isPrimitive(innerExpr(item.Default)) {
+						f.consts = append(f.consts, constDecl{node, v})
+						f.declCtx[v] = f.ctx()
+						continue
+					}
+				}
+				js.Walk(f, item)
+			}
+			return nil
+		}
+	case *js.BinaryExpr:
+		if binaryLeftPrecMap[node.Op] == js.OpLHS {
+			for _, v := range appendExprVars(nil, node.X) {
+				f.mark(f.unsafe, v)
+			}
+		}
+	case *js.UnaryExpr:
+		if node.Op == js.PreIncrToken || node.Op == js.PreDecrToken || node.Op == js.PostIncrToken || node.Op == js.PostDecrToken || node.Op == js.DeleteToken {
+			for _, v := range appendExprVars(nil, node.X) {
+				f.mark(f.unsafe, v)
+			}
+		}
+	case *js.ForInStmt:
+		for _, v := range appendExprVars(nil, node.Init) {
+			f.mark(f.unsafe, v)
+		}
+	case *js.ForOfStmt:
+		for _, v := range appendExprVars(nil, node.Init) {
+			f.mark(f.unsafe, v)
+		}
+	case *js.WithStmt:
+		if !f.inWith {
+			g := *f
+			g.inWith = true
+			js.Walk(f, node.Cond)
+			js.Walk(&g, node.Body)
+			f.consts = g.consts
+			return nil
+		}
+	}
+	return f
+}
+
+func (f *constFinder) Exit(n js.INode) {
+	switch n.(type) {
+	case *js.FuncDecl, *js.CaseClause:
+		f.ctxs = f.ctxs[:len(f.ctxs)-1]
+	}
+}
+
+// inlineConsts removes const declarations of primitive values that are used once and inlines their value at the place of use. The use must come after the declaration in the source, and in the same function and case clause or in a block within it.
+func (m *jsMinifier) inlineConsts(ast *js.AST) {
+	if usesEval(ast.Scope) {
+		return
+	}
+	f := &constFinder{
+		m:       m,
+		seen:    map[*js.Var]bool{},
+		unsafe:  map[*js.Var]bool{},
+		declCtx: map[*js.Var]js.INode{},
+	}
+	js.Walk(f, ast)
+	for _, c := range f.consts {
+		if f.unsafe[c.v] {
+			continue
+		}
+		for j, item := range c.decl.List {
+			if item.Binding == c.v {
+				if m.consts == nil {
+					m.consts = map[*js.Var]js.IExpr{}
+				}
+				m.consts[c.v] = item.Default
+				c.decl.List = append(c.decl.List[:j], c.decl.List[j+1:]...)
+				c.v.Uses--
+				break
+			}
+		}
+	}
+}
+
+// isInlinedConst returns true if the variable is a const whose value is inlined.
+func (m *jsMinifier) isInlinedConst(v *js.Var) bool {
+	if m.consts == nil {
+		return false
+	}
+	for v.Link != nil {
+		v = v.Link
+	}
+	_, ok := m.consts[v]
+	return ok
+}
@@ -5,6 +5,7 @@ import (
 	"bytes"
 	"fmt"
 	"io"
+	"regexp"
 
 	"github.com/tdewolff/minify/v2"
 	"github.com/tdewolff/parse/v2"
@@ -23,6 +24,23 @@ const (
 type Minifier struct {
 	Precision           int // number of significant digits
 	KeepVarNames        bool
+	KeepFnNames         *regexp.Regexp // keep the names of functions that match, an empty regular expression keeps all
+	KeepClassNames      *regexp.Regexp // keep the names of classes that match, an empty regular expression keeps all
+	Reserved            []string       // names that are not renamed and are not used for renamed variables
+	KeepDeadCode        bool
+	KeepConstants       bool
+	Defines             map[string]string // global identifiers or member expressions to replace by literal expressions
+	DropConsole         bool
+	DropDebugger        bool
+	PureFuncs           []string          // functions or methods (such as Math.floor) whose calls have no side effects
+	MangleProps         *regexp.Regexp    // mangle the names of properties that match
+	ReservedProps       []string          // properties that are not mangled
+	NameCache           *NameCache        // mangled property names shared between minifications
+	Module              bool              // minify as an ES module, renaming top-level declarations that are not exported
+	PureModules         []string          // module specifiers without side effects whose unused imports are removed
+	Lower               bool              // transform syntax newer than Version to older syntax, fails for syntax that cannot be transformed
+	TemplateTags        map[string]string // tag names of template literals (such as html or styled.div) mapped to the mimetype that minifies their contents, see DefaultTemplateTags
+	LegalComments       minify.LegalComments
 	useAlphabetVarNames bool
 	Version             int
 }
@@ -37,28 +55,41 @@ func Minify(m *minify.M, w io.Writer, r io.Reader, params map[string]string) err
 }
 
 // Minify minifies JS data, it reads from r and writes to w.
-func (o *Minifier) Minify(_ *minify.M, w io.Writer, r io.Reader, params map[string]string) error {
+func (o *Minifier) Minify(mm *minify.M, w io.Writer, r io.Reader, params map[string]string) error {
 	z := parse.NewInput(r)
 	defer z.Restore()
-	ast, err := js.Parse(z, js.Options{
+	options := js.Options{
 		WhileToFor: true,
 		Inline:     params != nil && params["inline"] == "1",
-	})
-	if err != nil {
-		return err
 	}
 
 	m := &jsMinifier{
 		o:       o,
 		w:       w,
 		renamer: newRenamer(!o.KeepVarNames, !o.useAlphabetVarNames),
+		pure:    map[js.IExpr]bool{},
+	}
+
+	ast, err := m.parse(z, options)
+	if err != nil {
+		return err
+	} else if err := m.optimize(ast, false); err != nil {
+		return err
+	}
+	if mm != nil && 0 < len(o.TemplateTags) {
+		js.Walk(templateMinifier{mm, o.TemplateTags}, ast)
+	}
+	m.optimizeImports(ast)
+	if o.Module {
+		m.renameModule(ast)
 	}
-	m.hoistVars(&ast.BlockStmt)
-	ast.List = optimizeStmtList(ast.List, functionBlock)
 	for _, item := range ast.List {
 		m.writeSemicolon()
 		m.minifyStmt(item)
 	}
+	if err := minify.WriteLegalComments(w, o.LegalComments, m.legalComments); err != nil {
+		return err
+	}
 
 	if _, err := w.Write(nil); err != nil {
 		return err
@@ -66,6 +97,72 @@ func (o *Minifier) Minify(_ *minify.M, w io.Writer, r io.Reader, params map[stri
 	return nil
 }
 
+// parse parses the input and records the calls and new expressions that are annotated as pure, and the comments that contain @license or @preserve.
+func (m *jsMinifier) parse(z *parse.Input, options js.Options) (*js.AST, error) {
+	src := z.Bytes()
+	var buf []byte
+	if m.o.LegalComments != minify.LegalCommentsNone {
+		buf = m.markLegalComments(src)
+	}
+	if buf == nil && bytes.Contains(src, pureBytes) {
+		// copy the input so that the offsets of the parsed identifiers and literals are known
+		buf = make([]byte, len(src), len(src)+1)
+		copy(buf, src)
+	}
+	if buf == nil {
+		return js.Parse(z, options)
+	}
+
+	ast, err := js.Parse(parse.NewInputBytes(buf), options)
+	if err != nil {
+		// the marked comments have the same length, reparse for the original error context
+		_, err = js.Parse(z, options)
+		return nil, err
+	}
+	markPureAnnotations(buf, ast, m.pure)
+	return ast, nil
+}
+
+// optimize transforms the AST before it is written out. If removeUnused is set, unused top-level declarations are removed as well.
+func (m *jsMinifier) optimize(ast *js.AST, removeUnused bool) error {
+	o := m.o
+	if 0 < len(o.Defines) {
+		d, err := newDefineReplacer(o.Defines)
+		if err != nil {
+			return err
+		}
+		js.Walk(exprReplacer(d.replace), ast)
+	}
+	if o.DropConsole || 0 < len(o.PureFuncs) {
+		js.Walk(pureCallMarker{m}, ast)
+	}
+	if o.MangleProps != nil {
+		m.mangleProps(ast)
+	}
+	if 0 < len(o.Reserved) {
+		m.renamer.reserve(o.Reserved)
+	}
+	if o.KeepFnNames != nil || o.KeepClassNames != nil {
+		m.renamer.keep = map[*js.Var]bool{}
+		m.renamer.keepNames = map[string]struct{}{}
+		js.Walk(nameKeeper{o, m.renamer}, ast)
+	}
+	if !o.KeepConstants {
+		m.inlineConsts(ast)
+	}
+	if !o.KeepDeadCode {
+		m.removeDeadCode(&ast.BlockStmt, removeUnused)
+	}
+	if o.Lower && o.Version != 0 {
+		if err := m.lower(ast); err != nil {
+			return err
+		}
+	}
+	m.hoistVars(&ast.BlockStmt)
+	ast.List = optimizeStmtList(ast.List, functionBlock)
+	return nil
+}
+
 type expectExpr int
 
 const (
@@ -86,7 +183,11 @@ type jsMinifier struct {
 	inFor          bool
 	spaceBefore    byte
 
-	renamer *renamer
+	renamer       *renamer
+	consts        map[*js.Var]js.IExpr // inlined const variables
+	pure          map[js.IExpr]bool    // calls and new expressions without side effects
+	legal         map[string][]byte    // original @license and @preserve comments by their marked version
+	legalComments [][]byte             // legal comments that are written at the end
 }
 
 func (m *jsMinifier) write(b []byte) {
@@ -405,9 +506,19 @@ func (m *jsMinifier) minifyStmt(i js.IStmt) {
 		m.write(stmt.Value)
 		m.requireSemicolon()
 	case *js.Comment:
-		// bang comment
-		m.write(stmt.Value)
-		if stmt.Value[1] == '/' {
+		// shebang or legal comment
+		comment := stmt.Value
+		if orig, ok := m.legal[string(comment)]; ok {
+			comment = orig
+		}
+		if comment[0] == '/' && m.o.LegalComments != minify.LegalCommentsInline {
+			if m.o.LegalComments != minify.LegalCommentsNone {
+				m.legalComments = append(m.legalComments, comment)
+			}
+			break
+		}
+		m.write(comment)
+		if comment[1] == '/' {
 			m.write(newlineBytes)
 		}
 	}
@@ -571,6 +682,9 @@ func (m *jsMinifier) minifyFuncDecl(decl *js.FuncDecl, inExpr bool) {
 
 	parentRename := m.renamer.rename
 	m.renamer.rename = !decl.Body.Scope.HasWith && !m.o.KeepVarNames
+	if !m.o.KeepDeadCode {
+		m.removeDeadCode(&decl.Body, true)
+	}
 	m.hoistVars(&decl.Body)
 	decl.Body.List = optimizeStmtList(decl.Body.List, functionBlock)
 
@@ -595,7 +709,7 @@ func (m *jsMinifier) minifyFuncDecl(decl *js.FuncDecl, inExpr bool) {
 	if inExpr {
 		m.renamer.renameScope(decl.Body.Scope)
 	}
-	if decl.Name != nil && (!inExpr || 1 < decl.Name.Uses) {
+	if decl.Name != nil && (!inExpr || 1 < decl.Name.Uses || m.renamer.keep[decl.Name]) {
 		if !decl.Generator {
 			m.write(spaceBytes)
 		}
@@ -621,6 +735,9 @@ func (m *jsMinifier) minifyClassElementName(name js.ClassElementName) {
 func (m *jsMinifier) minifyMethodDecl(decl *js.MethodDecl) {
 	parentRename := m.renamer.rename
 	m.renamer.rename = !decl.Body.Scope.HasWith && !m.o.KeepVarNames
+	if !m.o.KeepDeadCode {
+		m.removeDeadCode(&decl.Body, true)
+	}
 	m.hoistVars(&decl.Body)
 	decl.Body.List = optimizeStmtList(decl.Body.List, functionBlock)
 
@@ -654,6 +771,9 @@ func (m *jsMinifier) minifyMethodDecl(decl *js.MethodDecl) {
 func (m *jsMinifier) minifyArrowFunc(decl *js.ArrowFunc) {
 	parentRename := m.renamer.rename
 	m.renamer.rename = !decl.Body.Scope.HasWith && !m.o.KeepVarNames
+	if !m.o.KeepDeadCode {
+		m.removeDeadCode(&decl.Body, true)
+	}
 	m.hoistVars(&decl.Body)
 	decl.Body.List = optimizeStmtList(decl.Body.List, functionBlock)
 
@@ -780,7 +900,7 @@ func (m *jsMinifier) minifyProperty(property js.Property) {
 	// property.Name is always set in ObjectLiteral
 	if property.Spread {
 		m.write(ellipsisBytes)
-	} else if v, ok := property.Value.(*js.Var); property.Name != nil && (!ok || !property.Name.IsIdent(v.Name())) {
+	} else if v, ok := property.Value.(*js.Var); property.Name != nil && (!ok || !property.Name.IsIdent(v.Name()) || m.isInlinedConst(v) || !m.o.minVersion(2015)) {
 		// add 'old-name:' before BindingName as the latter will be renamed
 		m.minifyPropertyName(*property.Name)
 		m.write(colonBytes)
@@ -854,6 +974,10 @@ func (m *jsMinifier) minifyBinding(ibinding js.IBinding) {
 }
 
 func (m *jsMinifier) minifyExpr(i js.IExpr, prec js.OpPrec) {
+	if prec != js.OpLHS && !m.o.KeepConstants {
+		// don't fold assignment targets
+		i = m.foldExpr(i, 0)
+	}
 	if cond, ok := i.(*js.CondExpr); ok {
 		i = m.optimizeCondExpr(cond, prec)
 	} else if unary, ok := i.(*js.UnaryExpr); ok {
@@ -983,19 +1107,19 @@ func (m *jsMinifier) minifyExpr(i js.IExpr, prec js.OpPrec) {
 				}
 			} else if expr.Op == js.AndToken {
 				// TODO: use truthy instead of true?
-				if (isTrue(expr.X) || isFalse(expr.Y)) && !hasSideEffects(expr.X) {
+				if (isTrue(expr.X) || isFalse(expr.Y)) && !m.hasSideEffects(expr.X) {
 					m.minifyExpr(expr.Y, prec)
 					break
-				} else if (isTrue(expr.Y) || isFalse(expr.X)) && !hasSideEffects(expr.Y) {
+				} else if (isTrue(expr.Y) || isFalse(expr.X)) && !m.hasSideEffects(expr.Y) {
 					m.minifyExpr(expr.X, prec)
 					break
 				}
 			} else if expr.Op == js.OrToken {
 				// TODO: use truthy instead of true?
-				if (isTrue(expr.X) || isFalse(expr.Y)) && !hasSideEffects(expr.Y) {
+				if (isTrue(expr.X) || isFalse(expr.Y)) && !m.hasSideEffects(expr.Y) {
 					m.minifyExpr(expr.X, prec)
 					break
-				} else if (isTrue(expr.Y) || isFalse(expr.X)) && !hasSideEffects(expr.X) {
+				} else if (isTrue(expr.Y) || isFalse(expr.X)) && !m.hasSideEffects(expr.X) {
 					m.minifyExpr(expr.Y, prec)
 					break
 				}
@@ -1058,7 +1182,7 @@ func (m *jsMinifier) minifyExpr(i js.IExpr, prec js.OpPrec) {
 		if expr.Op == js.PostIncrToken || expr.Op == js.PostDecrToken {
 			m.minifyExpr(expr.X, unaryPrecMap[expr.Op])
 			m.write(expr.Op.Bytes())
-		} else if expr.Op == js.VoidToken && !hasSideEffects(expr.X) {
+		} else if expr.Op == js.VoidToken && !m.hasSideEffects(expr.X) {
 			m.write(zeroIndexBytes)
 		} else {
 			isLtNot := expr.Op == js.NotToken && 0 < len(m.prev) && m.prev[len(m.prev)-1] == '<'
@@ -1303,7 +1427,7 @@ func (m *jsMinifier) minifyExpr(i js.IExpr, prec js.OpPrec) {
 		} else if dot, ok := expr.X.(*js.DotExpr); ok {
 			if x, ok := dot.X.(*js.Var); ok && x.Decl == js.NoDecl && bytes.Equal(x.Data, MathBytes) {
 				if y, ok := dot.Y.(js.LiteralExpr); ok {
-					if bytes.Equal(y.Data, []byte("pow")) {
+					if bytes.Equal(y.Data, powBytes) && m.o.minVersion(2016) {
 						// Math.pow(a,b) => a**b
 						if len(expr.Args.List) == 2 {
 							if js.OpExp < prec {
@@ -0,0 +1,49 @@
+package js
+
+import (
+	"bytes"
+
+	"github.com/tdewolff/minify/v2"
+	"github.com/tdewolff/parse/v2/js"
+)
+
+var (
+	licenseBytes  = []byte("@license")
+	preserveBytes = []byte("@preserve")
+)
+
+// markLegalComments returns a copy of the input where comments that contain @license or @preserve start with a bang, so that the parser keeps them like /*! comments. The bang replaces the first character of the comment that is not a line terminator, so that error positions are not affected. The original comments are recorded so that they are written out unchanged.
+func (m *jsMinifier) markLegalComments(src []byte) []byte {
+	if !bytes.Contains(src, licenseBytes) && !bytes.Contains(src, preserveBytes) {
+		return nil
+	}
+
+	var ends []int
+	var comments [][]byte
+	walkComments(src, func(_ js.TokenType, comment []byte, end int) {
+		if comment[0] == '/' && comment[2] != '!' && minify.IsLegalComment(comment) {
+			ends = append(ends, end)
+			comments = append(comments, comment)
+		}
+	})
+	if len(comments) == 0 {
+		return nil
+	} else if m.legal == nil {
+		m.legal = map[string][]byte{}
+	}
+
+	buf := make([]byte, len(src), len(src)+1)
+	copy(buf, src)
+	for i, comment := range comments {
+		start := ends[i] - len(comment)
+		j := 2
+		for comment[j] == '\n' || comment[j] == '\r' || 0x80 <= comment[j] {
+			j++ // @license or @preserve is further on
+		}
+		// /*\n @license */  =>  /*!\n license */
+		copy(buf[start+3:], comment[2:j])
+		buf[start+2] = '!'
+		m.legal[string(buf[start:ends[i]])] = comment
+	}
+	return buf
+}
@@ -0,0 +1,1038 @@
+package js
+
+import (
+	"bytes"
+	"fmt"
+	"slices"
+	"strconv"
+
+	"github.com/tdewolff/parse/v2/js"
+)
+
+var (
+	argumentsBytes = []byte("arguments")
+	assignBytes    = []byte("assign")
+	bindBytes      = []byte("bind")
+	callBytes      = []byte("call")
+	concatBytes    = []byte("concat")
+	powBytes       = []byte("pow")
+	thisBytes      = []byte("this")
+)
+
+// lowerFunc is a function scope in which temporary variables are declared.
+type lowerFunc struct {
+	body  *js.BlockStmt
+	loops int // number of loops around the current position
+	temps []*js.Var
+}
+
+// lowerer transforms syntax that is newer than the ECMAScript version to equivalent older syntax, and fails for syntax that cannot be transformed.
+type lowerer struct {
+	version  int
+	module   bool
+	names    map[string]bool       // names of all variables, to generate new names that are unique
+	captured map[*js.Var]bool      // variables used by nested functions
+	assigned map[*js.Var]bool      // variables that are assigned to after their declaration
+	lexical  map[*js.Var]*js.Scope // let and const variables and their function scope
+	declared map[*js.Var]bool      // let and const variables whose declaration has been walked
+	globals  map[string]*js.Var
+	funcs    []*lowerFunc
+	scopes   []*js.Scope // scopes around the current position
+	wrapped  []*js.Var   // temporary variables at the top level of a script, which are declared in a function around the expression to not create global variables
+	err      error
+}
+
+// lower transforms syntax that is newer than the configured ECMAScript version.
+func (m *jsMinifier) lower(ast *js.AST) error {
+	l := &lowerer{
+		version:  m.o.Version,
+		module:   m.o.Module,
+		names:    map[string]bool{},
+		captured: map[*js.Var]bool{},
+		assigned: map[*js.Var]bool{},
+		lexical:  map[*js.Var]*js.Scope{},
+		declared: map[*js.Var]bool{},
+		globals:  map[string]*js.Var{},
+	}
+	js.Walk(lowerCollector{l}, ast)
+
+	f := &lowerFunc{body: &ast.BlockStmt}
+	l.funcs = append(l.funcs, f)
+	js.Walk(l, &ast.BlockStmt)
+	l.declareTemps(f)
+	return l.err
+}
+
+// lowerCollector collects the variable names, the variables that are used by nested functions, the let and const variables, and the variables that are assigned to.
+type lowerCollector struct {
+	l *lowerer
+}
+
+func (c lowerCollector) Enter(n js.INode) js.IVisitor {
+	var scope *js.Scope
+	var assigned []*js.Var
+	switch node := n.(type) {
+	case *js.Var:
+		c.l.names[string(node.Data)] = true
+	case *js.VarDecl:
+		if node.TokenType == js.LetToken || node.TokenType == js.ConstToken {
+			for _, item := range node.List {
+				for _, v := range appendBindingVars(nil, item.Binding) {
+					c.l.lexical[v] = node.Scope.Func
+				}
+			}
+		}
+	case *js.BinaryExpr:
+		if binaryLeftPrecMap[node.Op] == js.OpLHS {
+			assigned = appendPatternVars(assigned, node.X)
+		}
+	case *js.UnaryExpr:
+		if node.Op == js.PreIncrToken || node.Op == js.PreDecrToken || node.Op == js.PostIncrToken || node.Op == js.PostDecrToken {
+			assigned = appendPatternVars(assigned, node.X)
+		}
+	case *js.ForInStmt:
+		assigned = appendPatternVars(assigned, node.Init)
+	case *js.ForOfStmt:
+		assigned = appendPatternVars(assigned, node.Init)
+	case *js.FuncDecl:
+		scope = &node.Body.Scope
+	case *js.ArrowFunc:
+		scope = &node.Body.Scope
+	case *js.MethodDecl:
+		scope = &node.Body.Scope
+	}
+	if scope != nil {
+		for _, v := range scope.Undeclared {
+			for v.Link != nil {
+				v = v.Link
+			}
+			c.l.captured[v] = true
+		}
+	}
+	for _, v := range assigned {
+		for v.Link != nil {
+			v = v.Link
+		}
+		c.l.assigned[v] = true
+	}
+	return c
+}
+
+func (lowerCollector) Exit(js.INode) {}
+
+// appendPatternVars appends the variables that are assigned to by an assignment target, which may be a destructuring pattern.
+func appendPatternVars(vs []*js.Var, i js.IExpr) []*js.Var {
+	switch expr := i.(type) {
+	case *js.Var:
+		vs = append(vs, expr)
+	case *js.GroupExpr:
+		vs = appendPatternVars(vs, expr.X)
+	case *js.ArrayExpr:
+		for _, item := range expr.List {
+			vs = appendPatternVars(vs, item.Value)
+		}
+	case *js.ObjectExpr:
+		for _, item := range expr.List {
+			vs = appendPatternVars(vs, item.Value)
+		}
+	case *js.BinaryExpr:
+		if expr.Op == js.EqToken {
+			vs = appendPatternVars(vs, expr.X)
+		}
+	}
+	return vs
+}
+
+// varFinder finds all variables in an expression.
+type varFinder struct {
+	vars []*js.Var
+}
+
+func (f *varFinder) Enter(n js.INode) js.IVisitor {
+	if v, ok := n.(*js.Var); ok {
+		f.vars = append(f.vars, v)
+	}
+	return f
+}
+
+func (f *varFinder) Exit(js.INode) {}
+
+// lexicalFinder finds the uses of this, arguments, and super that refer to the enclosing function.
+type lexicalFinder struct {
+	this, arguments, super bool
+}
+
+func (f *lexicalFinder) Enter(n js.INode) js.IVisitor {
+	switch node := n.(type) {
+	case *js.LiteralExpr:
+		if node.TokenType == js.ThisToken {
+			f.this = true
+		} else if node.TokenType == js.SuperToken {
+			f.super = true
+		}
+	case *js.Var:
+		if node.Decl == js.NoDecl && bytes.Equal(node.Data, argumentsBytes) {
+			f.arguments = true
+		}
+	case *js.FuncDecl, *js.MethodDecl, *js.ClassDecl:
+		return nil
+	}
+	return f
+}
+
+func (f *lexicalFinder) Exit(js.INode) {}
+
+func (l *lowerer) fail(construct string) {
+	if l.err == nil {
+		l.err = fmt.Errorf("cannot lower %s to ECMAScript %d", construct, l.version)
+	}
+}
+
+func (l *lowerer) replace(i *js.IExpr) {
+	if *i == nil {
+		return
+	}
+	n := len(l.wrapped)
+	for {
+		expr := l.lowerExpr(*i)
+		if expr == *i {
+			break
+		}
+		*i = expr
+	}
+	if n < len(l.wrapped) {
+		*i = l.wrapTemps(*i, l.wrapped[n:])
+		l.wrapped = l.wrapped[:n]
+	}
+}
+
+// wrapTemps declares the temporary variables as parameters of a function that returns the expression, for expressions at the top level of a script:  (_=f())==null?void 0:_.b  =>  function(_){return(_=f())==null?void 0:_.b}()
+func (l *lowerer) wrapTemps(expr js.IExpr, temps []*js.Var) js.IExpr {
+	finder := &lexicalFinder{}
+	js.Walk(finder, expr)
+	if finder.arguments {
+		l.fail("arguments at the top level")
+		return expr
+	} else if finder.super {
+		l.fail("super at the top level")
+		return expr
+	}
+
+	fn := &js.FuncDecl{}
+	fn.Body.Scope.Parent = l.scopes[len(l.scopes)-1]
+	fn.Body.Scope.Func = &fn.Body.Scope
+	for _, v := range temps {
+		v.Decl = js.ArgumentDecl
+		fn.Params.List = append(fn.Params.List, js.BindingElement{Binding: v})
+	}
+	fn.Body.Scope.Declared = append(fn.Body.Scope.Declared, temps...)
+	fn.Body.Scope.NumFuncArgs = uint16(len(temps))
+	vars := &varFinder{}
+	js.Walk(vars, expr)
+	for _, v := range vars.vars {
+		if !slices.Contains(temps, v) {
+			fn.Body.Scope.AddUndeclared(v)
+		}
+	}
+	fn.Body.List = []js.IStmt{&js.ReturnStmt{Value: expr}}
+
+	if finder.this {
+		// keep this:  function(_){return this.a}.call(this)
+		return &js.CallExpr{
+			X:    &js.DotExpr{X: fn, Y: js.LiteralExpr{TokenType: js.IdentifierToken, Data: callBytes}, Prec: js.OpMember},
+			Args: js.Args{List: []js.Arg{{Value: &js.LiteralExpr{TokenType: js.ThisToken, Data: thisBytes}}}},
+			Prec: js.OpCall,
+		}
+	}
+	return &js.CallExpr{X: fn, Prec: js.OpCall}
+}
+
+func (l *lowerer) Enter(n js.INode) js.IVisitor {
+	if l.err != nil {
+		return nil
+	}
+	f := l.funcs[len(l.funcs)-1]
+	switch node := n.(type) {
+	case *js.BlockStmt:
+		l.scopes = append(l.scopes, &node.Scope)
+	case *js.ExprStmt:
+		l.replace(&node.Value)
+	case *js.VarDecl:
+		if l.version < 2015 && (node.TokenType == js.LetToken || node.TokenType == js.ConstToken) {
+			l.lowerLexicalDecl(node)
+		}
+	case *js.IfStmt:
+		l.replace(&node.Cond)
+	case *js.DoWhileStmt:
+		f.loops++
+		l.replace(&node.Cond)
+	case *js.WhileStmt:
+		f.loops++
+		l.replace(&node.Cond)
+	case *js.ForStmt:
+		f.loops++
+		l.scopes = append(l.scopes, &node.Body.Scope)
+		l.declareInit(node.Init) // the body is walked before the initialization
+		l.replace(&node.Init)
+		l.replace(&node.Cond)
+		l.replace(&node.Post)
+	case *js.ForInStmt:
+		f.loops++
+		l.scopes = append(l.scopes, &node.Body.Scope)
+		l.declareInit(node.Init)
+		l.replace(&node.Value)
+		if _, ok := node.Init.(*js.VarDecl); !ok {
+			l.checkPattern(node.Init)
+		}
+	case *js.ForOfStmt:
+		if l.version < 2015 {
+			l.fail("for-of loops")
+		} else if node.Await && l.version < 2018 {
+			l.fail("for await loops")
+		}
+		f.loops++
+		l.scopes = append(l.scopes, &node.Body.Scope)
+		l.declareInit(node.Init)
+		l.replace(&node.Value)
+		if _, ok := node.Init.(*js.VarDecl); !ok {
+			l.checkPattern(node.Init)
+		}
+	case *js.CaseClause:
+		l.replace(&node.Cond)
+	case *js.SwitchStmt:
+		l.scopes = append(l.scopes, &node.Scope)
+		l.replace(&node.Init)
+
+		// a case is entered without evaluating the declarations in the preceding cases, so their let and const variables are undeclared at the start of every case
+		var vars []*js.Var
+		for _, clause := range node.List {
+			for _, stmt := range clause.List {
+				if decl, ok := stmt.(*js.VarDecl); ok && decl.TokenType != js.VarToken {
+					for _, item := range decl.List {
+						vars = appendBindingVars(vars, item.Binding)
+					}
+				}
+			}
+		}
+		for i := range node.List {
+			for _, v := range vars {
+				delete(l.declared, v)
+			}
+			js.Walk(l, &node.List[i])
+		}
+		js.Walk(l, node.Init)
+		l.scopes = l.scopes[:len(l.scopes)-1]
+		return nil
+	case *js.ReturnStmt:
+		l.replace(&node.Value)
+	case *js.WithStmt:
+		l.replace(&node.Cond)
+	case *js.ThrowStmt:
+		l.replace(&node.Value)
+	case *js.TryStmt:
+		if node.Catch != nil && node.Binding == nil && l.version < 2019 {
+			// optional catch binding
+			v := &js.Var{Data: []byte(l.newName("e")), Uses: 1, Decl: js.CatchDecl}
+			node.Binding = v
+			node.Catch.Scope.Declared = append(node.Catch.Scope.Declared, v)
+		}
+	case *js.ExportStmt:
+		l.replace(&node.Decl)
+	case *js.PropertyName:
+		if node.Computed != nil && l.version < 2015 {
+			l.fail("computed property names")
+		}
+		l.replace(&node.Computed)
+	case *js.BindingArray:
+		if l.version < 2015 {
+			l.fail("destructuring")
+		}
+	case *js.BindingObject:
+		if l.version < 2015 {
+			l.fail("destructuring")
+		} else if node.Rest != nil && l.version < 2018 {
+			l.fail("object rest properties")
+		}
+	case *js.BindingElement:
+		l.replace(&node.Default)
+		if v, ok := node.Binding.(*js.Var); ok && l.lexical[v] != nil {
+			// the variable is in its temporal dead zone until after the initializer
+			js.Walk(l, node.Default)
+			l.declared[v] = true
+			return nil
+		}
+	case *js.Var:
+		v := node
+		for v.Link != nil {
+			v = v.Link
+		}
+		if l.lexical[v] == f.body.Scope.Func && !l.declared[v] && l.version < 2015 {
+			// a use before the declaration in the same function throws a ReferenceError, which is lost when converted to var
+			l.fail("let and const variables that are used before their declaration")
+		}
+	case *js.Params:
+		if l.version < 2015 {
+			if node.Rest != nil {
+				l.fail("rest parameters")
+			}
+			for _, item := range node.List {
+				if item.Default != nil {
+					l.fail("default parameters")
+				}
+			}
+		}
+	case *js.FuncDecl:
+		if node.Async && node.Generator && l.version < 2018 {
+			l.fail("async generators")
+		} else if node.Async && l.version < 2017 {
+			l.fail("async functions")
+		} else if node.Generator && l.version < 2015 {
+			l.fail("generators")
+		}
+		l.walkFunc(&node.Params, &node.Body)
+		return nil
+	case *js.MethodDecl:
+		if node.Async && node.Generator && l.version < 2018 {
+			l.fail("async generators")
+		} else if node.Async && l.version < 2017 {
+			l.fail("async functions")
+		} else if node.Generator && l.version < 2015 {
+			l.fail("generators")
+		}
+		js.Walk(l, &node.Name)
+		l.walkFunc(&node.Params, &node.Body)
+		return nil
+	case *js.ArrowFunc:
+		if node.Async && l.version < 2017 {
+			l.fail("async functions")
+		}
+		l.walkFunc(&node.Params, &node.Body)
+		return nil
+	case *js.ClassDecl:
+		if l.version < 2015 {
+			l.fail("classes")
+		} else if l.version < 2022 {
+			for _, item := range node.List {
+				if item.StaticBlock != nil {
+					l.fail("class static blocks")
+				} else if item.Method == nil {
+					l.fail("class fields")
+				} else if item.Method.Name.Private != nil {
+					l.fail("private class members")
+				}
+			}
+		}
+		l.replace(&node.Extends)
+	case *js.Field:
+		l.replace(&node.Init)
+	case *js.Element:
+		if node.Spread && l.version < 2015 {
+			l.fail("spread elements")
+		}
+		l.replace(&node.Value)
+	case *js.Property:
+		if method, ok := node.Value.(*js.MethodDecl); ok && !method.Get && !method.Set && l.version < 2015 {
+			// shorthand method:  {f(){}}  =>  {f:function(){}}
+			finder := &lexicalFinder{}
+			js.Walk(finder, &method.Body)
+			if finder.super {
+				l.fail("methods that use super")
+			}
+			name := method.Name.PropertyName
+			node.Name = &name
+			node.Value = &js.FuncDecl{Async: method.Async, Generator: method.Generator, Params: method.Params, Body: method.Body}
+		}
+		l.replace(&node.Value)
+		l.replace(&node.Init)
+	case *js.TemplatePart:
+		l.replace(&node.Expr)
+	case *js.GroupExpr:
+		l.replace(&node.X)
+	case *js.IndexExpr:
+		l.replace(&node.X)
+		l.replace(&node.Y)
+	case *js.DotExpr:
+		l.replace(&node.X)
+	case *js.NewTargetExpr:
+		if l.version < 2015 {
+			l.fail("new.target")
+		}
+	case *js.Arg:
+		if node.Rest && l.version < 2015 {
+			l.fail("spread arguments")
+		}
+		l.replace(&node.Value)
+	case *js.NewExpr:
+		l.replace(&node.X)
+	case *js.CallExpr:
+		l.replace(&node.X)
+	case *js.UnaryExpr:
+		if node.Op == js.AwaitToken && len(l.funcs) == 1 && l.version < 2022 {
+			l.fail("top-level await")
+		}
+		l.replace(&node.X)
+	case *js.BinaryExpr:
+		l.replace(&node.Y)
+		if _, ok := node.X.(*js.ArrayExpr); ok && binaryLeftPrecMap[node.Op] == js.OpLHS {
+			// destructuring assignment
+			l.checkPattern(node.X)
+			js.Walk(l, node.Y)
+			return nil
+		} else if _, ok := node.X.(*js.ObjectExpr); ok && binaryLeftPrecMap[node.Op] == js.OpLHS {
+			l.checkPattern(node.X)
+			js.Walk(l, node.Y)
+			return nil
+		}
+		l.replace(&node.X)
+	case *js.CondExpr:
+		l.replace(&node.Cond)
+		l.replace(&node.X)
+		l.replace(&node.Y)
+	case *js.YieldExpr:
+		l.replace(&node.X)
+	case *js.CommaExpr:
+		for i := range node.List {
+			l.replace(&node.List[i])
+		}
+	case *js.LiteralExpr:
+		l.checkLiteral(node)
+	}
+	return l
+}
+
+func (l *lowerer) Exit(n js.INode) {
+	f := l.funcs[len(l.funcs)-1]
+	switch n.(type) {
+	case *js.BlockStmt:
+		l.scopes = l.scopes[:len(l.scopes)-1]
+	case *js.ForStmt, *js.ForInStmt, *js.ForOfStmt:
+		l.scopes = l.scopes[:len(l.scopes)-1]
+		f.loops--
+	case *js.DoWhileStmt, *js.WhileStmt:
+		f.loops--
+	}
+}
+
+// declareInit marks the let and const variables in the initialization of a for statement as declared.
+func (l *lowerer) declareInit(init js.IExpr) {
+	if decl, ok := init.(*js.VarDecl); ok {
+		for _, item := range decl.List {
+			for _, v := range appendBindingVars(nil, item.Binding) {
+				l.declared[v] = true
+			}
+		}
+	}
+}
+
+// walkFunc walks the parameters in the enclosing function scope, so that temporary variables are declared in the enclosing function, and the body in its own function scope.
+func (l *lowerer) walkFunc(params *js.Params, body *js.BlockStmt) {
+	l.scopes = append(l.scopes, &body.Scope)
+	js.Walk(l, params)
+	l.scopes = l.scopes[:len(l.scopes)-1]
+
+	f := &lowerFunc{body: body}
+	l.funcs = append(l.funcs, f)
+	js.Walk(l, body)
+	l.funcs = l.funcs[:len(l.funcs)-1]
+	l.declareTemps(f)
+}
+
+// checkPattern fails for assignment patterns that are not supported.
+func (l *lowerer) checkPattern(i js.IExpr) {
+	switch expr := i.(type) {
+	case *js.ArrayExpr:
+		if l.version < 2015 {
+			l.fail("destructuring")
+		}
+		for _, item := range expr.List {
+			l.checkPattern(item.Value)
+		}
+	case *js.ObjectExpr:
+		if l.version < 2015 {
+			l.fail("destructuring")
+		}
+		for _, item := range expr.List {
+			if item.Spread && l.version < 2018 {
+				l.fail("object rest properties")
+			}
+			l.checkPattern(item.Value)
+		}
+	case *js.BinaryExpr:
+		if expr.Op == js.EqToken {
+			l.checkPattern(expr.X)
+		}
+	}
+}
+
+// checkLiteral fails for BigInts and regular expression flags that are not supported.
+func (l *lowerer) checkLiteral(lit *js.LiteralExpr) {
+	switch lit.TokenType {
+	case js.DecimalToken, js.IntegerToken, js.BinaryToken, js.OctalToken, js.HexadecimalToken:
+		if lit.Data[len(lit.Data)-1] == 'n' && l.version < 2020 {
+			l.fail("BigInt literals")
+		}
+	case js.RegExpToken:
+		flags := lit.Data[bytes.LastIndexByte(lit.Data, '/')+1:]
+		if l.version < 2015 && (bytes.IndexByte(flags, 'u') != -1 || bytes.IndexByte(flags, 'y') != -1) {
+			l.fail("regular expression flags u and y")
+		} else if l.version < 2018 && bytes.IndexByte(flags, 's') != -1 {
+			l.fail("regular expression flag s")
+		} else if l.version < 2022 && bytes.IndexByte(flags, 'd') != -1 {
+			l.fail("regular expression flag d")
+		}
+	}
+}
+
+// lowerExpr returns the expression in older syntax, or the expression itself if it needs no lowering.
+func (l *lowerer) lowerExpr(i js.IExpr) js.IExpr {
+	switch expr := i.(type) {
+	case *js.DotExpr, *js.IndexExpr, *js.CallExpr:
+		if l.version < 2020 && hasOptionalChain(expr) {
+			return l.lowerOptionalChain(expr, false)
+		}
+	case *js.UnaryExpr:
+		if expr.Op == js.DeleteToken && l.version < 2020 && hasOptionalChain(expr.X) {
+			return l.lowerOptionalChain(expr.X, true)
+		}
+	case *js.BinaryExpr:
+		switch expr.Op {
+		case js.NullishToken:
+			if l.version < 2020 {
+				// a??b  =>  a!=null?a:b
+				first, second := l.reference(expr.X)
+				return &js.GroupExpr{X: &js.CondExpr{
+					Cond: &js.BinaryExpr{Op: js.NotEqToken, X: groupExpr(first, binaryLeftPrecMap[js.NotEqToken]), Y: &js.LiteralExpr{TokenType: js.NullToken, Data: nullBytes}},
+					X:    groupExpr(second, js.OpAssign),
+					Y:    groupExpr(expr.Y, js.OpAssign),
+				}}
+			}
+		case js.ExpToken:
+			if l.version < 2016 {
+				// a**b  =>  Math.pow(a,b)
+				return l.mathPow(expr.X, expr.Y)
+			}
+		case js.ExpEqToken:
+			if l.version < 2016 {
+				// a**=b  =>  a=Math.pow(a,b)
+				target, value := l.memberReference(expr.X)
+				return &js.GroupExpr{X: &js.BinaryExpr{Op: js.EqToken, X: target, Y: l.mathPow(value, expr.Y)}}
+			}
+		case js.OrEqToken, js.AndEqToken, js.NullishEqToken:
+			if l.version < 2021 {
+				// a||=b  =>  a||(a=b)
+				op := js.OrToken
+				if expr.Op == js.AndEqToken {
+					op = js.AndToken
+				} else if expr.Op == js.NullishEqToken {
+					op = js.NullishToken
+				}
+				value, target := l.memberReference(expr.X)
+				assign := &js.GroupExpr{X: &js.BinaryExpr{Op: js.EqToken, X: target, Y: groupExpr(expr.Y, js.OpAssign)}}
+				return &js.GroupExpr{X: &js.BinaryExpr{Op: op, X: groupExpr(value, binaryLeftPrecMap[op]), Y: assign}}
+			}
+		}
+	case *js.ObjectExpr:
+		if l.version < 2018 {
+			for _, item := range expr.List {
+				if item.Spread {
+					if l.version < 2015 {
+						// Object.assign is not available
+						l.fail("object spread properties")
+						return i
+					}
+					return l.lowerObjectSpread(expr)
+				}
+			}
+		}
+	case *js.TemplateExpr:
+		if l.version < 2015 {
+			if expr.Tag != nil {
+				l.fail("tagged templates")
+				return i
+			}
+			return lowerTemplate(expr)
+		}
+	case *js.ArrowFunc:
+		if l.version < 2015 {
+			finder := &lexicalFinder{}
+			js.Walk(finder, &expr.Body)
+			if finder.arguments {
+				l.fail("arrow functions that use arguments")
+				return i
+			}
+			fn := &js.FuncDecl{Async: expr.Async, Params: expr.Params, Body: expr.Body}
+			if finder.this {
+				// (()=>this)  =>  function(){return this}.bind(this)
+				return &js.CallExpr{
+					X:    &js.DotExpr{X: fn, Y: js.LiteralExpr{TokenType: js.IdentifierToken, Data: bindBytes}, Prec: js.OpMember},
+					Args: js.Args{List: []js.Arg{{Value: &js.LiteralExpr{TokenType: js.ThisToken, Data: thisBytes}}}},
+					Prec: js.OpCall,
+				}
+			}
+			return fn
+		}
+	}
+	return i
+}
+
+// hasOptionalChain returns true if the member or call expression is part of an optional chain.
+func hasOptionalChain(i js.IExpr) bool {
+	for {
+		x, optional := chainLink(i)
+		if x == nil {
+			return false
+		} else if optional {
+			return true
+		}
+		i = *x
+	}
+}
+
+// chainLink returns the object or callee of a member or call expression, and whether it is accessed optionally.
+func chainLink(i js.IExpr) (*js.IExpr, bool) {
+	switch expr := i.(type) {
+	case *js.DotExpr:
+		return &expr.X, expr.Optional
+	case *js.IndexExpr:
+		return &expr.X, expr.Optional
+	case *js.CallExpr:
+		return &expr.X, expr.Optional
+	}
+	return nil, false
+}
+
+// lowerOptionalChain rewrites an optional chain to a conditional expression that short-circuits the chain at the last optional link, such as:  a?.b.c  =>  a==null?void 0:a.b.c
+// Optional links in the object of the last optional link are lowered when they are walked.
+func (l *lowerer) lowerOptionalChain(chain js.IExpr, isDelete bool) js.IExpr {
+	link := &chain
+	for {
+		x, optional := chainLink(*link)
+		if optional {
+			break
+		}
+		link = x
+	}
+	x, _ := chainLink(*link)
+	switch expr := (*link).(type) {
+	case *js.DotExpr:
+		expr.Optional = false
+	case *js.IndexExpr:
+		expr.Optional = false
+	case *js.CallExpr:
+		expr.Optional = false
+	}
+
+	var check js.IExpr
+	call, isCall := (*link).(*js.CallExpr)
+	if obj := memberObject(*x); isCall && obj != nil {
+		// keep this for method calls:  a.b?.()  =>  (t=a.b)==null?void 0:t.call(a)
+		var this js.IExpr
+		*obj, this = l.reference(*obj)
+		if lit, ok := this.(*js.LiteralExpr); ok && lit.TokenType == js.SuperToken {
+			this = &js.LiteralExpr{TokenType: js.ThisToken, Data: thisBytes}
+		}
+		fn := l.temp()
+		check = &js.BinaryExpr{Op: js.EqToken, X: l.use(fn), Y: *x}
+		*link = &js.CallExpr{
+			X:    &js.DotExpr{X: l.use(fn), Y: js.LiteralExpr{TokenType: js.IdentifierToken, Data: callBytes}, Prec: js.OpMember},
+			Args: js.Args{List: append([]js.Arg{{Value: this}}, call.Args.List...)},
+			Prec: js.OpCall,
+		}
+	} else {
+		check, *x = l.reference(*x)
+		if _, ok := (*x).(*js.Var); !ok {
+			*x = groupExpr(*x, js.OpMember)
+		}
+	}
+
+	var short js.IExpr = &js.UnaryExpr{Op: js.VoidToken, X: &js.LiteralExpr{TokenType: js.DecimalToken, Data: zeroBytes}}
+	if isDelete {
+		short = &js.LiteralExpr{TokenType: js.TrueToken, Data: trueBytes}
+		chain = &js.UnaryExpr{Op: js.DeleteToken, X: chain}
+	}
+	return &js.GroupExpr{X: &js.CondExpr{
+		Cond: &js.BinaryExpr{Op: js.EqEqToken, X: groupExpr(check, binaryLeftPrecMap[js.EqEqToken]), Y: &js.LiteralExpr{TokenType: js.NullToken, Data: nullBytes}},
+		X:    short,
+		Y:    groupExpr(chain, js.OpAssign),
+	}}
+}
+
+// memberObject returns the object of a member expression.
+func memberObject(i js.IExpr) *js.IExpr {
+	switch expr := i.(type) {
+	case *js.DotExpr:
+		return &expr.X
+	case *js.IndexExpr:
+		return &expr.X
+	}
+	return nil
+}
+
+// reference returns the expression to evaluate first, and an expression that refers to its value afterwards. Expressions with side effects are assigned to a temporary variable.
+func (l *lowerer) reference(i js.IExpr) (js.IExpr, js.IExpr) {
+	switch expr := i.(type) {
+	case *js.Var:
+		return expr, l.use(expr)
+	case *js.LiteralExpr:
+		if expr.TokenType != js.RegExpToken {
+			lit := *expr
+			return expr, &lit
+		}
+	}
+	t := l.temp()
+	return &js.GroupExpr{X: &js.BinaryExpr{Op: js.EqToken, X: l.use(t), Y: groupExpr(i, js.OpAssign)}}, l.use(t)
+}
+
+// memberReference returns two references to the same assignment target, where the first evaluates the object and key of a member expression.
+func (l *lowerer) memberReference(i js.IExpr) (js.IExpr, js.IExpr) {
+	switch expr := i.(type) {
+	case *js.DotExpr:
+		first, second := l.reference(expr.X)
+		return &js.DotExpr{X: groupExpr(first, js.OpMember), Y: expr.Y, Prec: expr.Prec}, &js.DotExpr{X: second, Y: expr.Y, Prec: expr.Prec}
+	case *js.IndexExpr:
+		first, second := l.reference(expr.X)
+		firstKey, secondKey := l.reference(expr.Y)
+		return &js.IndexExpr{X: groupExpr(first, js.OpMember), Y: firstKey, Prec: expr.Prec}, &js.IndexExpr{X: second, Y: secondKey, Prec: expr.Prec}
+	case *js.GroupExpr:
+		return l.memberReference(expr.X)
+	}
+	return l.reference(i)
+}
+
+// mathPow returns:  Math.pow(a,b)
+func (l *lowerer) mathPow(a, b js.IExpr) js.IExpr {
+	return &js.CallExpr{
+		X:    &js.DotExpr{X: l.global(MathBytes), Y: js.LiteralExpr{TokenType: js.IdentifierToken, Data: powBytes}, Prec: js.OpMember},
+		Args: js.Args{List: []js.Arg{{Value: groupExpr(a, js.OpAssign)}, {Value: groupExpr(b, js.OpAssign)}}},
+		Prec: js.OpCall,
+	}
+}
+
+// lowerObjectSpread returns:  {a,...b,c}  =>  Object.assign({a},b,{c})
+func (l *lowerer) lowerObjectSpread(obj *js.ObjectExpr) js.IExpr {
+	var args []js.Arg
+	var cur *js.ObjectExpr
+	for _, item := range obj.List {
+		if item.Spread {
+			if cur != nil {
+				args = append(args, js.Arg{Value: cur})
+				cur = nil
+			} else if len(args) == 0 {
+				args = append(args, js.Arg{Value: &js.ObjectExpr{}})
+			}
+			args = append(args, js.Arg{Value: groupExpr(item.Value, js.OpAssign)})
+		} else {
+			if cur == nil {
+				cur = &js.ObjectExpr{}
+			}
+			cur.List = append(cur.List, item)
+		}
+	}
+	if cur != nil {
+		args = append(args, js.Arg{Value: cur})
+	}
+	return &js.CallExpr{
+		X:    &js.DotExpr{X: l.global(ObjectBytes), Y: js.LiteralExpr{TokenType: js.IdentifierToken, Data: assignBytes}, Prec: js.OpMember},
+		Args: js.Args{List: args},
+		Prec: js.OpCall,
+	}
+}
+
+// lowerTemplate returns:  `a${b}c`  =>  "a".concat(b,"c")
+func lowerTemplate(expr *js.TemplateExpr) js.IExpr {
+	if len(expr.List) == 0 {
+		return &js.LiteralExpr{TokenType: js.StringToken, Data: templateString(expr.Tail[1 : len(expr.Tail)-1])}
+	}
+	head := expr.List[0].Value
+	args := make([]js.Arg, 0, 2*len(expr.List))
+	for i, item := range expr.List {
+		args = append(args, js.Arg{Value: groupExpr(item.Expr, js.OpAssign)})
+		var s []byte
+		if i+1 < len(expr.List) {
+			s = expr.List[i+1].Value
+			s = s[1 : len(s)-2]
+		} else {
+			s = expr.Tail[1 : len(expr.Tail)-1]
+		}
+		if 0 < len(s) {
+			args = append(args, js.Arg{Value: &js.LiteralExpr{TokenType: js.StringToken, Data: templateString(s)}})
+		}
+	}
+	// concat converts the values to strings like template literals do, whereas + calls valueOf first
+	str := &js.LiteralExpr{TokenType: js.StringToken, Data: templateString(head[1 : len(head)-2])}
+	return &js.CallExpr{
+		X:    &js.DotExpr{X: str, Y: js.LiteralExpr{TokenType: js.IdentifierToken, Data: concatBytes}, Prec: js.OpMember},
+		Args: js.Args{List: args},
+		Prec: js.OpCall,
+	}
+}
+
+// templateString returns the string literal for the raw contents of a template literal. Escape sequences are valid in both, but line terminators must be escaped.
+func templateString(b []byte) []byte {
+	s := make([]byte, 0, len(b)+2)
+	s = append(s, '"')
+	for i := 0; i < len(b); i++ {
+		c := b[i]
+		if c == '\\' && i+1 < len(b) {
+			s = append(s, c, b[i+1])
+			i++
+			if b[i] == '\r' && i+1 < len(b) && b[i+1] == '\n' {
+				s = append(s, '\n')
+				i++
+			}
+		} else if c == '"' {
+			s = append(s, '\\', '"')
+		} else if c == '\r' || c == '\n' {
+			s = append(s, '\\', 'n')
+			if c == '\r' && i+1 < len(b) && b[i+1] == '\n' {
+				i++
+			}
+		} else if c == 0xE2 && i+2 < len(b) && b[i+1] == 0x80 && (b[i+2] == 0xA8 || b[i+2] == 0xA9) {
+			// line and paragraph separators are not allowed in strings before ES2019
+			s = append(s, '\\', 'u', '2', '0', '2', '8'+b[i+2]-0xA8)
+			i += 2
+		} else {
+			s = append(s, c)
+		}
+	}
+	return append(s, '"')
+}
+
+// lowerLexicalDecl converts let and const declarations to var declarations in the function scope. Variables declared in a block are renamed if they would collide with other variables in the function. Variables in loops get a new binding for every iteration, which cannot be lowered if they are used by nested functions.
+func (l *lowerer) lowerLexicalDecl(decl *js.VarDecl) {
+	f := l.funcs[len(l.funcs)-1]
+	scope := decl.Scope
+	funcScope := &f.body.Scope
+	for i, item := range decl.List {
+		v, ok := item.Binding.(*js.Var)
+		if !ok {
+			continue // destructuring fails when walked
+		} else if decl.TokenType == js.ConstToken && l.assigned[v] {
+			// an assignment to a constant throws a TypeError, which is lost when converted to var
+			l.fail("const declarations that are reassigned")
+			return
+		} else if 0 < f.loops && l.captured[v] {
+			l.fail(fmt.Sprintf("%s declarations in loops that are used by nested functions", decl.TokenType))
+			return
+		}
+
+		v.Decl = js.VariableDecl
+		if 0 < f.loops && item.Default == nil && !decl.InForInOf {
+			decl.List[i].Default = &js.UnaryExpr{Op: js.VoidToken, X: &js.LiteralExpr{TokenType: js.DecimalToken, Data: zeroBytes}}
+		}
+		if scope != scope.Func {
+			for j, w := range scope.Declared {
+				if w == v {
+					scope.Declared = append(scope.Declared[:j], scope.Declared[j+1:]...)
+					if j < int(scope.NumForDecls) {
+						scope.NumForDecls--
+					}
+					break
+				}
+			}
+			if l.collides(v, scope, funcScope) {
+				v.Data = []byte(l.newName(string(v.Data)))
+			}
+			for s := scope; s != s.Func; s = s.Parent {
+				s.AddUndeclared(v)
+			}
+			funcScope.Declared = append(funcScope.Declared, v)
+		}
+	}
+	decl.TokenType = js.VarToken
+	decl.Scope = funcScope
+	funcScope.VarDecls = append(funcScope.VarDecls, decl)
+}
+
+// collides returns true if the name of the variable is used by another variable in the function scope, or is declared in one of the scopes between the block and the function scope.
+func (l *lowerer) collides(v *js.Var, scope, funcScope *js.Scope) bool {
+	for _, w := range funcScope.Declared {
+		if bytes.Equal(w.Data, v.Data) {
+			return true
+		}
+	}
+	for _, w := range funcScope.Undeclared {
+		for w.Link != nil {
+			w = w.Link
+		}
+		if w != v && bytes.Equal(w.Data, v.Data) {
+			return true
+		}
+	}
+	for s := scope.Parent; s != nil && s != s.Func; s = s.Parent {
+		for _, w := range s.Declared {
+			if bytes.Equal(w.Data, v.Data) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// newName returns a variable name that is not used in the input.
+func (l *lowerer) newName(name string) string {
+	orig := name
+	for i := 1; l.names[name]; i++ {
+		name = orig + strconv.Itoa(i)
+	}
+	l.names[name] = true
+	return name
+}
+
+// temp returns a new temporary variable that is declared in the current function, or in a function around the expression at the top level of a script.
+func (l *lowerer) temp() *js.Var {
+	f := l.funcs[len(l.funcs)-1]
+	v := &js.Var{Data: []byte(l.newName("_")), Uses: 1, Decl: js.VariableDecl}
+	if len(l.funcs) == 1 && !l.module {
+		l.wrapped = append(l.wrapped, v)
+		return v
+	}
+	f.temps = append(f.temps, v)
+	for i := len(l.scopes) - 1; 0 <= i && l.scopes[i] != &f.body.Scope; i-- {
+		l.scopes[i].AddUndeclared(v)
+	}
+	return v
+}
+
+// use returns the variable to be used once more.
+func (l *lowerer) use(v *js.Var) *js.Var {
+	for w := v; w != nil; w = w.Link {
+		w.Uses++
+	}
+	return v
+}
+
+// global returns a global variable such as Math, which must not be used as a name for renamed variables.
+func (l *lowerer) global(name []byte) *js.Var {
+	v, ok := l.globals[string(name)]
+	if !ok {
+		v = &js.Var{Data: name}
+		l.globals[string(name)] = v
+	}
+	for _, scope := range l.scopes {
+		scope.AddUndeclared(v)
+	}
+	return l.use(v)
+}
+
+// declareTemps adds a declaration of the temporary variables to the start of the function body.
+func (l *lowerer) declareTemps(f *lowerFunc) {
+	if len(f.temps) == 0 {
+		return
+	}
+	decl := &js.VarDecl{TokenType: js.VarToken, Scope: &f.body.Scope}
+	for _, v := range f.temps {
+		decl.List = append(decl.List, js.BindingElement{Binding: v})
+	}
+	f.body.Scope.Declared = append(f.body.Scope.Declared, f.temps...)
+	f.body.Scope.VarDecls = append(f.body.Scope.VarDecls, decl)
+
+	i := 0
+	for i < len(f.body.List) {
+		if _, ok := f.body.List[i].(*js.DirectivePrologueStmt); !ok {
+			break
+		}
+		i++
+	}
+	f.body.List = append(f.body.List[:i], append([]js.IStmt{decl}, f.body.List[i:]...)...)
+}
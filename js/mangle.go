@@ -0,0 +1,163 @@
+package js
+
+import (
+	"bytes"
+	"sort"
+	"sync"
+
+	"github.com/tdewolff/parse/v2/js"
+)
+
+// NameCache maps original property names to mangled property names. It can be shared between minifications and stored as JSON so that mangled names remain the same across separately minified files and builds.
+type NameCache struct {
+	Props map[string]string `json:"props"`
+
+	mu sync.Mutex
+}
+
+// NewNameCache returns an empty name cache.
+func NewNameCache() *NameCache {
+	return &NameCache{
+		Props: map[string]string{},
+	}
+}
+
+// propMangler collects and renames the property names that are not quoted.
+type propMangler struct {
+	m     *jsMinifier
+	names map[string]int // number of occurrences of every property name
+	props map[string]string
+}
+
+// mangleProps renames all properties that match the MangleProps regular expression and are not reserved.
+func (m *jsMinifier) mangleProps(ast *js.AST) {
+	p := &propMangler{
+		m:     m,
+		names: map[string]int{},
+	}
+	js.Walk(p, ast)
+
+	cache := m.o.NameCache
+	if cache == nil {
+		cache = NewNameCache()
+	}
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	if cache.Props == nil {
+		cache.Props = map[string]string{}
+	}
+
+	// assign new names to the most frequent properties first
+	var mangle []string
+	for name := range p.names {
+		if _, ok := cache.Props[name]; !ok && p.isMangled(name) {
+			mangle = append(mangle, name)
+		}
+	}
+	sort.Slice(mangle, func(i, j int) bool {
+		if p.names[mangle[i]] != p.names[mangle[j]] {
+			return p.names[mangle[i]] > p.names[mangle[j]]
+		}
+		return mangle[i] < mangle[j]
+	})
+	if 0 < len(mangle) {
+		used := map[string]bool{}
+		for _, name := range cache.Props {
+			used[name] = true
+		}
+		i := 0
+		for _, name := range mangle {
+			for {
+				newName := string(m.renamer.getName([]byte{0}, i))
+				i++
+				if _, ok := m.renamer.reserved[newName]; ok || used[newName] || p.isReserved(newName) {
+					continue
+				} else if _, ok := p.names[newName]; ok && !p.isMangled(newName) {
+					continue // property that keeps its name
+				}
+				cache.Props[name] = newName
+				used[newName] = true
+				break
+			}
+		}
+	}
+
+	p.props = cache.Props
+	p.names = nil
+	js.Walk(p, ast)
+}
+
+// isMangled returns true if the property should be mangled.
+func (p *propMangler) isMangled(name string) bool {
+	return p.m.o.MangleProps.MatchString(name) && !p.isReserved(name)
+}
+
+func (p *propMangler) isReserved(name string) bool {
+	for _, reserved := range p.m.o.ReservedProps {
+		if name == reserved {
+			return true
+		}
+	}
+	return false
+}
+
+// visit counts the property name in the first pass and renames it in the second pass. Property names in object literals may have been quoted, since the parser doesn't distinguish them, string literals are treated as property names in index expressions and in the left-hand side of the in operator for consistency.
+func (p *propMangler) visit(name *js.LiteralExpr) {
+	data := name.Data
+	if name.TokenType == js.StringToken {
+		if bytes.IndexByte(data, '\\') != -1 || !js.AsIdentifierName(data[1:len(data)-1]) {
+			return
+		}
+		data = data[1 : len(data)-1]
+	} else if !js.IsIdentifierName(name.TokenType) {
+		return // numeric
+	}
+
+	if p.names != nil {
+		p.names[string(data)]++
+	} else if newName, ok := p.props[string(data)]; ok && p.isMangled(string(data)) {
+		if name.TokenType == js.StringToken {
+			quote := name.Data[0]
+			name.Data = append(append([]byte{quote}, newName...), quote)
+		} else {
+			name.TokenType = js.IdentifierToken
+			name.Data = []byte(newName)
+		}
+	}
+}
+
+func (p *propMangler) Enter(n js.INode) js.IVisitor {
+	switch node := n.(type) {
+	case *js.DotExpr:
+		if y, ok := node.Y.(js.LiteralExpr); ok {
+			p.visit(&y)
+			node.Y = y
+		}
+	case *js.IndexExpr:
+		if y, ok := node.Y.(*js.LiteralExpr); ok && y.TokenType == js.StringToken {
+			p.visit(y)
+		}
+	case *js.BinaryExpr:
+		if x, ok := node.X.(*js.LiteralExpr); ok && x.TokenType == js.StringToken && node.Op == js.InToken {
+			p.visit(x)
+		}
+	case *js.PropertyName:
+		if !node.IsComputed() {
+			p.visit(&node.Literal)
+		}
+	case *js.MethodDecl:
+		if node.Name.Private == nil && !node.Name.IsComputed() {
+			p.visit(&node.Name.Literal)
+		}
+	case *js.ClassDecl:
+		// fields are walked by value
+		for i := range node.List {
+			if field := &node.List[i].Field; node.List[i].Method == nil && node.List[i].StaticBlock == nil && field.Name.Private == nil && !field.Name.IsComputed() {
+				p.visit(&field.Name.Literal)
+			}
+		}
+	}
+	return p
+}
+
+func (p *propMangler) Exit(js.INode) {}
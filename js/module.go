@@ -0,0 +1,189 @@
+package js
+
+import (
+	"github.com/tdewolff/parse/v2/js"
+)
+
+// optimizeImports merges import statements of the same module, and removes unused imports of modules without side effects.
+func (m *jsMinifier) optimizeImports(ast *js.AST) {
+	hasImports := false
+	uses := map[string]int{} // number of uses of every import binding
+	for _, item := range ast.List {
+		switch stmt := item.(type) {
+		case *js.ImportStmt:
+			hasImports = true
+		case *js.ExportStmt:
+			if stmt.Module == nil {
+				for _, alias := range stmt.List {
+					uses[string(localName(alias))]++
+				}
+			}
+		}
+	}
+	if !hasImports {
+		return
+	}
+
+	// import bindings are not declared by the parser, their uses are those of the undeclared variables
+	for _, v := range ast.Scope.Undeclared {
+		for v.Link != nil {
+			v = v.Link
+		}
+		uses[string(v.Data)] += int(v.Uses)
+	}
+
+	// import bindings may be referenced by name from a direct eval anywhere in the module
+	evals := usesEval(ast.Scope)
+
+	imports := map[string][]*js.ImportStmt{}
+	list := ast.List[:0]
+	for _, item := range ast.List {
+		if stmt, ok := item.(*js.ImportStmt); ok {
+			trimImport(stmt)
+			module := string(stmt.Module[1 : len(stmt.Module)-1])
+			if m.isPureModule(module) && !evals {
+				removeUnusedImports(stmt, uses)
+				if stmt.Default == nil && stmt.List == nil {
+					continue
+				}
+			}
+
+			merged := false
+			for _, prev := range imports[module] {
+				if mergeImports(prev, stmt) {
+					merged = true
+					break
+				}
+			}
+			if merged {
+				continue
+			}
+			imports[module] = append(imports[module], stmt)
+		}
+		list = append(list, item)
+	}
+	ast.List = list
+}
+
+// isPureModule returns true if the module specifier is listed as having no side effects.
+func (m *jsMinifier) isPureModule(module string) bool {
+	for _, pureModule := range m.o.PureModules {
+		if module == pureModule {
+			return true
+		}
+	}
+	return false
+}
+
+// localName returns the name of the local binding of an export specifier.
+func localName(alias js.Alias) []byte {
+	if alias.Name != nil {
+		return alias.Name
+	}
+	return alias.Binding
+}
+
+// isNamespaceImport returns true for imports such as: import * as ns from "module"
+func isNamespaceImport(stmt *js.ImportStmt) bool {
+	return len(stmt.List) == 1 && len(stmt.List[0].Name) == 1 && stmt.List[0].Name[0] == '*'
+}
+
+// trimImport removes the empty specifier of a trailing comma.
+func trimImport(stmt *js.ImportStmt) {
+	if 0 < len(stmt.List) && stmt.List[len(stmt.List)-1].Binding == nil {
+		stmt.List = stmt.List[:len(stmt.List)-1]
+	}
+}
+
+// removeUnusedImports removes the bindings that are not used. Without bindings left, the import statement only has side effects.
+func removeUnusedImports(stmt *js.ImportStmt, uses map[string]int) {
+	if stmt.Default != nil && uses[string(stmt.Default)] == 0 {
+		stmt.Default = nil
+	}
+	list := stmt.List[:0]
+	for _, alias := range stmt.List {
+		if 0 < uses[string(alias.Binding)] {
+			list = append(list, alias)
+		}
+	}
+	stmt.List = list
+	if len(stmt.List) == 0 {
+		stmt.List = nil
+	}
+}
+
+// mergeImports merges the import statement src into dst of the same module and returns true if possible. A namespace import cannot be combined with named imports.
+func mergeImports(dst, src *js.ImportStmt) bool {
+	if src.Default == nil && len(src.List) == 0 {
+		return true // side-effect only import
+	} else if dst.Default != nil && src.Default != nil {
+		return false
+	} else if 0 < len(dst.List) && 0 < len(src.List) && (isNamespaceImport(dst) || isNamespaceImport(src)) {
+		return false
+	}
+
+	if dst.Default == nil {
+		dst.Default = src.Default
+	}
+	dst.List = append(dst.List, src.List...)
+	return true
+}
+
+// renameModule renames the top-level declarations of a module that are not exported, since they are not global variables.
+func (m *jsMinifier) renameModule(ast *js.AST) {
+	if !m.renamer.rename {
+		return
+	}
+
+	scope := ast.Scope
+	scope.Undeclared = scope.Undeclared[:len(scope.Undeclared):len(scope.Undeclared)]
+	exported := map[string]bool{}
+	for _, item := range ast.List {
+		switch stmt := item.(type) {
+		case *js.ImportStmt:
+			// import bindings are not declared by the parser, new names must not collide with unused bindings
+			if stmt.Default != nil {
+				scope.Undeclared = append(scope.Undeclared, &js.Var{Data: stmt.Default})
+			}
+			for _, alias := range stmt.List {
+				if alias.Binding != nil {
+					scope.Undeclared = append(scope.Undeclared, &js.Var{Data: alias.Binding})
+				}
+			}
+		case *js.ExportStmt:
+			if stmt.Default || stmt.Module != nil {
+				// local names of default exports are not exported
+				continue
+			}
+			switch decl := stmt.Decl.(type) {
+			case *js.VarDecl:
+				var vs []*js.Var
+				for _, item := range decl.List {
+					vs = appendBindingVars(vs, item.Binding)
+				}
+				for _, v := range vs {
+					exported[string(v.Data)] = true
+				}
+			case *js.FuncDecl:
+				exported[string(decl.Name.Data)] = true
+			case *js.ClassDecl:
+				exported[string(decl.Name.Data)] = true
+			}
+			for _, alias := range stmt.List {
+				exported[string(localName(alias))] = true
+			}
+		}
+	}
+
+	if 0 < len(exported) {
+		if m.renamer.keep == nil {
+			m.renamer.keep = map[*js.Var]bool{}
+		}
+		for _, v := range scope.Declared {
+			if exported[string(v.Data)] {
+				m.renamer.keep[v] = true
+			}
+		}
+	}
+	m.renamer.renameScope(scope)
+}
@@ -0,0 +1,478 @@
+package js
+
+import (
+	"bytes"
+
+	"github.com/tdewolff/parse/v2"
+	"github.com/tdewolff/parse/v2/js"
+)
+
+var (
+	pureBytes    = []byte("__PURE__")
+	consoleBytes = []byte("console")
+)
+
+// pureFinder matches the /*#__PURE__*/ and /*@__PURE__*/ annotations to the call and new expressions that follow them. The parser does not keep the positions of nodes and shares variables between their uses, so the uses of every name are counted in source order and the n-th use is matched to the n-th identifier token with that name. The function, class, and => tokens are matched to their nodes in the same way, and the other nodes start with their first child or with a token that precedes it, such as new or an opening parenthesis.
+type pureFinder struct {
+	tokens      []js.TokenType
+	indices     map[*byte]int    // token indices by the address of their data, the parser shares the input buffer with the lexer
+	annotated   map[int]bool     // indices of the tokens that directly follow an annotation
+	occurrences map[string][]int // indices of the identifier, function, class, and => tokens by their data
+	skipped     map[int]bool     // indices of identifier tokens that are not variables, such as property names and labels
+	counts      map[string]int   // number of variable uses and function, class, and arrow function nodes in source order
+	refs        map[js.INode]pureRef
+}
+
+// pureRef is the use of a name that a node starts with.
+type pureRef struct {
+	name string
+	i    int
+}
+
+// markPureAnnotations records the call and new expressions that are annotated as pure in the AST parsed from src. The capacity of src must exceed its length, so that the lexer uses the same buffer as the parser. Annotations that do not directly precede a call or new expression are ignored, as are annotations whose call or new expression cannot be located.
+func markPureAnnotations(src []byte, ast *js.AST, pure map[js.IExpr]bool) {
+	if !bytes.Contains(src, pureBytes) {
+		return
+	}
+
+	p := &pureFinder{
+		indices:     map[*byte]int{},
+		annotated:   map[int]bool{},
+		occurrences: map[string][]int{},
+		skipped:     map[int]bool{},
+		counts:      map[string]int{},
+		refs:        map[js.INode]pureRef{},
+	}
+	walkTokens(src, func(tt js.TokenType, data []byte, _ int) {
+		if tt == js.CommentToken || tt == js.CommentLineTerminatorToken {
+			if isPureAnnotation(data) {
+				p.annotated[len(p.tokens)] = true
+			}
+			return
+		} else if js.IsIdentifier(tt) || tt == js.FunctionToken || tt == js.ClassToken || tt == js.ArrowToken {
+			p.occurrences[string(data)] = append(p.occurrences[string(data)], len(p.tokens))
+		}
+		p.indices[&data[0]] = len(p.tokens)
+		p.tokens = append(p.tokens, tt)
+	})
+	if len(p.annotated) == 0 {
+		return
+	}
+
+	js.Walk(p, &ast.BlockStmt)
+	for name, occurrences := range p.occurrences {
+		n := 0
+		for _, i := range occurrences {
+			if !p.skipped[i] {
+				occurrences[n] = i
+				n++
+			}
+		}
+		if n != p.counts[name] {
+			// an identifier is used in a way that is not counted, such as a contextual keyword
+			n = 0
+		}
+		p.occurrences[name] = occurrences[:n]
+	}
+	js.Walk(pureMarker{p, pure}, &ast.BlockStmt)
+}
+
+// walkComments calls f for every comment in the input with the offset of the end of the comment.
+func walkComments(src []byte, f func(js.TokenType, []byte, int)) {
+	walkTokens(src, func(tt js.TokenType, data []byte, offset int) {
+		if tt == js.CommentToken || tt == js.CommentLineTerminatorToken {
+			f(tt, data, offset+len(data))
+		}
+	})
+}
+
+// walkTokens calls f for every token in the input except whitespace and line terminators, with the offset of the start of the token.
+func walkTokens(src []byte, f func(js.TokenType, []byte, int)) {
+	z := parse.NewInputBytes(src)
+	defer z.Restore()
+
+	expr := false // whether the previous token ends an expression, to distinguish divisions from regular expressions
+	l := js.NewLexer(z)
+	for {
+		tt, data := l.Next()
+		switch tt {
+		case js.ErrorToken:
+			return
+		case js.WhitespaceToken, js.LineTerminatorToken:
+			continue
+		case js.CommentToken, js.CommentLineTerminatorToken:
+			f(tt, data, z.Offset()-len(data))
+			continue
+		case js.DivToken, js.DivEqToken:
+			if !expr {
+				tt, data = l.RegExp()
+			}
+		}
+		f(tt, data, z.Offset()-len(data))
+		expr = js.IsIdentifier(tt) || js.IsNumeric(tt)
+		switch tt {
+		case js.StringToken, js.TemplateToken, js.TemplateEndToken, js.RegExpToken, js.PrivateIdentifierToken, js.CloseParenToken, js.CloseBracketToken, js.CloseBraceToken, js.ThisToken, js.SuperToken, js.TrueToken, js.FalseToken, js.NullToken, js.IncrToken, js.DecrToken:
+			expr = true
+		}
+	}
+}
+
+// isPureAnnotation returns true for the /*#__PURE__*/ and /*@__PURE__*/ comments.
+func isPureAnnotation(comment []byte) bool {
+	if len(comment) < 4 || comment[1] != '*' {
+		return false
+	}
+	comment = bytes.TrimSpace(comment[2 : len(comment)-2])
+	return len(comment) == 1+len(pureBytes) && (comment[0] == '#' || comment[0] == '@') && bytes.Equal(comment[1:], pureBytes)
+}
+
+// Enter counts the uses of variables and the function, class, and arrow function nodes in source order. Unlike js.Walk, the heads of statements and functions are walked before their bodies, and callees before their arguments.
+func (p *pureFinder) Enter(n js.INode) js.IVisitor {
+	switch n := n.(type) {
+	case *js.Var:
+		p.counts[string(n.Data)]++
+	case *js.LiteralExpr:
+		p.skip(n.Data)
+	case js.LiteralExpr:
+		p.skip(n.Data) // property name of a member expression
+	case *js.BranchStmt:
+		p.skip(n.Label)
+	case *js.LabelledStmt:
+		p.skip(n.Label)
+	case *js.Alias:
+		p.skip(n.Name)
+		p.skip(n.Binding)
+	case *js.ImportStmt:
+		p.skip(n.Default)
+	case *js.IfStmt:
+		p.walk(n.Cond, n.Body, n.Else)
+		return nil
+	case *js.WhileStmt:
+		p.walk(n.Cond, n.Body)
+		return nil
+	case *js.ForStmt:
+		p.walk(n.Init, n.Cond, n.Post)
+		if n.Body != nil {
+			p.walk(n.Body)
+		}
+		return nil
+	case *js.ForInStmt:
+		p.walk(n.Init, n.Value)
+		if n.Body != nil {
+			p.walk(n.Body)
+		}
+		return nil
+	case *js.ForOfStmt:
+		p.walk(n.Init, n.Value)
+		if n.Body != nil {
+			p.walk(n.Body)
+		}
+		return nil
+	case *js.SwitchStmt:
+		p.walk(n.Init)
+		for i := range n.List {
+			p.walk(n.List[i].Cond)
+			for _, stmt := range n.List[i].List {
+				p.walk(stmt)
+			}
+		}
+		return nil
+	case *js.WithStmt:
+		p.walk(n.Cond, n.Body)
+		return nil
+	case *js.TryStmt:
+		if n.Body != nil {
+			p.walk(n.Body)
+		}
+		if n.Catch != nil {
+			p.walk(n.Binding, n.Catch)
+		}
+		if n.Finally != nil {
+			p.walk(n.Finally)
+		}
+		return nil
+	case *js.FuncDecl:
+		p.ref(n, "function")
+		if n.Name != nil {
+			p.walk(n.Name)
+		}
+		p.walk(&n.Params, &n.Body)
+		return nil
+	case *js.ClassDecl:
+		p.ref(n, "class")
+	case *js.MethodDecl:
+		p.walkName(n.Name)
+		p.walk(&n.Params, &n.Body)
+		return nil
+	case *js.Field:
+		p.walkName(n.Name)
+		p.walk(n.Init)
+		return nil
+	case *js.ArrowFunc:
+		p.walk(&n.Params)
+		p.ref(n, "=>")
+		p.walk(&n.Body)
+		return nil
+	case *js.TemplateExpr:
+		if n.Tag != nil {
+			p.refVar(n, n.Tag)
+			p.walk(n.Tag)
+		}
+		for i := range n.List {
+			p.walk(&n.List[i])
+		}
+		return nil
+	case *js.GroupExpr:
+		p.refVar(n, n.X)
+	case *js.DotExpr:
+		p.refVar(n, n.X)
+	case *js.IndexExpr:
+		p.refVar(n, n.X)
+	case *js.NewExpr:
+		p.refVar(n, n.X)
+		p.walk(n.X)
+		if n.Args != nil {
+			p.walk(n.Args)
+		}
+		return nil
+	case *js.CallExpr:
+		p.refVar(n, n.X)
+		p.walk(n.X, &n.Args)
+		return nil
+	}
+	return p
+}
+
+func (p *pureFinder) Exit(js.INode) {}
+
+func (p *pureFinder) walk(nodes ...js.INode) {
+	for _, n := range nodes {
+		js.Walk(p, n)
+	}
+}
+
+func (p *pureFinder) walkName(name js.ClassElementName) {
+	if name.Private != nil {
+		p.walk(name.Private)
+	} else if name.IsComputed() {
+		p.walk(name.Computed)
+	} else {
+		p.skip(name.Literal.Data)
+	}
+}
+
+// skip marks the token of an identifier that is not a variable.
+func (p *pureFinder) skip(data []byte) {
+	if 0 < len(data) {
+		if i, ok := p.indices[&data[0]]; ok {
+			p.skipped[i] = true
+		}
+	}
+}
+
+// ref records that the node starts at the next use of the name.
+func (p *pureFinder) ref(n js.INode, name string) {
+	p.refs[n] = pureRef{name, p.counts[name]}
+	p.counts[name]++
+}
+
+// refVar records that the node starts at its first child if that is a variable. Its use is counted when the child is walked.
+func (p *pureFinder) refVar(n js.INode, x js.IExpr) {
+	if v, ok := x.(*js.Var); ok {
+		p.refs[n] = pureRef{string(v.Data), p.counts[string(v.Data)]}
+	}
+}
+
+// index returns the index of the token of data, or -1 if data is not part of the input, such as for copied or generated names.
+func (p *pureFinder) index(data []byte) int {
+	if len(data) == 0 {
+		return -1
+	} else if i, ok := p.indices[&data[0]]; ok {
+		return i
+	}
+	return -1
+}
+
+// token returns the index of the token of the node's reference, or -1 if it is unknown.
+func (p *pureFinder) token(n js.INode) int {
+	if ref, ok := p.refs[n]; ok && ref.i < len(p.occurrences[ref.name]) {
+		return p.occurrences[ref.name][ref.i]
+	}
+	return -1
+}
+
+// prefix returns the index of the token preceding i if it is of the given type, or -1 otherwise.
+func (p *pureFinder) prefix(i int, tt js.TokenType) int {
+	if 0 < i && p.tokens[i-1] == tt {
+		return i - 1
+	}
+	return -1
+}
+
+// start returns the index of the first token of the expression, or -1 if it is unknown.
+func (p *pureFinder) start(n js.INode) int {
+	switch n := n.(type) {
+	case *js.LiteralExpr:
+		return p.index(n.Data)
+	case *js.TemplateExpr:
+		if n.Tag != nil {
+			return p.first(n, n.Tag)
+		} else if 0 < len(n.List) {
+			return p.index(n.List[0].Value)
+		}
+		return p.index(n.Tail)
+	case *js.GroupExpr:
+		return p.prefix(p.first(n, n.X), js.OpenParenToken)
+	case *js.DotExpr:
+		return p.first(n, n.X)
+	case *js.IndexExpr:
+		return p.first(n, n.X)
+	case *js.NewExpr:
+		return p.prefix(p.first(n, n.X), js.NewToken)
+	case *js.CallExpr:
+		return p.first(n, n.X)
+	case *js.FuncDecl:
+		if i := p.token(n); n.Async {
+			return p.prefix(i, js.AsyncToken)
+		} else {
+			return i
+		}
+	case *js.ClassDecl:
+		return p.token(n)
+	case *js.ArrowFunc:
+		// the parameters precede =>, either a single identifier or in parentheses
+		i := p.token(n) - 1
+		if i < 0 {
+			return -1
+		} else if p.tokens[i] == js.CloseParenToken {
+			for level := 0; 0 <= i; i-- {
+				if p.tokens[i] == js.CloseParenToken {
+					level++
+				} else if p.tokens[i] == js.OpenParenToken {
+					if level--; level == 0 {
+						break
+					}
+				}
+			}
+		}
+		if n.Async {
+			return p.prefix(i, js.AsyncToken)
+		}
+		return i
+	}
+	return -1
+}
+
+// first returns the index of the first token of x, which is the first child of n.
+func (p *pureFinder) first(n js.INode, x js.IExpr) int {
+	if _, ok := x.(*js.Var); ok {
+		return p.token(n)
+	}
+	return p.start(x)
+}
+
+// pureMarker records the call and new expressions that start at an annotated token. Expressions are entered before their children, so that the outermost expression that starts at the token binds to the annotation, as in /*#__PURE__*/f()().
+type pureMarker struct {
+	*pureFinder
+	pure map[js.IExpr]bool
+}
+
+func (p pureMarker) Enter(n js.INode) js.IVisitor {
+	switch n.(type) {
+	case *js.CallExpr, *js.NewExpr, *js.DotExpr, *js.IndexExpr, *js.TemplateExpr:
+		if i := p.start(n); i != -1 && p.annotated[i] {
+			// member expressions and tagged templates consume the annotation without being pure, as in /*#__PURE__*/f().a
+			delete(p.annotated, i)
+			switch expr := n.(type) {
+			case *js.CallExpr:
+				p.pure[expr] = true
+			case *js.NewExpr:
+				p.pure[expr] = true
+			}
+		}
+	}
+	return p
+}
+
+func (pureMarker) Exit(js.INode) {}
+
+// pureCallMarker records the calls to functions listed as pure, and to console methods if they are dropped. This must run before renaming variables.
+type pureCallMarker struct {
+	m *jsMinifier
+}
+
+func (p pureCallMarker) Enter(n js.INode) js.IVisitor {
+	switch expr := n.(type) {
+	case *js.CallExpr:
+		if !expr.Optional && p.isPureCallee(expr.X) {
+			p.m.pure[expr] = true
+		}
+	case *js.NewExpr:
+		if p.isPureCallee(expr.X) {
+			p.m.pure[expr] = true
+		}
+	}
+	return p
+}
+
+func (pureCallMarker) Exit(js.INode) {}
+
+func (p pureCallMarker) isPureCallee(callee js.IExpr) bool {
+	if p.m.o.DropConsole {
+		x := callee
+		for {
+			if dot, ok := x.(*js.DotExpr); ok && !dot.Optional {
+				x = dot.X
+			} else if index, ok := x.(*js.IndexExpr); ok && !index.Optional {
+				x = index.X
+			} else {
+				break
+			}
+		}
+		if v, ok := x.(*js.Var); ok && x != callee && bytes.Equal(v.Data, consoleBytes) {
+			for v.Link != nil {
+				v = v.Link
+			}
+			if v.Decl == js.NoDecl {
+				return true
+			}
+		}
+	}
+	if 0 < len(p.m.o.PureFuncs) {
+		if name, ok := calleeName(callee); ok {
+			for _, pureFunc := range p.m.o.PureFuncs {
+				if name == pureFunc {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// calleeName returns the name of an identifier or of a member expression of an identifier, such as Math.floor.
+func calleeName(i js.IExpr) (string, bool) {
+	switch expr := i.(type) {
+	case *js.Var:
+		return string(expr.Data), true
+	case *js.DotExpr:
+		if y, ok := expr.Y.(js.LiteralExpr); ok && !expr.Optional {
+			if x, ok := calleeName(expr.X); ok {
+				return x + "." + string(y.Data), true
+			}
+		}
+	case *js.GroupExpr:
+		return calleeName(expr.X)
+	}
+	return "", false
+}
+
+// isPure returns true if the call or new expression has no side effects besides evaluating its arguments.
+func (m *jsMinifier) isPure(i js.IExpr) bool {
+	return m.pure[i]
+}
+
+// hasSideEffects returns true if the expression has side effects, taking into account pure calls.
+func (m *jsMinifier) hasSideEffects(i js.IExpr) bool {
+	return hasSideEffectsPure(i, m.isPure)
+}
@@ -115,7 +115,10 @@ func optimizeStmt(i js.IStmt) js.IStmt {
 		//	}
 		//}
 
-		if decl.TokenType == js.ErrorToken {
+		if len(decl.List) == 0 {
+			// all declarations were removed, such as inlined const variables
+			return &js.EmptyStmt{}
+		} else if decl.TokenType == js.ErrorToken {
 			// convert hoisted var declaration to expression or empty (if there are no defines) statement
 			for _, item := range decl.List {
 				if item.Default != nil {
@@ -0,0 +1,150 @@
+package js
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+
+	"github.com/tdewolff/minify/v2"
+	"github.com/tdewolff/parse/v2"
+	"github.com/tdewolff/parse/v2/html"
+	"github.com/tdewolff/parse/v2/js"
+)
+
+// DefaultTemplateTags are the tag names of template literals used by libraries such as lit and styled-components, mapped to the mimetype of their contents.
+var DefaultTemplateTags = map[string]string{
+	"html": "text/html",
+	"svg":  "image/svg+xml",
+	"css":  "text/css",
+}
+
+var templatePlaceholderBytes = []byte("__minify_template_")
+
+// templateMinifier minifies the contents of tagged template literals, such as html`<p>${a}</p>`, with the minifier for the mimetype of the tag. Substitutions are replaced by placeholders that are restored afterwards, and the template is kept as it is if the minifier fails, changes the placeholders, or if the template contains escape sequences.
+type templateMinifier struct {
+	m    *minify.M
+	tags map[string]string
+}
+
+func (t templateMinifier) Enter(n js.INode) js.IVisitor {
+	if tmpl, ok := n.(*js.TemplateExpr); ok && tmpl.Tag != nil {
+		if mimetype, ok := t.tags[templateTagName(tmpl.Tag)]; ok {
+			t.minify(tmpl, mimetype)
+		}
+	}
+	return t
+}
+
+func (t templateMinifier) Exit(js.INode) {}
+
+// templateTagName returns the name of a tag such as html or styled.div, or an empty string if the tag is not an identifier or member expression. The identifier must be a global variable or an import binding, which are both undeclared, so that a local variable named html is not mistaken for the tag of a library.
+func templateTagName(i js.IExpr) string {
+	switch expr := i.(type) {
+	case *js.Var:
+		v := expr
+		for v.Link != nil {
+			v = v.Link
+		}
+		if v.Decl != js.NoDecl {
+			return ""
+		}
+		return string(expr.Data)
+	case *js.DotExpr:
+		if name := templateTagName(expr.X); name != "" && !expr.Optional {
+			if y, ok := expr.Y.(js.LiteralExpr); ok {
+				return name + "." + string(y.Data)
+			}
+		}
+	}
+	return ""
+}
+
+func templatePlaceholder(i int) []byte {
+	return append(strconv.AppendInt(append([]byte{}, templatePlaceholderBytes...), int64(i), 10), '_', '_')
+}
+
+// quoteTemplateAttrs restores the quotes of attribute values that contain placeholders, such as class="${a}". The HTML minifier removes them since the placeholder needs no quotes, but the substituted value may contain spaces.
+func quoteTemplateAttrs(b []byte) []byte {
+	// the lexer lowercases attribute names in place
+	l := html.NewLexer(parse.NewInputBytes(bytes.Clone(b)))
+	var vals [][]byte
+	for {
+		tt, _ := l.Next()
+		if tt == html.ErrorToken {
+			break
+		} else if val := l.AttrVal(); tt == html.AttributeToken && 0 < len(val) && val[0] != '"' && val[0] != '\'' && bytes.Contains(val, templatePlaceholderBytes) {
+			vals = append(vals, val)
+		}
+	}
+	for _, val := range vals {
+		// find the value in b by its first placeholder, which is unique
+		k := bytes.Index(val, templatePlaceholderBytes)
+		n := k + len(templatePlaceholderBytes)
+		for n < len(val) && '0' <= val[n] && val[n] <= '9' {
+			n++
+		}
+		j := bytes.Index(b, val[k:n+2])
+		if j == -1 || j < k {
+			continue
+		}
+		j -= k
+		quoted := make([]byte, 0, len(b)+2)
+		quoted = append(quoted, b[:j]...)
+		quoted = append(quoted, '"')
+		quoted = append(quoted, b[j:j+len(val)]...)
+		quoted = append(quoted, '"')
+		b = append(quoted, b[j+len(val):]...)
+	}
+	return b
+}
+
+func (t templateMinifier) minify(tmpl *js.TemplateExpr, mimetype string) {
+	buf := &bytes.Buffer{}
+	for i, item := range tmpl.List {
+		buf.Write(item.Value[1 : len(item.Value)-2])
+		buf.Write(templatePlaceholder(i))
+	}
+	buf.Write(tmpl.Tail[1 : len(tmpl.Tail)-1])
+	if bytes.IndexByte(buf.Bytes(), '\\') != -1 || bytes.Count(buf.Bytes(), templatePlaceholderBytes) != len(tmpl.List) {
+		return
+	}
+
+	out := &bytes.Buffer{}
+	if err := t.m.Minify(mimetype, out, buf); err != nil {
+		return
+	}
+
+	b := out.Bytes()
+	if strings.Contains(mimetype, "html") {
+		b = quoteTemplateAttrs(b)
+	}
+	quasis := make([][]byte, 0, len(tmpl.List)+1)
+	for i := range tmpl.List {
+		placeholder := templatePlaceholder(i)
+		j := bytes.Index(b, placeholder)
+		if j == -1 {
+			return
+		}
+		quasis = append(quasis, b[:j])
+		b = b[j+len(placeholder):]
+	}
+	quasis = append(quasis, b)
+	for _, quasi := range quasis {
+		if bytes.Contains(quasi, templatePlaceholderBytes) || bytes.IndexByte(quasi, '`') != -1 || bytes.IndexByte(quasi, '\\') != -1 || bytes.Contains(quasi, []byte("${")) {
+			return
+		}
+	}
+
+	for i := range tmpl.List {
+		start := byte('}')
+		if i == 0 {
+			start = '`'
+		}
+		tmpl.List[i].Value = append(append([]byte{start}, quasis[i]...), '$', '{')
+	}
+	start := byte('}')
+	if len(tmpl.List) == 0 {
+		start = '`'
+	}
+	tmpl.Tail = append(append([]byte{start}, quasis[len(quasis)-1]...), '`')
+}
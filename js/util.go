@@ -3,7 +3,6 @@ package js
 import (
 	"bytes"
 	"encoding/hex"
-	"slices"
 	stdStrconv "strconv"
 	"unicode/utf8"
 
@@ -93,6 +92,14 @@ var (
 	isNaNBytes                 = []byte("isNaN")
 	NumberBytes                = []byte("Number")
 	MathBytes                  = []byte("Math")
+	ObjectBytes                = []byte("Object")
+	lengthBytes                = []byte("length")
+	trueBytes                  = []byte("true")
+	falseBytes                 = []byte("false")
+	numberBytes                = []byte("number")
+	stringBytes                = []byte("string")
+	booleanBytes               = []byte("boolean")
+	objectBytes                = []byte("object")
 )
 
 func isEmptyStmt(stmt js.IStmt) bool {
@@ -161,8 +168,8 @@ func endsInIf(istmt js.IStmt) bool {
 var unaryPrecMap = map[js.TokenType]js.OpPrec{
 	js.PostIncrToken: js.OpLHS,
 	js.PostDecrToken: js.OpLHS,
-	js.PreIncrToken:  js.OpUnary,
-	js.PreDecrToken:  js.OpUnary,
+	js.PreIncrToken:  js.OpLHS,
+	js.PreDecrToken:  js.OpLHS,
 	js.NotToken:      js.OpUnary,
 	js.BitNotToken:   js.OpUnary,
 	js.TypeofToken:   js.OpUnary,
@@ -350,46 +357,63 @@ func exprPrec(i js.IExpr) js.OpPrec {
 }
 
 func hasSideEffects(i js.IExpr) bool {
+	return hasSideEffectsPure(i, nil)
+}
+
+// hasSideEffectsPure is like hasSideEffects, but calls and new expressions for which isPure returns true only have the side effects of their arguments.
+func hasSideEffectsPure(i js.IExpr, isPure func(js.IExpr) bool) bool {
 	// assume that variable usage and that the index operator themselves have no side effects
 	switch expr := i.(type) {
 	case *js.Var:
 		return true
 	case *js.LiteralExpr, *js.FuncDecl, *js.ClassDecl, *js.ArrowFunc, *js.NewTargetExpr, *js.ImportMetaExpr:
 		return false
-	case *js.NewExpr, *js.CallExpr, *js.YieldExpr:
+	case *js.CallExpr:
+		if isPure != nil && isPure(expr) {
+			return hasSideEffectsArgs(expr.Args, isPure)
+		}
+		return true
+	case *js.NewExpr:
+		if isPure != nil && isPure(expr) {
+			return expr.Args != nil && hasSideEffectsArgs(*expr.Args, isPure)
+		}
+		return true
+	case *js.YieldExpr:
 		return true
 	case *js.GroupExpr:
-		return hasSideEffects(expr.X)
+		return hasSideEffectsPure(expr.X, isPure)
 	case *js.DotExpr:
 		return true
 	case *js.IndexExpr:
 		return true
 	case *js.CondExpr:
-		return hasSideEffects(expr.Cond) || hasSideEffects(expr.X) || hasSideEffects(expr.Y)
+		return hasSideEffectsPure(expr.Cond, isPure) || hasSideEffectsPure(expr.X, isPure) || hasSideEffectsPure(expr.Y, isPure)
 	case *js.CommaExpr:
-		if slices.ContainsFunc(expr.List, hasSideEffects) {
-			return true
+		for _, item := range expr.List {
+			if hasSideEffectsPure(item, isPure) {
+				return true
+			}
 		}
 	case *js.ArrayExpr:
 		for _, item := range expr.List {
-			if hasSideEffects(item.Value) {
+			if hasSideEffectsPure(item.Value, isPure) {
 				return true
 			}
 		}
 		return false
 	case *js.ObjectExpr:
 		for _, item := range expr.List {
-			if hasSideEffects(item.Value) || item.Init != nil && hasSideEffects(item.Init) || item.Name != nil && item.Name.IsComputed() && hasSideEffects(item.Name.Computed) {
+			if hasSideEffectsPure(item.Value, isPure) || item.Init != nil && hasSideEffectsPure(item.Init, isPure) || item.Name != nil && item.Name.IsComputed() && hasSideEffectsPure(item.Name.Computed, isPure) {
 				return true
 			}
 		}
 		return false
 	case *js.TemplateExpr:
-		if hasSideEffects(expr.Tag) {
+		if hasSideEffectsPure(expr.Tag, isPure) {
 			return true
 		}
 		for _, item := range expr.List {
-			if hasSideEffects(item.Expr) {
+			if hasSideEffectsPure(item.Expr, isPure) {
 				return true
 			}
 		}
@@ -398,13 +422,29 @@ func hasSideEffects(i js.IExpr) bool {
 		if expr.Op == js.DeleteToken || expr.Op == js.PreIncrToken || expr.Op == js.PreDecrToken || expr.Op == js.PostIncrToken || expr.Op == js.PostDecrToken {
 			return true
 		}
-		return hasSideEffects(expr.X)
+		return hasSideEffectsPure(expr.X, isPure)
 	case *js.BinaryExpr:
-		return binaryOpPrecMap[expr.Op] == js.OpAssign
+		if binaryOpPrecMap[expr.Op] == js.OpAssign {
+			return true
+		}
+		// operands that are variables are assumed to have no side effects, but calls, assignments, and updates do
+		_, isVarX := expr.X.(*js.Var)
+		_, isVarY := expr.Y.(*js.Var)
+		return !isVarX && hasSideEffectsPure(expr.X, isPure) || !isVarY && hasSideEffectsPure(expr.Y, isPure)
 	}
 	return true
 }
 
+// hasSideEffectsArgs returns true if evaluating the arguments has side effects, spread arguments may call iterators.
+func hasSideEffectsArgs(args js.Args, isPure func(js.IExpr) bool) bool {
+	for _, arg := range args.List {
+		if arg.Rest || hasSideEffectsPure(arg.Value, isPure) {
+			return true
+		}
+	}
+	return false
+}
+
 // TODO: use in more cases
 func groupExpr(i js.IExpr, prec js.OpPrec) js.IExpr {
 	precInside := exprPrec(i)
@@ -632,7 +672,7 @@ func isFalsy(i js.IExpr) (bool, bool) {
 	if lit, ok := i.(*js.LiteralExpr); ok {
 		tt := lit.TokenType
 		d := lit.Data
-		if tt == js.FalseToken || tt == js.NullToken || tt == js.StringToken && len(lit.Data) == 0 {
+		if tt == js.FalseToken || tt == js.NullToken || tt == js.StringToken && len(lit.Data) == 2 {
 			return !negated, true // falsy
 		} else if tt == js.TrueToken || tt == js.StringToken {
 			return negated, true // truthy
@@ -1462,3 +1502,112 @@ func hexadecimalNumber(num []byte, prec int) []byte {
 	}
 	return minify.Number(b, prec)
 }
+
+// exprReplacer replaces all expressions, except for assignment targets, by the expression returned by the function.
+type exprReplacer func(js.IExpr) js.IExpr
+
+func (f exprReplacer) replace(i *js.IExpr) {
+	if *i != nil {
+		*i = f(*i)
+	}
+}
+
+func (f exprReplacer) Enter(n js.INode) js.IVisitor {
+	switch node := n.(type) {
+	case *js.ExprStmt:
+		f.replace(&node.Value)
+	case *js.IfStmt:
+		f.replace(&node.Cond)
+	case *js.DoWhileStmt:
+		f.replace(&node.Cond)
+	case *js.WhileStmt:
+		f.replace(&node.Cond)
+	case *js.ForStmt:
+		f.replace(&node.Init)
+		f.replace(&node.Cond)
+		f.replace(&node.Post)
+	case *js.ForInStmt:
+		// don't replace in assignment targets
+		f.replace(&node.Value)
+		js.Walk(f, node.Value)
+		js.Walk(f, node.Body)
+		if _, ok := node.Init.(*js.VarDecl); ok {
+			js.Walk(f, node.Init)
+		}
+		return nil
+	case *js.ForOfStmt:
+		f.replace(&node.Value)
+		js.Walk(f, node.Value)
+		js.Walk(f, node.Body)
+		if _, ok := node.Init.(*js.VarDecl); ok {
+			js.Walk(f, node.Init)
+		}
+		return nil
+	case *js.CaseClause:
+		f.replace(&node.Cond)
+	case *js.SwitchStmt:
+		f.replace(&node.Init)
+	case *js.ReturnStmt:
+		f.replace(&node.Value)
+	case *js.WithStmt:
+		f.replace(&node.Cond)
+	case *js.ThrowStmt:
+		f.replace(&node.Value)
+	case *js.ExportStmt:
+		f.replace(&node.Decl)
+	case *js.PropertyName:
+		f.replace(&node.Computed)
+	case *js.BindingElement:
+		f.replace(&node.Default)
+	case *js.Field:
+		f.replace(&node.Init)
+	case *js.ClassDecl:
+		f.replace(&node.Extends)
+	case *js.Element:
+		f.replace(&node.Value)
+	case *js.Property:
+		f.replace(&node.Value)
+		f.replace(&node.Init)
+	case *js.TemplatePart:
+		f.replace(&node.Expr)
+	case *js.GroupExpr:
+		f.replace(&node.X)
+	case *js.IndexExpr:
+		f.replace(&node.X)
+		f.replace(&node.Y)
+	case *js.DotExpr:
+		f.replace(&node.X)
+	case *js.Arg:
+		f.replace(&node.Value)
+	case *js.NewExpr:
+		f.replace(&node.X)
+	case *js.CallExpr:
+		f.replace(&node.X)
+	case *js.UnaryExpr:
+		if node.Op == js.PreIncrToken || node.Op == js.PreDecrToken || node.Op == js.PostIncrToken || node.Op == js.PostDecrToken || node.Op == js.DeleteToken {
+			return nil
+		}
+		f.replace(&node.X)
+	case *js.BinaryExpr:
+		f.replace(&node.Y)
+		if binaryLeftPrecMap[node.Op] == js.OpLHS {
+			// don't replace in assignment targets
+			js.Walk(f, node.Y)
+			return nil
+		}
+		f.replace(&node.X)
+	case *js.CondExpr:
+		f.replace(&node.Cond)
+		f.replace(&node.X)
+		f.replace(&node.Y)
+	case *js.YieldExpr:
+		f.replace(&node.X)
+	case *js.CommaExpr:
+		for j := range node.List {
+			f.replace(&node.List[j])
+		}
+	}
+	return f
+}
+
+func (exprReplacer) Exit(js.INode) {}
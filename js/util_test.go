@@ -117,6 +117,11 @@ func TestHasSideEffects(t *testing.T) {
 		{"a=5", true},
 		{"a+=5", true},
 		{"a+5", false},
+		{"a()+5", true},
+		{"a||b()", true},
+		{"a?b:c()", true},
+		{"!a()", true},
+		{"(a=1)+b", true},
 		{"a()", true},
 		{"a.b", true},
 		{"a.b()", true},
@@ -2,6 +2,7 @@ package js
 
 import (
 	"bytes"
+	"regexp"
 	"slices"
 	"sort"
 
@@ -16,6 +17,9 @@ type renamer struct {
 	identContinue []byte
 	identOrder    map[byte]int
 	reserved      map[string]struct{}
+	userReserved  map[string]struct{} // names that are never renamed nor used as new names
+	keep          map[*js.Var]bool    // function and class names that are not renamed
+	keepNames     map[string]struct{} // names of kept functions and classes, which are not used as new names in any scope as they may shadow outer variables
 	rename        bool
 }
 
@@ -47,6 +51,17 @@ func newRenamer(rename, useCharFreq bool) *renamer {
 	}
 }
 
+// reserve adds names that are never renamed nor used as new names.
+func (r *renamer) reserve(names []string) {
+	if r.userReserved == nil {
+		r.userReserved = make(map[string]struct{}, len(names))
+	}
+	for _, name := range names {
+		r.reserved[name] = struct{}{}
+		r.userReserved[name] = struct{}{}
+	}
+}
+
 func (r *renamer) renameScope(scope js.Scope) {
 	if !r.rename {
 		return
@@ -56,15 +71,33 @@ func (r *renamer) renameScope(scope js.Scope) {
 	// keep function argument declaration order to improve GZIP compression
 	sort.Sort(js.VarsByUses(scope.Declared[scope.NumFuncArgs:]))
 	for _, v := range scope.Declared {
+		if _, ok := r.userReserved[string(v.Data)]; ok || r.keep[v] {
+			continue
+		}
 		v.Data = r.getName(v.Data, i)
 		i++
-		for r.isReserved(v.Data, scope.Undeclared) {
+		for r.isReserved(v.Data, scope.Undeclared) || r.isKept(v.Data, scope.Declared) {
 			v.Data = r.getName(v.Data, i)
 			i++
 		}
 	}
 }
 
+// isKept returns true if the name is used by a declared variable whose name is kept, or by a kept function or class in any scope.
+func (r *renamer) isKept(name []byte, declared js.VarArray) bool {
+	if len(r.keep) == 0 {
+		return false
+	} else if _, ok := r.keepNames[string(name)]; ok {
+		return true
+	}
+	for _, v := range declared {
+		if r.keep[v] && bytes.Equal(v.Data, name) {
+			return true
+		}
+	}
+	return false
+}
+
 // rename all private elements in a class
 func (r *renamer) renameClassScope(scope js.Scope) {
 	if !r.rename {
@@ -80,7 +113,7 @@ func (r *renamer) renameClassScope(scope js.Scope) {
 }
 
 func (r *renamer) isReserved(name []byte, undeclared js.VarArray) bool {
-	if 1 < len(name) { // there are no keywords or known globals that are one character long
+	if 1 < len(name) || r.userReserved != nil { // there are no keywords or known globals that are one character long
 		if _, ok := r.reserved[string(name)]; ok {
 			return true
 		}
@@ -165,6 +198,50 @@ func (r *renamer) getName(name []byte, index int) []byte {
 	return name
 }
 
+// nameKeeper collects the names of function and class declarations and expressions that are not renamed, including the variables whose name is inferred as the name of an anonymous function or class, as in const Foo=()=>{}.
+type nameKeeper struct {
+	o *Minifier
+	r *renamer
+}
+
+func (k nameKeeper) keep(v *js.Var, re *regexp.Regexp) {
+	if v != nil && re != nil && re.Match(v.Data) {
+		k.r.keep[v] = true
+		k.r.keepNames[string(v.Data)] = struct{}{}
+	}
+}
+
+func (k nameKeeper) Enter(n js.INode) js.IVisitor {
+	switch node := n.(type) {
+	case *js.FuncDecl:
+		k.keep(node.Name, k.o.KeepFnNames)
+	case *js.ClassDecl:
+		k.keep(node.Name, k.o.KeepClassNames)
+	case *js.VarDecl:
+		for _, item := range node.List {
+			v, ok := item.Binding.(*js.Var)
+			if !ok {
+				continue
+			}
+			switch def := item.Default.(type) {
+			case *js.ArrowFunc:
+				k.keep(v, k.o.KeepFnNames)
+			case *js.FuncDecl:
+				if def.Name == nil {
+					k.keep(v, k.o.KeepFnNames)
+				}
+			case *js.ClassDecl:
+				if def.Name == nil {
+					k.keep(v, k.o.KeepClassNames)
+				}
+			}
+		}
+	}
+	return k
+}
+
+func (nameKeeper) Exit(js.INode) {}
+
 ////////////////////////////////////////////////////////////////
 
 func hasDefines(v *js.VarDecl) bool {
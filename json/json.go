@@ -2,6 +2,7 @@
 package json
 
 import (
+	"bytes"
 	"io"
 
 	"github.com/tdewolff/minify/v2"
@@ -18,10 +19,36 @@ var (
 
 ////////////////////////////////////////////////////////////////
 
+// DuplicateKeys determines how duplicate keys within an object are handled.
+type DuplicateKeys int
+
+// DuplicateKeys values.
+const (
+	AllowDuplicateKeys DuplicateKeys = iota // keep all keys as is
+	ErrorDuplicateKeys                      // return an error at the position of the duplicate key
+	KeepFirstKey                            // keep the first occurrence of a key and remove the others
+	KeepLastKey                             // keep the last occurrence of a key and remove the others
+)
+
 // Minifier is a JSON minifier.
 type Minifier struct {
-	Precision   int  // number of significant digits
-	KeepNumbers bool // prevent numbers from being minified
+	Precision     int           // number of significant digits
+	KeepNumbers   bool          // prevent numbers from being minified
+	KeepStrings   bool          // prevent string escapes from being minified
+	ASCIIOnly     bool          // escape all non-ASCII characters in strings
+	DuplicateKeys DuplicateKeys // policy for duplicate object keys
+	Strict        bool          // validate the input fully and return an error without writing output if invalid
+}
+
+type objectMember struct {
+	start, end int // position in output
+	drop       bool
+}
+
+type object struct {
+	start   int // position after the opening brace in output
+	members []objectMember
+	keys    map[string]int // key => index into members of the kept member
 }
 
 // Minify minifies JSON data, it reads from r and writes to w.
@@ -36,12 +63,35 @@ func (o *Minifier) Minify(_ *minify.M, w io.Writer, r io.Reader, _ map[string]st
 	z := parse.NewInput(r)
 	defer z.Restore()
 
+	if o.Strict {
+		if err := z.Err(); err != nil && err != io.EOF {
+			return err
+		} else if err := validate(z); err != nil {
+			return err
+		}
+	}
+
+	// duplicate keys are removed from the output after the object has been written, so we buffer the output
+	out := w
+	var buf *bytes.Buffer
+	var objects []object
+	if o.DuplicateKeys != AllowDuplicateKeys {
+		buf = &bytes.Buffer{}
+		w = buf
+	}
+
 	p := json.NewParser(z)
 	for {
 		state := p.State()
+		offset := z.Offset()
 		gt, text := p.Next()
 		if gt == json.ErrorGrammar {
-			if _, err := w.Write(nil); err != nil {
+			if buf != nil {
+				if _, err := out.Write(buf.Bytes()); err != nil {
+					return err
+				}
+			}
+			if _, err := out.Write(nil); err != nil {
 				return err
 			}
 			if p.Err() != io.EOF {
@@ -50,6 +100,14 @@ func (o *Minifier) Minify(_ *minify.M, w io.Writer, r io.Reader, _ map[string]st
 			return nil
 		}
 
+		isKey := state == json.ObjectKeyState && gt == json.StringGrammar
+		if buf != nil && 0 < len(objects) && (isKey || gt == json.EndObjectGrammar) {
+			obj := &objects[len(objects)-1]
+			if 0 < len(obj.members) {
+				obj.members[len(obj.members)-1].end = buf.Len()
+			}
+		}
+
 		if !skipComma && gt != json.EndObjectGrammar && gt != json.EndArrayGrammar {
 			if state == json.ObjectKeyState || state == json.ArrayState {
 				w.Write(commaBytes)
@@ -59,6 +117,36 @@ func (o *Minifier) Minify(_ *minify.M, w io.Writer, r io.Reader, _ map[string]st
 		}
 		skipComma = gt == json.StartObjectGrammar || gt == json.StartArrayGrammar
 
+		if buf != nil {
+			if gt == json.StartObjectGrammar {
+				objects = append(objects, object{start: buf.Len() + 1})
+			} else if gt == json.EndObjectGrammar {
+				objects[len(objects)-1].removeDropped(buf)
+				objects = objects[:len(objects)-1]
+			} else if isKey {
+				obj := &objects[len(objects)-1]
+				if obj.keys == nil {
+					obj.keys = map[string]int{}
+				}
+				member := objectMember{start: buf.Len()}
+				key := string(unescapeString(text[1 : len(text)-1]))
+				if i, ok := obj.keys[key]; ok {
+					switch o.DuplicateKeys {
+					case ErrorDuplicateKeys:
+						return parse.NewError(bytes.NewBuffer(z.Bytes()), keyOffset(z.Bytes(), offset), "duplicate object key %s", text)
+					case KeepFirstKey:
+						member.drop = true
+					case KeepLastKey:
+						obj.members[i].drop = true
+						obj.keys[key] = len(obj.members)
+					}
+				} else {
+					obj.keys[key] = len(obj.members)
+				}
+				obj.members = append(obj.members, member)
+			}
+		}
+
 		if !o.KeepNumbers && 0 < len(text) && ('0' <= text[0] && text[0] <= '9' || text[0] == '-') {
 			text = minify.Number(text, o.Precision)
 			if text[0] == '.' {
@@ -67,7 +155,43 @@ func (o *Minifier) Minify(_ *minify.M, w io.Writer, r io.Reader, _ map[string]st
 				text = text[1:]
 				w.Write(minusZeroBytes)
 			}
+		} else if !o.KeepStrings && gt == json.StringGrammar {
+			text = minifyString(text, o.ASCIIOnly)
 		}
 		w.Write(text)
 	}
 }
+
+// removeDropped removes the dropped members from the object written to buf, which must end with the last member.
+func (obj *object) removeDropped(buf *bytes.Buffer) {
+	n := 0
+	for _, member := range obj.members {
+		if member.drop {
+			n++
+		}
+	}
+	if n == 0 {
+		return
+	}
+
+	b := buf.Bytes()
+	members := make([]byte, 0, len(b)-obj.start)
+	for _, member := range obj.members {
+		if !member.drop {
+			if 0 < len(members) {
+				members = append(members, ',')
+			}
+			members = append(members, b[member.start:member.end]...)
+		}
+	}
+	buf.Truncate(obj.start)
+	buf.Write(members)
+}
+
+// keyOffset returns the offset of the object key that follows offset, skipping whitespace and comma.
+func keyOffset(b []byte, offset int) int {
+	for offset < len(b) && (b[offset] == ' ' || b[offset] == '\n' || b[offset] == '\r' || b[offset] == '\t' || b[offset] == ',') {
+		offset++
+	}
+	return offset
+}
@@ -5,9 +5,11 @@ import (
 	"fmt"
 	"os"
 	"regexp"
+	"strings"
 	"testing"
 
 	"github.com/tdewolff/minify/v2"
+	"github.com/tdewolff/parse/v2"
 	"github.com/tdewolff/test"
 )
 
@@ -67,6 +69,188 @@ func TestJSON_IgnoreNumbers(t *testing.T) {
 
 }
 
+func TestJSONStrings(t *testing.T) {
+	jsonTests := []struct {
+		json     string
+		expected string
+	}{
+		{`"abc"`, `"abc"`},
+		{`"\/"`, `"/"`},
+		{`"\u00e9"`, `"é"`},
+		{`"\u00E9t\u00e9"`, `"été"`},
+		{`"\ud83d\ude00"`, `"😀"`},
+		{`"\ud83d"`, `"\ud83d"`},
+		{`"\ude00\ud83d"`, `"\ude00\ud83d"`},
+		{`"\u0022\u005C"`, `"\"\\"`},
+		{`"\u000a\u0009\u0008\u000C\u000d"`, `"\n\t\b\f\r"`},
+		{`"\u001F"`, `"\u001f"`},
+		{`"\u2028"`, `"\u2028"`},
+		{"\"a\tb\"", `"a\tb"`},
+		{`"\x"`, `"\x"`},
+		{`{"\u0061": "\/"}`, `{"a":"/"}`},
+		{`{"a":"<\/script>"}`, `{"a":"<\/script>"}`},
+		{`"\u003c\/"`, `"<\/"`},
+	}
+
+	m := minify.New()
+	for _, tt := range jsonTests {
+		t.Run(tt.json, func(t *testing.T) {
+			r := bytes.NewBufferString(tt.json)
+			w := &bytes.Buffer{}
+			err := Minify(m, w, r, nil)
+			test.Minify(t, tt.json, err, w.String(), tt.expected)
+		})
+	}
+}
+
+func TestJSONStringsASCIIOnly(t *testing.T) {
+	jsonTests := []struct {
+		json     string
+		expected string
+	}{
+		{`"abc"`, `"abc"`},
+		{`"é"`, `"\u00e9"`},
+		{`"\u00E9"`, `"\u00e9"`},
+		{`"😀"`, `"\ud83d\ude00"`},
+		{`"\/\u0041"`, `"/A"`},
+	}
+
+	m := Minifier{ASCIIOnly: true}
+	for _, tt := range jsonTests {
+		t.Run(tt.json, func(t *testing.T) {
+			r := bytes.NewBufferString(tt.json)
+			w := &bytes.Buffer{}
+			err := m.Minify(nil, w, r, nil)
+			test.Minify(t, tt.json, err, w.String(), tt.expected)
+		})
+	}
+}
+
+func TestJSONDuplicateKeys(t *testing.T) {
+	jsonTests := []struct {
+		duplicateKeys DuplicateKeys
+		json          string
+		expected      string
+	}{
+		{AllowDuplicateKeys, `{"a": 1, "a": 2}`, `{"a":1,"a":2}`},
+		{KeepFirstKey, `{"a": 1, "b": 2}`, `{"a":1,"b":2}`},
+		{KeepFirstKey, `{"a": 1, "a": 2}`, `{"a":1}`},
+		{KeepFirstKey, `{"a": 1, "b": 2, "a": 3, "c": 4}`, `{"a":1,"b":2,"c":4}`},
+		{KeepFirstKey, `{"a": 1, "\u0061": 2}`, `{"a":1}`},
+		{KeepFirstKey, `[{"a": 1, "a": 2}, {"a": 3}]`, `[{"a":1},{"a":3}]`},
+		{KeepLastKey, `{"a": 1, "a": 2}`, `{"a":2}`},
+		{KeepLastKey, `{"a": 1, "b": 2, "a": 3, "c": 4}`, `{"b":2,"a":3,"c":4}`},
+		{KeepLastKey, `{"a": {"b": 1, "b": 2}, "a": {"c": 3, "c": 4}}`, `{"a":{"c":4}}`},
+		{KeepLastKey, `{"a": {"b": 1, "b": 2}, "c": [{"d": 1, "d": 2}]}`, `{"a":{"b":2},"c":[{"d":2}]}`},
+		{KeepLastKey, `{"a": 1, "a": 2, "a": 3}`, `{"a":3}`},
+		{KeepLastKey, `{}`, `{}`},
+	}
+
+	for _, tt := range jsonTests {
+		t.Run(tt.json, func(t *testing.T) {
+			r := bytes.NewBufferString(tt.json)
+			w := &bytes.Buffer{}
+			m := Minifier{DuplicateKeys: tt.duplicateKeys}
+			err := m.Minify(nil, w, r, nil)
+			test.Minify(t, tt.json, err, w.String(), tt.expected)
+		})
+	}
+}
+
+func TestJSONDuplicateKeysError(t *testing.T) {
+	r := bytes.NewBufferString("{\"a\": 1,\n \"b\": {\"a\": 2},\n \"a\": 3}")
+	w := &bytes.Buffer{}
+	m := Minifier{DuplicateKeys: ErrorDuplicateKeys}
+	err := m.Minify(nil, w, r, nil)
+	test.That(t, err != nil, "must return error")
+	line, column, _ := err.(*parse.Error).Position()
+	test.T(t, line, 3, "line")
+	test.T(t, column, 2, "column")
+}
+
+func TestJSONStrict(t *testing.T) {
+	jsonTests := []struct {
+		json     string
+		expected string
+	}{
+		{`{ "a": [1, 2.5e-3, -0] }`, `{"a":[1,0.0025,0]}`},
+		{` [ true, false, null, "\u00e9" ] `, `[true,false,null,"é"]`},
+		{`"a"`, `"a"`},
+	}
+
+	m := Minifier{Strict: true}
+	for _, tt := range jsonTests {
+		t.Run(tt.json, func(t *testing.T) {
+			r := bytes.NewBufferString(tt.json)
+			w := &bytes.Buffer{}
+			err := m.Minify(nil, w, r, nil)
+			test.Minify(t, tt.json, err, w.String(), tt.expected)
+		})
+	}
+}
+
+func TestJSONStrictErrors(t *testing.T) {
+	jsonTests := []struct {
+		json   string
+		line   int
+		column int
+	}{
+		{``, 1, 1},
+		{`[1,]`, 1, 4},
+		{`{"a": 1,}`, 1, 9},
+		{"{\n  \"a\": 01\n}", 2, 9},
+		{`[1.]`, 1, 4},
+		{`[1e]`, 1, 4},
+		{`[-]`, 1, 3},
+		{`[.5]`, 1, 2},
+		{`["a\x"]`, 1, 5},
+		{"[\"a\tb\"]", 1, 4},
+		{"[\"\xff\"]", 1, 3},
+		{`["\u12G4"]`, 1, 7},
+		{`["abc`, 1, 6},
+		{`[1] [2]`, 1, 5},
+		{`[tru]`, 1, 2},
+		{`{"a" 1}`, 1, 6},
+		{`{a: 1}`, 1, 2},
+		{`[1 2]`, 1, 4},
+	}
+
+	m := Minifier{Strict: true}
+	for _, tt := range jsonTests {
+		t.Run(tt.json, func(t *testing.T) {
+			r := bytes.NewBufferString(tt.json)
+			w := &bytes.Buffer{}
+			err := m.Minify(nil, w, r, nil)
+			test.That(t, err != nil, "must return error")
+			test.T(t, w.String(), "", "must not write output")
+			if perr, ok := err.(*parse.Error); ok {
+				line, column, _ := perr.Position()
+				test.T(t, line, tt.line, "line")
+				test.T(t, column, tt.column, "column")
+			} else {
+				test.Fail(t, "must return parse error", err)
+			}
+		})
+	}
+
+	// error context on a later line
+	r := bytes.NewBufferString("{\n  \"a\": 1,\n  \"b\": 01\n}")
+	err := m.Minify(nil, &bytes.Buffer{}, r, nil)
+	test.T(t, err.Error(), "expected comma character or object ending but got character '1' on line 3 and column 9\n    3:   \"b\": 01\n               ^")
+
+	// deep nesting
+	r = bytes.NewBufferString("[\n" + strings.Repeat("[", 100000))
+	err = m.Minify(nil, &bytes.Buffer{}, r, nil)
+	if perr, ok := err.(*parse.Error); ok {
+		line, column, _ := perr.Position()
+		test.T(t, perr.Message, "exceeded maximum nesting depth of 10000")
+		test.T(t, line, 2, "line")
+		test.T(t, column, 10000, "column")
+	} else {
+		test.Fail(t, "must return parse error", err)
+	}
+}
+
 func TestReaderErrors(t *testing.T) {
 	r := test.NewErrorReader(0)
 	w := &bytes.Buffer{}
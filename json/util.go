@@ -0,0 +1,195 @@
+package json
+
+import (
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// unescapeString returns the value of a JSON string without quotes by resolving all escape sequences.
+// Invalid escape sequences are left as is.
+func unescapeString(b []byte) []byte {
+	i := 0
+	for i < len(b) && b[i] != '\\' {
+		i++
+	}
+	if i == len(b) {
+		return b
+	}
+
+	s := make([]byte, i, len(b))
+	copy(s, b[:i])
+	for i < len(b) {
+		if b[i] != '\\' || i+1 == len(b) {
+			s = append(s, b[i])
+			i++
+			continue
+		}
+		switch c := b[i+1]; c {
+		case '"', '\\', '/':
+			s = append(s, c)
+		case 'b':
+			s = append(s, '\b')
+		case 'f':
+			s = append(s, '\f')
+		case 'n':
+			s = append(s, '\n')
+		case 'r':
+			s = append(s, '\r')
+		case 't':
+			s = append(s, '\t')
+		case 'u':
+			r, n := unescapeUnicode(b[i:])
+			if n == 0 {
+				s = append(s, b[i:i+2]...)
+				break
+			}
+			s = utf8.AppendRune(s, r)
+			i += n
+			continue
+		default:
+			s = append(s, b[i:i+2]...)
+		}
+		i += 2
+	}
+	return s
+}
+
+// unescapeUnicode parses a \uXXXX escape sequence at the start of b, including a following low surrogate if b starts with a high surrogate. It returns the rune and the number of bytes consumed, or zero if b doesn't start with a valid escape.
+func unescapeUnicode(b []byte) (rune, int) {
+	r, ok := parseHex4(b)
+	if !ok {
+		return 0, 0
+	} else if 0xD800 <= r && r < 0xDC00 {
+		if r2, ok := parseHex4(b[6:]); ok && 0xDC00 <= r2 && r2 < 0xE000 {
+			return 0x10000 + (r-0xD800)<<10 + (r2 - 0xDC00), 12
+		}
+	}
+	return r, 6
+}
+
+func parseHex4(b []byte) (rune, bool) {
+	if len(b) < 6 || b[0] != '\\' || b[1] != 'u' {
+		return 0, false
+	}
+	var r rune
+	for _, c := range b[2:6] {
+		r <<= 4
+		if '0' <= c && c <= '9' {
+			r |= rune(c - '0')
+		} else if 'a' <= c && c <= 'f' {
+			r |= rune(c - 'a' + 10)
+		} else if 'A' <= c && c <= 'F' {
+			r |= rune(c - 'A' + 10)
+		} else {
+			return 0, false
+		}
+	}
+	return r, true
+}
+
+// minifyString rewrites all escape sequences in a JSON string (including quotes) to their shortest form. Characters that must be escaped (quotes, backslashes, control characters and lone surrogates) are escaped using the shortest escape sequence, and all other characters are written as UTF-8. U+2028 and U+2029 are kept escaped for compatibility with JavaScript. When ascii is set, all non-ASCII characters are escaped with \uXXXX.
+func minifyString(b []byte, ascii bool) []byte {
+	if len(b) < 2 {
+		return b
+	}
+
+	i := 1
+	for i < len(b)-1 && b[i] != '\\' && 0x20 <= b[i] && (!ascii || b[i] < 0x80) {
+		i++
+	}
+	if i == len(b)-1 {
+		return b // nothing to do
+	}
+
+	s := make([]byte, i, len(b))
+	copy(s, b[:i])
+	str := b[:len(b)-1]
+	for i < len(str) {
+		c := str[i]
+		if c == '\\' && i+1 < len(str) {
+			r, n := rune(0), 2
+			switch str[i+1] {
+			case '"', '\\':
+				r = rune(str[i+1])
+			case '/':
+				if 0 < len(s) && s[len(s)-1] == '<' {
+					// keep </ escaped so that </script> can't close an HTML script element
+					s = append(s, '\\', '/')
+					i += 2
+					continue
+				}
+				r = '/'
+			case 'b':
+				r = '\b'
+			case 'f':
+				r = '\f'
+			case 'n':
+				r = '\n'
+			case 'r':
+				r = '\r'
+			case 't':
+				r = '\t'
+			case 'u':
+				r, n = unescapeUnicode(str[i:])
+			default:
+				n = 0
+			}
+			if n == 0 {
+				// invalid escape sequence
+				s = append(s, str[i:i+2]...)
+				i += 2
+				continue
+			}
+			s = appendStringRune(s, r, ascii)
+			i += n
+		} else if c < 0x20 {
+			s = appendStringRune(s, rune(c), ascii)
+			i++
+		} else if ascii && 0x80 <= c {
+			r, n := utf8.DecodeRune(str[i:])
+			if r == utf8.RuneError && n == 1 {
+				s = append(s, c) // invalid UTF-8
+			} else {
+				s = appendStringRune(s, r, ascii)
+			}
+			i += n
+		} else {
+			s = append(s, c)
+			i++
+		}
+	}
+	return append(s, '"')
+}
+
+// appendStringRune appends r to a JSON string using the shortest representation.
+func appendStringRune(b []byte, r rune, ascii bool) []byte {
+	switch r {
+	case '"':
+		return append(b, '\\', '"')
+	case '\\':
+		return append(b, '\\', '\\')
+	case '\b':
+		return append(b, '\\', 'b')
+	case '\f':
+		return append(b, '\\', 'f')
+	case '\n':
+		return append(b, '\\', 'n')
+	case '\r':
+		return append(b, '\\', 'r')
+	case '\t':
+		return append(b, '\\', 't')
+	}
+	if r < 0x20 || 0xD800 <= r && r < 0xE000 || r == 0x2028 || r == 0x2029 || ascii && 0x80 <= r {
+		if 0x10000 <= r {
+			r1, r2 := utf16.EncodeRune(r)
+			return appendUnicodeEscape(appendUnicodeEscape(b, r1), r2)
+		}
+		return appendUnicodeEscape(b, r)
+	}
+	return utf8.AppendRune(b, r)
+}
+
+func appendUnicodeEscape(b []byte, r rune) []byte {
+	const hexDigits = "0123456789abcdef"
+	return append(b, '\\', 'u', hexDigits[r>>12&0xF], hexDigits[r>>8&0xF], hexDigits[r>>4&0xF], hexDigits[r&0xF])
+}
@@ -0,0 +1,231 @@
+package json
+
+import (
+	"bytes"
+	"unicode/utf8"
+
+	"github.com/tdewolff/parse/v2"
+)
+
+// maxDepth is the maximum nesting depth of arrays and objects, as the validator is recursive.
+const maxDepth = 10000
+
+// validator validates JSON following RFC 8259.
+type validator struct {
+	b     []byte
+	i     int
+	depth int
+}
+
+// validate returns an error with the line and column of the first violation of the JSON grammar, or nil if the input is valid JSON.
+func validate(z *parse.Input) error {
+	v := &validator{b: z.Bytes()}
+	v.moveWhitespace()
+	if err := v.value(); err != nil {
+		return err
+	}
+	v.moveWhitespace()
+	if v.i < len(v.b) {
+		return v.errorf("unexpected %s after value", v.describe())
+	}
+	return nil
+}
+
+// errorf returns an error at the current position.
+func (v *validator) errorf(message string, a ...interface{}) error {
+	return parse.NewError(bytes.NewReader(v.b), v.i, message, a...)
+}
+
+// describe returns a description of the current character to be used in error messages.
+func (v *validator) describe() string {
+	if len(v.b) <= v.i {
+		return "end of input"
+	} else if r, n := utf8.DecodeRune(v.b[v.i:]); r == utf8.RuneError && n == 1 {
+		return "invalid UTF-8 byte"
+	} else if r < 0x20 {
+		return "control character"
+	} else {
+		return "character '" + string(r) + "'"
+	}
+}
+
+func (v *validator) peek() byte {
+	if v.i < len(v.b) {
+		return v.b[v.i]
+	}
+	return 0
+}
+
+func (v *validator) moveWhitespace() {
+	for v.i < len(v.b) && (v.b[v.i] == ' ' || v.b[v.i] == '\n' || v.b[v.i] == '\r' || v.b[v.i] == '\t') {
+		v.i++
+	}
+}
+
+func (v *validator) value() error {
+	switch c := v.peek(); c {
+	case '{', '[':
+		if v.depth == maxDepth {
+			return v.errorf("exceeded maximum nesting depth of %d", maxDepth)
+		}
+		v.depth++
+		defer func() { v.depth-- }()
+		if c == '{' {
+			return v.object()
+		}
+		return v.array()
+	case '"':
+		return v.string()
+	case 't':
+		return v.literal("true")
+	case 'f':
+		return v.literal("false")
+	case 'n':
+		return v.literal("null")
+	default:
+		if c == '-' || '0' <= c && c <= '9' {
+			return v.number()
+		}
+	}
+	return v.errorf("expected value but got %s", v.describe())
+}
+
+func (v *validator) object() error {
+	v.i++ // {
+	v.moveWhitespace()
+	if v.peek() == '}' {
+		v.i++
+		return nil
+	}
+	for {
+		if v.peek() != '"' {
+			return v.errorf("expected object key to be a quoted string but got %s", v.describe())
+		} else if err := v.string(); err != nil {
+			return err
+		}
+		v.moveWhitespace()
+		if v.peek() != ':' {
+			return v.errorf("expected colon character after object key but got %s", v.describe())
+		}
+		v.i++
+		v.moveWhitespace()
+		if err := v.value(); err != nil {
+			return err
+		}
+		v.moveWhitespace()
+		if c := v.peek(); c == '}' {
+			v.i++
+			return nil
+		} else if c != ',' {
+			return v.errorf("expected comma character or object ending but got %s", v.describe())
+		}
+		v.i++
+		v.moveWhitespace()
+	}
+}
+
+func (v *validator) array() error {
+	v.i++ // [
+	v.moveWhitespace()
+	if v.peek() == ']' {
+		v.i++
+		return nil
+	}
+	for {
+		if err := v.value(); err != nil {
+			return err
+		}
+		v.moveWhitespace()
+		if c := v.peek(); c == ']' {
+			v.i++
+			return nil
+		} else if c != ',' {
+			return v.errorf("expected comma character or array ending but got %s", v.describe())
+		}
+		v.i++
+		v.moveWhitespace()
+	}
+}
+
+func (v *validator) literal(s string) error {
+	if !bytes.HasPrefix(v.b[v.i:], []byte(s)) {
+		return v.errorf("expected value but got %s", v.describe())
+	}
+	v.i += len(s)
+	return nil
+}
+
+func (v *validator) number() error {
+	if v.peek() == '-' {
+		v.i++
+	}
+	if c := v.peek(); c == '0' {
+		v.i++
+	} else if '1' <= c && c <= '9' {
+		v.moveDigits()
+	} else {
+		return v.errorf("expected digit in number but got %s", v.describe())
+	}
+	if v.peek() == '.' {
+		v.i++
+		if c := v.peek(); c < '0' || '9' < c {
+			return v.errorf("expected digit after decimal point but got %s", v.describe())
+		}
+		v.moveDigits()
+	}
+	if c := v.peek(); c == 'e' || c == 'E' {
+		v.i++
+		if c := v.peek(); c == '+' || c == '-' {
+			v.i++
+		}
+		if c := v.peek(); c < '0' || '9' < c {
+			return v.errorf("expected digit in exponent but got %s", v.describe())
+		}
+		v.moveDigits()
+	}
+	return nil
+}
+
+func (v *validator) moveDigits() {
+	for c := v.peek(); '0' <= c && c <= '9'; c = v.peek() {
+		v.i++
+	}
+}
+
+func (v *validator) string() error {
+	v.i++ // "
+	for {
+		if len(v.b) <= v.i {
+			return v.errorf("unterminated string")
+		}
+		c := v.b[v.i]
+		if c == '"' {
+			v.i++
+			return nil
+		} else if c == '\\' {
+			v.i++
+			switch v.peek() {
+			case '"', '\\', '/', 'b', 'f', 'n', 'r', 't':
+				v.i++
+			case 'u':
+				v.i++
+				for j := 0; j < 4; j++ {
+					if c := v.peek(); !('0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F') {
+						return v.errorf("expected hexadecimal digit in unicode escape but got %s", v.describe())
+					}
+					v.i++
+				}
+			default:
+				return v.errorf("invalid escape sequence in string")
+			}
+		} else if c < 0x20 {
+			return v.errorf("unescaped control character in string")
+		} else if c < 0x80 {
+			v.i++
+		} else if r, n := utf8.DecodeRune(v.b[v.i:]); r == utf8.RuneError && n == 1 {
+			return v.errorf("invalid UTF-8 in string")
+		} else {
+			v.i += n
+		}
+	}
+}
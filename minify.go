@@ -124,6 +124,9 @@ type M struct {
 	pattern []patternMinifier
 
 	URL *url.URL
+
+	// RewriteURL is called for each URL in CSS url() tokens, HTML URL attributes, and SVG href attributes, with the mediatype of the document. The returned URL replaces the original, which allows rewriting asset paths to a CDN or to fingerprinted names. Data URIs and fragment-only URLs are not passed.
+	RewriteURL func(mediatype, url string) (string, error)
 }
 
 // New returns a new M.
@@ -133,6 +136,7 @@ func New() *M {
 		map[string]Minifier{},
 		[]patternMinifier{},
 		nil,
+		nil,
 	}
 }
 
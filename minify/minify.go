@@ -20,7 +20,8 @@ func init() {
 	Default.AddFunc("text/css", css.Minify)
 	Default.AddFunc("text/html", html.Minify)
 	Default.AddFunc("image/svg+xml", svg.Minify)
-	Default.AddFuncRegexp(regexp.MustCompile("^(application|text)/(x-)?(java|ecma|j|live)script(1\\.[0-5])?$|^module$"), js.Minify)
+	Default.AddFuncRegexp(regexp.MustCompile("^(application|text)/(x-)?(java|ecma|j|live)script(1\\.[0-5])?$"), js.Minify)
+	Default.Add("module", &js.Minifier{Module: true})
 	Default.AddFuncRegexp(regexp.MustCompile("[/+]json$"), json.Minify)
 	Default.AddFuncRegexp(regexp.MustCompile("[/+]xml$"), xml.Minify)
 
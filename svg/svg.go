@@ -24,6 +24,7 @@ var (
 	noneBytes        = []byte("none")
 	urlBytes         = []byte("url(")
 	xmlnsBytes       = []byte("xmlns")
+	xlinkHrefBytes   = []byte("xlink:href")
 )
 
 ////////////////////////////////////////////////////////////////
@@ -216,6 +217,11 @@ func (o *Minifier) Minify(m *minify.M, w io.Writer, r io.Reader, params map[stri
 				} else if err != minify.ErrNotExist {
 					return minify.UpdateErrorPosition(err, z, t.Offset)
 				}
+			} else if attr == Href || bytes.Equal(t.Text, xlinkHrefBytes) {
+				var err error
+				if val, err = minify.RewriteURL(m, "image/svg+xml", val); err != nil {
+					return err
+				}
 			} else if attr == D {
 				val = p.ShortenPathData(val)
 			} else if attr == ViewBox {
@@ -217,6 +217,41 @@ func TestSVGNamespaces(t *testing.T) {
 		})
 	}
 }
+
+func TestSVGRewriteURL(t *testing.T) {
+	var svgTests = []struct {
+		svg      string
+		expected string
+	}{
+		{`<image href="a.png"/>`, `<image href="https://cdn.example.com/a.png"/>`},
+		{`<svg xmlns:xlink="http://www.w3.org/1999/xlink"><image xlink:href="a.png"/></svg>`, `<svg xmlns:xlink="http://www.w3.org/1999/xlink"><image xlink:href="https://cdn.example.com/a.png"/></svg>`},
+		{`<use href="#icon"/>`, `<use href="#icon"/>`},
+		{`<use href="sprite.svg#icon"/>`, `<use href="https://cdn.example.com/sprite.svg#icon"/>`},
+	}
+
+	m := minify.New()
+	m.RewriteURL = func(mediatype, url string) (string, error) {
+		if mediatype != "image/svg+xml" {
+			return "", fmt.Errorf("unexpected mediatype %s", mediatype)
+		} else if url == "error.png" {
+			return "", fmt.Errorf("cannot rewrite %s", url)
+		}
+		return "https://cdn.example.com/" + url, nil
+	}
+	o := &Minifier{inline: true}
+	for _, tt := range svgTests {
+		t.Run(tt.svg, func(t *testing.T) {
+			r := bytes.NewBufferString(tt.svg)
+			w := &bytes.Buffer{}
+			err := o.Minify(m, w, r, nil)
+			test.Minify(t, tt.svg, err, w.String(), tt.expected)
+		})
+	}
+
+	err := o.Minify(m, &bytes.Buffer{}, bytes.NewBufferString(`<image href="error.png"/>`), nil)
+	test.T(t, fmt.Sprint(err), "cannot rewrite error.png")
+}
+
 func TestReaderErrors(t *testing.T) {
 	r := test.NewErrorReader(0)
 	w := &bytes.Buffer{}